@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Account products
+const (
+	SAVINGS_ACCOUNT = "SAVINGS"
+	CURRENT_ACCOUNT = "CURRENT"
+)
+
+// Product defaults
+const (
+	DEFAULT_SAVINGS_RATE = 3.5   // annual interest in percent
+	OVERDRAFT_FEE        = 250.0 // charged on each debit that uses the overdraft
+	DAYS_PER_YEAR        = 365.0
+)
+
+// Record types posted by the products
+const (
+	INTEREST_CREDIT_TYPE = "INTEREST_CREDIT"
+	OVERDRAFT_FEE_TYPE   = "OVERDRAFT_FEE"
+)
+
+// Clock supplies the current time so that date-driven logic can be tested
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock reads the real wall clock
+type systemClock struct{}
+
+// Now returns the current local time
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// manualClock is a clock that only moves when told to, used by batch
+// scripts and tests. It is safe to read while another goroutine moves it,
+// as the alert workers do during a batch run.
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// Now returns the clock's current time
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set moves the clock to a time
+func (c *manualClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward
+func (c *manualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// SetClock replaces the clock used for timestamps and accruals, and by
+// the alert workers when they send
+func (fm *FinancialManager) SetClock(clock Clock) {
+	fm.clock = clock
+	if fm.alerts != nil {
+		fm.alerts.setClock(clock)
+	}
+}
+
+// startOfDay truncates a time to midnight in its own location
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// roundAmount rounds a value to whole paise
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// SetAccountType switches the product of an account
+func (fm *FinancialManager) SetAccountType(profileID int, accountType string) error {
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return err
+	}
+
+	// Bring the accrual up to today under the old product first, so the
+	// days before the switch are neither lost nor accrued at the new rate
+	fm.accrueInterest(user, startOfDay(fm.clock.Now()))
+
+	accountType = strings.ToUpper(accountType)
+	switch accountType {
+	case SAVINGS_ACCOUNT:
+		if user.CurrentFunds < 0 {
+			return errors.New("an overdrawn account cannot be converted to savings")
+		}
+		user.OverdraftLimit = 0
+		if user.InterestRate == 0 {
+			user.InterestRate = DEFAULT_SAVINGS_RATE
+		}
+	case CURRENT_ACCOUNT:
+		if user.AccruedInterest > 0 {
+			fm.postInterest(user, fm.clock.Now())
+		}
+		user.InterestRate = 0
+	default:
+		return fmt.Errorf("invalid account type: %s", accountType)
+	}
+
+	user.AccountType = accountType
+	return nil
+}
+
+// SetInterestRate sets the annual interest rate of a savings account
+func (fm *FinancialManager) SetInterestRate(profileID int, annualRate float64) error {
+	if annualRate < 0 {
+		return errors.New("interest rate cannot be negative")
+	}
+
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return err
+	}
+	if user.AccountType != SAVINGS_ACCOUNT {
+		return fmt.Errorf("profile %d is not a savings account", profileID)
+	}
+
+	user.InterestRate = annualRate
+	return nil
+}
+
+// SetOverdraftLimit sets the agreed overdraft of a current account
+func (fm *FinancialManager) SetOverdraftLimit(profileID int, limit float64) error {
+	if limit < 0 {
+		return errors.New("overdraft limit cannot be negative")
+	}
+
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return err
+	}
+	if user.AccountType != CURRENT_ACCOUNT {
+		return fmt.Errorf("profile %d is not a current account", profileID)
+	}
+	if user.CurrentFunds < -limit {
+		return fmt.Errorf("account is already overdrawn beyond %s", user.money(limit))
+	}
+
+	user.OverdraftLimit = limit
+	return nil
+}
+
+// AvailableFunds returns the amount that can be withdrawn, including any overdraft
+func (user *UserAccount) AvailableFunds() float64 {
+	if user.AccountType == CURRENT_ACCOUNT {
+		return user.CurrentFunds + user.OverdraftLimit
+	}
+	return user.CurrentFunds
+}
+
+// overdraftFee returns the fee due for a debit, or zero if it stays in credit
+func (user *UserAccount) overdraftFee(amount float64) float64 {
+	if user.AccountType == CURRENT_ACCOUNT && user.CurrentFunds-amount < 0 {
+		return OVERDRAFT_FEE
+	}
+	return 0
+}
+
+// ProcessAccruals accrues daily interest on savings accounts for every
+// completed day since the last run and posts it at each month end
+func (fm *FinancialManager) ProcessAccruals() {
+	today := startOfDay(fm.clock.Now())
+	for _, user := range fm.users {
+		fm.accrueInterest(user, today)
+	}
+}
+
+// accrueInterest brings a single account's accrual up to date
+func (fm *FinancialManager) accrueInterest(user *UserAccount, today time.Time) {
+	if user.LastAccrual.IsZero() {
+		user.LastAccrual = today
+		return
+	}
+
+	for day := user.LastAccrual; day.Before(today); day = day.AddDate(0, 0, 1) {
+		if user.AccountType == SAVINGS_ACCOUNT && user.CurrentFunds > 0 {
+			user.AccruedInterest += user.CurrentFunds * user.InterestRate / 100 / DAYS_PER_YEAR
+		}
+
+		// Post the month's interest on its last day
+		if day.AddDate(0, 0, 1).Month() != day.Month() {
+			fm.postInterest(user, day.AddDate(0, 0, 1).Add(-time.Second))
+		}
+	}
+	user.LastAccrual = today
+}
+
+// postInterest credits the accrued interest to the account
+func (fm *FinancialManager) postInterest(user *UserAccount, postedOn time.Time) {
+	interest := roundAmount(user.AccruedInterest)
+	user.AccruedInterest = 0
+	if interest <= 0 {
+		return
+	}
+
+	user.CurrentFunds += interest
+	fm.recordActivity(user, INTEREST_CREDIT_TYPE, interest, postedOn)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newSavingsAccount registers a savings account at 3.5% holding 36500, so
+// it accrues exactly 3.50 a day
+func newSavingsAccount(t *testing.T, start time.Time) (*FinancialManager, *manualClock, *UserAccount) {
+	t.Helper()
+	clock := &manualClock{now: start}
+	manager := InitializeManager()
+	manager.SetClock(clock)
+	user, err := manager.RegisterCustomer(1, "Saver", SAVINGS_ACCOUNT, "1234")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := manager.AddFunds(1, 36500); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	return manager, clock, user
+}
+
+// interestPostings returns the interest credits on an account
+func interestPostings(user *UserAccount) []Transaction {
+	postings := make([]Transaction, 0)
+	for _, txn := range user.Transactions {
+		if txn.Type == INTEREST_CREDIT_TYPE {
+			postings = append(postings, txn)
+		}
+	}
+	return postings
+}
+
+func TestInterestPostedAtMonthEnd(t *testing.T) {
+	cases := []struct {
+		name  string
+		start time.Time
+		want  float64
+	}{
+		{"thirty-one days", time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local), 108.50},
+		{"leap February", time.Date(2024, 2, 1, 9, 0, 0, 0, time.Local), 101.50},
+		{"short February", time.Date(2023, 2, 1, 9, 0, 0, 0, time.Local), 98.00},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			manager, clock, user := newSavingsAccount(t, c.start)
+			monthEnd := c.start.AddDate(0, 1, -1)
+
+			clock.now = monthEnd
+			manager.ProcessAccruals()
+			if postings := interestPostings(user); len(postings) != 0 {
+				t.Fatalf("interest posted before the month ended: %+v", postings)
+			}
+
+			clock.now = c.start.AddDate(0, 1, 0)
+			manager.ProcessAccruals()
+			postings := interestPostings(user)
+			if len(postings) != 1 || postings[0].Amount != c.want {
+				t.Fatalf("postings = %+v; want one credit of %.2f", postings, c.want)
+			}
+			if day := postings[0].Timestamp; day.Day() != monthEnd.Day() || day.Month() != monthEnd.Month() {
+				t.Errorf("posted on %s; want %s", day.Format(DATE_FORMAT), monthEnd.Format(DATE_FORMAT))
+			}
+		})
+	}
+}
+
+func TestSwitchToCurrentPostsInterestToDate(t *testing.T) {
+	manager, clock, user := newSavingsAccount(t, time.Date(2024, 6, 10, 9, 0, 0, 0, time.Local))
+
+	// Five days pass without an accrual run before the switch
+	clock.Advance(5 * 24 * time.Hour)
+	if err := manager.SetAccountType(1, CURRENT_ACCOUNT); err != nil {
+		t.Fatalf("switch: %v", err)
+	}
+	postings := interestPostings(user)
+	if len(postings) != 1 || postings[0].Amount != 17.50 {
+		t.Fatalf("postings = %+v; want one credit of 17.50", postings)
+	}
+
+	// Nothing more accrues on the current account, even at month end
+	clock.now = time.Date(2024, 7, 2, 9, 0, 0, 0, time.Local)
+	manager.ProcessAccruals()
+	if got := len(interestPostings(user)); got != 1 || user.AccruedInterest != 0 {
+		t.Errorf("%d postings and %.2f accrued after the switch; want 1 and 0", got, user.AccruedInterest)
+	}
+}
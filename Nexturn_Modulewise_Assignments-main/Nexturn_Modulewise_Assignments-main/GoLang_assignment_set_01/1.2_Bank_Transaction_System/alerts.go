@@ -0,0 +1,502 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Alert rule kinds
+const (
+	ALERT_LOW_BALANCE = "LOW_BALANCE"
+	ALERT_LARGE_DEBIT = "LARGE_DEBIT"
+)
+
+// Webhook delivery settings
+const (
+	ALERT_DEAD_LETTER_FILE = "alerts_dead_letter.jsonl"
+	ALERT_QUEUE_SIZE       = 100
+	ALERT_WORKERS          = 4
+	ALERT_MAX_ATTEMPTS     = 5
+	ALERT_RETRY_BACKOFF    = 500 * time.Millisecond
+	ALERT_REQUEST_TIMEOUT  = 5 * time.Second
+	ALERT_SECRET_BYTES     = 16
+)
+
+// Webhook request headers
+const (
+	ALERT_SIGNATURE_HEADER = "X-Alert-Signature"
+	ALERT_TIMESTAMP_HEADER = "X-Alert-Timestamp"
+)
+
+// Errors returned for alert rules
+var (
+	ErrAlertRuleNotFound = errors.New("alert rule not found")
+	ErrWebhookNotPublic  = errors.New("webhook must be on a public address")
+)
+
+// internalNetworks are address ranges webhooks may not reach beyond those
+// the net package already classifies as loopback, private or link-local:
+// "this network", carrier-grade NAT, IETF protocol assignments, benchmarking
+// and reserved space
+var internalNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+)
+
+// mustParseCIDRs parses a fixed list of address ranges
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// isInternalIP reports whether an address belongs to the bank's own host
+// or network rather than the public internet
+func isInternalIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, network := range internalNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWebhookURL accepts http(s) URLs whose host is not obviously internal.
+// Names are only resolved when a delivery connects, where publicDialer
+// checks the address actually used.
+func checkWebhookURL(endpoint string, allowInternal bool) error {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return fmt.Errorf("invalid webhook URL: %q", endpoint)
+	}
+	if allowInternal {
+		return nil
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
+	if ip := net.ParseIP(host); ip != nil {
+		if isInternalIP(ip) {
+			return fmt.Errorf("%w: %s", ErrWebhookNotPublic, endpoint)
+		}
+		return nil
+	}
+	if !strings.Contains(host, ".") || host == "localhost" ||
+		strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".internal") || strings.HasSuffix(host, ".local") {
+		return fmt.Errorf("%w: %s", ErrWebhookNotPublic, endpoint)
+	}
+	return nil
+}
+
+// publicDialer connects only to public addresses. The check runs on the
+// resolved address of every connection, redirects included, so a name
+// that resolves inside the network is refused too.
+func publicDialer(allowInternal bool) func(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: ALERT_REQUEST_TIMEOUT}
+	if !allowInternal {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isInternalIP(ip) {
+				return fmt.Errorf("%w: %s", ErrWebhookNotPublic, host)
+			}
+			return nil
+		}
+	}
+	return dialer.DialContext
+}
+
+// AlertRule sends a webhook when a posting on an account meets its condition
+type AlertRule struct {
+	ID        int
+	ProfileID int
+	Kind      string
+	Threshold float64
+	URL       string
+	Secret    string
+}
+
+// AlertPayload is the JSON body delivered to a webhook
+type AlertPayload struct {
+	AlertID         string  `json:"alert_id"`
+	RuleID          int     `json:"rule_id"`
+	Kind            string  `json:"kind"`
+	ProfileID       int     `json:"profile_id"`
+	TransactionID   int     `json:"transaction_id"`
+	TransactionType string  `json:"transaction_type"`
+	Amount          float64 `json:"amount"`
+	Balance         float64 `json:"balance"`
+	Threshold       float64 `json:"threshold"`
+	Currency        string  `json:"currency"`
+	Timestamp       string  `json:"timestamp"`
+	Message         string  `json:"message"`
+}
+
+// alertDelivery is a payload waiting to be sent to one endpoint
+type alertDelivery struct {
+	url     string
+	secret  string
+	payload AlertPayload
+}
+
+// deadLetter is a line of the dead-letter file
+type deadLetter struct {
+	URL       string       `json:"url"`
+	Attempts  int          `json:"attempts"`
+	LastError string       `json:"last_error"`
+	FailedAt  string       `json:"failed_at"`
+	Payload   AlertPayload `json:"payload"`
+}
+
+// AlertDispatcher delivers alerts to webhooks in the background, retrying
+// failures with exponential backoff and recording undeliverable alerts in
+// a dead-letter file. Deliveries only go to public addresses.
+type AlertDispatcher struct {
+	client         *http.Client
+	queue          chan alertDelivery
+	deadLetterPath string
+	backoff        time.Duration
+	clockMu        sync.Mutex
+	clock          Clock
+	sleep          func(time.Duration)
+	fileMu         sync.Mutex
+	wg             sync.WaitGroup
+}
+
+// NewAlertDispatcher starts a dispatcher that writes failed deliveries to
+// deadLetterPath, stamping requests and failures with the clock's time
+func NewAlertDispatcher(deadLetterPath string, clock Clock) *AlertDispatcher {
+	return newAlertDispatcher(deadLetterPath, clock, time.Sleep, false)
+}
+
+// newAlertDispatcher starts a dispatcher that waits between retries with
+// sleep, so tests can observe the backoff without waiting it out, and
+// that may deliver to internal addresses when allowInternal is set
+func newAlertDispatcher(deadLetterPath string, clock Clock, sleep func(time.Duration), allowInternal bool) *AlertDispatcher {
+	d := &AlertDispatcher{
+		client: &http.Client{
+			Timeout:   ALERT_REQUEST_TIMEOUT,
+			Transport: &http.Transport{DialContext: publicDialer(allowInternal)},
+		},
+		queue:          make(chan alertDelivery, ALERT_QUEUE_SIZE),
+		deadLetterPath: deadLetterPath,
+		backoff:        ALERT_RETRY_BACKOFF,
+		clock:          clock,
+		sleep:          sleep,
+	}
+	// Several workers, so one failing endpoint's retries do not hold up the rest
+	for i := 0; i < ALERT_WORKERS; i++ {
+		d.wg.Add(1)
+		go d.run()
+	}
+	return d
+}
+
+// now reads the dispatcher's current clock
+func (d *AlertDispatcher) now() time.Time {
+	d.clockMu.Lock()
+	defer d.clockMu.Unlock()
+	return d.clock.Now()
+}
+
+// setClock replaces the clock used for later deliveries
+func (d *AlertDispatcher) setClock(clock Clock) {
+	d.clockMu.Lock()
+	defer d.clockMu.Unlock()
+	d.clock = clock
+}
+
+// Close stops accepting alerts and waits for queued ones to be delivered
+// or dead-lettered
+func (d *AlertDispatcher) Close() {
+	close(d.queue)
+	d.wg.Wait()
+}
+
+// enqueue hands an alert to the background workers without blocking. When
+// the queue is full the alert goes straight to the dead-letter file.
+func (d *AlertDispatcher) enqueue(delivery alertDelivery) {
+	select {
+	case d.queue <- delivery:
+	default:
+		d.writeDeadLetter(delivery, 0, errors.New("alert queue is full"))
+	}
+}
+
+// run delivers queued alerts until the queue is closed
+func (d *AlertDispatcher) run() {
+	defer d.wg.Done()
+	for delivery := range d.queue {
+		d.deliver(delivery)
+	}
+}
+
+// deliver posts an alert, retrying with exponential backoff
+func (d *AlertDispatcher) deliver(delivery alertDelivery) {
+	body, err := json.Marshal(delivery.payload)
+	if err != nil {
+		d.writeDeadLetter(delivery, 0, err)
+		return
+	}
+
+	wait := d.backoff
+	for attempt := 1; ; attempt++ {
+		retryable, err := d.post(delivery, body)
+		if err == nil {
+			return
+		}
+		if !retryable || attempt == ALERT_MAX_ATTEMPTS {
+			d.writeDeadLetter(delivery, attempt, err)
+			return
+		}
+		d.sleep(wait)
+		wait *= 2
+	}
+}
+
+// post sends one signed request and reports whether a failure is worth
+// retrying. Client errors other than 429 and refused destinations are not
+// retried.
+func (d *AlertDispatcher) post(delivery alertDelivery, body []byte) (bool, error) {
+	request, err := http.NewRequest(http.MethodPost, delivery.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := strconv.FormatInt(d.now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(ALERT_TIMESTAMP_HEADER, timestamp)
+	request.Header.Set(ALERT_SIGNATURE_HEADER, "sha256="+signAlert(delivery.secret, timestamp, body))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return !errors.Is(err, ErrWebhookNotPublic), err
+	}
+	response.Body.Close()
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		return false, nil
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500:
+		return true, fmt.Errorf("webhook returned %s", response.Status)
+	default:
+		return false, fmt.Errorf("webhook returned %s", response.Status)
+	}
+}
+
+// signAlert computes the HMAC-SHA256 of the timestamp and body, so the
+// receiver can check both where the alert came from and that it is fresh
+func signAlert(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// writeDeadLetter appends an undeliverable alert to the dead-letter file
+func (d *AlertDispatcher) writeDeadLetter(delivery alertDelivery, attempts int, cause error) {
+	line, err := json.Marshal(deadLetter{
+		URL:       delivery.url,
+		Attempts:  attempts,
+		LastError: cause.Error(),
+		FailedAt:  d.now().Format(time.RFC3339),
+		Payload:   delivery.payload,
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to encode dead-letter alert: %v\n", err)
+		return
+	}
+
+	d.fileMu.Lock()
+	defer d.fileMu.Unlock()
+
+	file, err := os.OpenFile(d.deadLetterPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Printf("Warning: failed to open dead-letter file: %v\n", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		fmt.Printf("Warning: failed to write dead-letter alert: %v\n", err)
+	}
+}
+
+// StartAlerts begins delivering alerts, recording failures in deadLetterPath
+func (fm *FinancialManager) StartAlerts(deadLetterPath string) {
+	fm.alerts = newAlertDispatcher(deadLetterPath, fm.clock, time.Sleep, fm.allowInternalWebhooks)
+}
+
+// StopAlerts waits for pending alerts and stops delivering new ones
+func (fm *FinancialManager) StopAlerts() {
+	if fm.alerts != nil {
+		fm.alerts.Close()
+		fm.alerts = nil
+	}
+}
+
+// AddAlertRule registers a webhook alert for an account. A signing secret
+// is generated when none is given; callers show it to the customer once,
+// when the rule is created.
+func (fm *FinancialManager) AddAlertRule(profileID int, kind string, threshold float64, endpoint, secret string) (*AlertRule, error) {
+	if _, err := fm.LocateUser(profileID); err != nil {
+		return nil, err
+	}
+
+	kind = strings.ToUpper(kind)
+	switch kind {
+	case ALERT_LOW_BALANCE:
+	case ALERT_LARGE_DEBIT:
+		if threshold <= 0 {
+			return nil, errors.New("large debit threshold must be greater than zero")
+		}
+	default:
+		return nil, fmt.Errorf("invalid alert kind: %s", kind)
+	}
+
+	if err := checkWebhookURL(endpoint, fm.allowInternalWebhooks); err != nil {
+		return nil, err
+	}
+
+	if secret == "" {
+		raw := make([]byte, ALERT_SECRET_BYTES)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("failed to generate webhook secret: %v", err)
+		}
+		secret = hex.EncodeToString(raw)
+	}
+
+	fm.lastAlertRuleID++
+	rule := &AlertRule{
+		ID:        fm.lastAlertRuleID,
+		ProfileID: profileID,
+		Kind:      kind,
+		Threshold: threshold,
+		URL:       endpoint,
+		Secret:    secret,
+	}
+	fm.alertRules = append(fm.alertRules, rule)
+	return rule, nil
+}
+
+// RemoveAlertRule deletes an alert rule owned by the given profile
+func (fm *FinancialManager) RemoveAlertRule(profileID, ruleID int) error {
+	for i, rule := range fm.alertRules {
+		if rule.ID == ruleID && rule.ProfileID == profileID {
+			fm.alertRules = append(fm.alertRules[:i], fm.alertRules[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w (ID %d)", ErrAlertRuleNotFound, ruleID)
+}
+
+// AlertRulesFor returns the alert rules of a profile
+func (fm *FinancialManager) AlertRulesFor(profileID int) []*AlertRule {
+	rules := make([]*AlertRule, 0)
+	for _, rule := range fm.alertRules {
+		if rule.ProfileID == profileID {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// evaluateAlerts checks a new posting against the account's alert rules
+// and queues a webhook for each rule it triggers. A low balance alert
+// fires only when the balance crosses below the threshold.
+func (fm *FinancialManager) evaluateAlerts(user *UserAccount, txn Transaction) {
+	if fm.alerts == nil {
+		return
+	}
+
+	previous := txn.Balance - txn.Amount
+	for _, rule := range fm.alertRules {
+		if rule.ProfileID != user.ProfileID {
+			continue
+		}
+
+		var message string
+		switch rule.Kind {
+		case ALERT_LOW_BALANCE:
+			if txn.Balance < rule.Threshold && previous >= rule.Threshold {
+				message = fmt.Sprintf("balance %s fell below %s", user.money(txn.Balance), user.money(rule.Threshold))
+			}
+		case ALERT_LARGE_DEBIT:
+			if -txn.Amount >= rule.Threshold {
+				message = fmt.Sprintf("debit of %s is at least %s", user.money(-txn.Amount), user.money(rule.Threshold))
+			}
+		}
+		if message == "" {
+			continue
+		}
+
+		fm.alerts.enqueue(alertDelivery{
+			url:    rule.URL,
+			secret: rule.Secret,
+			payload: AlertPayload{
+				AlertID:         fmt.Sprintf("alert-%d-%d", txn.ID, rule.ID),
+				RuleID:          rule.ID,
+				Kind:            rule.Kind,
+				ProfileID:       user.ProfileID,
+				TransactionID:   txn.ID,
+				TransactionType: txn.Type,
+				Amount:          txn.Amount,
+				Balance:         txn.Balance,
+				Threshold:       rule.Threshold,
+				Currency:        user.Currency,
+				Timestamp:       txn.Timestamp.Format(time.RFC3339),
+				Message:         message,
+			},
+		})
+	}
+}
+
+// ShowAlertRules displays a user's alert rules
+func (fm *FinancialManager) ShowAlertRules(profileID int) {
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	rules := fm.AlertRulesFor(profileID)
+	if len(rules) == 0 {
+		fmt.Println("No alert rules found.")
+		return
+	}
+
+	fmt.Printf("\nAlert Rules for Profile %d:\n", profileID)
+	fmt.Println("----------------------------------------")
+	for _, rule := range rules {
+		fmt.Printf("#%d %s %s -> %s\n", rule.ID, rule.Kind, user.money(rule.Threshold), rule.URL)
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookCall is a request received by the test webhook
+type webhookCall struct {
+	header http.Header
+	body   []byte
+}
+
+// testWebhook answers with the given statuses in turn, repeating the last
+// one, and records every request
+type testWebhook struct {
+	mu       sync.Mutex
+	statuses []int
+	calls    []webhookCall
+}
+
+func (h *testWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls = append(h.calls, webhookCall{header: r.Header.Clone(), body: body})
+	status := h.statuses[len(h.statuses)-1]
+	if len(h.calls) <= len(h.statuses) {
+		status = h.statuses[len(h.calls)-1]
+	}
+	w.WriteHeader(status)
+}
+
+// received returns the requests recorded so far
+func (h *testWebhook) received() []webhookCall {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]webhookCall(nil), h.calls...)
+}
+
+// newAlertTest starts a webhook and a dispatcher that records its retry
+// waits instead of sleeping. The dispatcher is closed, flushing every
+// delivery, before the returned function reports the waits. The webhook
+// is local, so the dispatcher is allowed internal addresses.
+func newAlertTest(t *testing.T, statuses ...int) (*httptest.Server, *testWebhook, *AlertDispatcher, string, func() []time.Duration) {
+	return newAlertTestTo(t, true, statuses...)
+}
+
+// newAlertTestTo is newAlertTest with the choice of whether the dispatcher
+// may reach internal addresses
+func newAlertTestTo(t *testing.T, allowInternal bool, statuses ...int) (*httptest.Server, *testWebhook, *AlertDispatcher, string, func() []time.Duration) {
+	t.Helper()
+	hook := &testWebhook{statuses: statuses}
+	server := httptest.NewServer(hook)
+	t.Cleanup(server.Close)
+
+	var mu sync.Mutex
+	waits := make([]time.Duration, 0)
+	deadLetterPath := filepath.Join(t.TempDir(), ALERT_DEAD_LETTER_FILE)
+	clock := &manualClock{now: time.Date(2024, 6, 10, 9, 0, 0, 0, time.UTC)}
+	dispatcher := newAlertDispatcher(deadLetterPath, clock, func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		waits = append(waits, d)
+	}, allowInternal)
+
+	flush := func() []time.Duration {
+		dispatcher.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		return waits
+	}
+	return server, hook, dispatcher, deadLetterPath, flush
+}
+
+// testDelivery is an alert addressed to the test webhook
+func testDelivery(url string) alertDelivery {
+	return alertDelivery{
+		url:     url,
+		secret:  "s3cret",
+		payload: AlertPayload{AlertID: "alert-7-1", RuleID: 1, Kind: ALERT_LARGE_DEBIT, ProfileID: 101, Amount: -6000},
+	}
+}
+
+// readDeadLetters returns the lines of a dead-letter file
+func readDeadLetters(t *testing.T, path string) []deadLetter {
+	t.Helper()
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("open dead-letter file: %v", err)
+	}
+	defer file.Close()
+
+	letters := make([]deadLetter, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var letter deadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			t.Fatalf("parse dead letter %q: %v", scanner.Text(), err)
+		}
+		letters = append(letters, letter)
+	}
+	return letters
+}
+
+func TestAlertSignature(t *testing.T) {
+	server, hook, dispatcher, _, flush := newAlertTest(t, http.StatusOK)
+	dispatcher.enqueue(testDelivery(server.URL))
+	flush()
+
+	calls := hook.received()
+	if len(calls) != 1 {
+		t.Fatalf("%d requests; want 1", len(calls))
+	}
+	call := calls[0]
+	timestamp := call.header.Get(ALERT_TIMESTAMP_HEADER)
+	if want := strconv.FormatInt(time.Date(2024, 6, 10, 9, 0, 0, 0, time.UTC).Unix(), 10); timestamp != want {
+		t.Errorf("timestamp %q; want %q from the dispatcher's clock", timestamp, want)
+	}
+	if got, want := call.header.Get(ALERT_SIGNATURE_HEADER), "sha256="+signAlert("s3cret", timestamp, call.body); got != want {
+		t.Errorf("signature %q; want %q", got, want)
+	}
+	if signAlert("other", timestamp, call.body) == signAlert("s3cret", timestamp, call.body) {
+		t.Error("signature does not depend on the secret")
+	}
+
+	var payload AlertPayload
+	if err := json.Unmarshal(call.body, &payload); err != nil || payload.AlertID != "alert-7-1" {
+		t.Errorf("payload %s: %v", call.body, err)
+	}
+}
+
+func TestAlertRetryBackoff(t *testing.T) {
+	server, hook, dispatcher, deadLetterPath, flush := newAlertTest(t,
+		http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+	dispatcher.enqueue(testDelivery(server.URL))
+	waits := flush()
+
+	if calls := hook.received(); len(calls) != 3 {
+		t.Errorf("%d requests; want 3", len(calls))
+	}
+	want := []time.Duration{ALERT_RETRY_BACKOFF, 2 * ALERT_RETRY_BACKOFF}
+	if len(waits) != len(want) || waits[0] != want[0] || waits[1] != want[1] {
+		t.Errorf("waits %v; want %v", waits, want)
+	}
+	if letters := readDeadLetters(t, deadLetterPath); len(letters) != 0 {
+		t.Errorf("delivered alert was dead-lettered: %+v", letters)
+	}
+}
+
+func TestAlertDeadLetter(t *testing.T) {
+	cases := []struct {
+		name     string
+		status   int
+		attempts int
+	}{
+		{name: "server errors", status: http.StatusInternalServerError, attempts: ALERT_MAX_ATTEMPTS},
+		{name: "client error", status: http.StatusBadRequest, attempts: 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, hook, dispatcher, deadLetterPath, flush := newAlertTest(t, tc.status)
+			dispatcher.enqueue(testDelivery(server.URL))
+			waits := flush()
+
+			if calls := hook.received(); len(calls) != tc.attempts {
+				t.Errorf("%d requests; want %d", len(calls), tc.attempts)
+			}
+			if len(waits) != tc.attempts-1 {
+				t.Errorf("waits %v; want %d", waits, tc.attempts-1)
+			}
+			for i := 1; i < len(waits); i++ {
+				if waits[i] != 2*waits[i-1] {
+					t.Errorf("waits %v do not double", waits)
+				}
+			}
+
+			letters := readDeadLetters(t, deadLetterPath)
+			if len(letters) != 1 {
+				t.Fatalf("dead letters %+v; want 1", letters)
+			}
+			letter := letters[0]
+			if letter.URL != server.URL || letter.Attempts != tc.attempts || letter.Payload.AlertID != "alert-7-1" {
+				t.Errorf("dead letter %+v", letter)
+			}
+			if letter.FailedAt != "2024-06-10T09:00:00Z" {
+				t.Errorf("failed at %q; want the dispatcher's clock", letter.FailedAt)
+			}
+		})
+	}
+}
+
+func TestAlertRulesTrigger(t *testing.T) {
+	server, hook, dispatcher, _, flush := newAlertTest(t, http.StatusOK)
+	manager := InitializeManager()
+	manager.SetClock(&manualClock{now: time.Date(2024, 6, 10, 9, 0, 0, 0, time.UTC)})
+	manager.alerts = dispatcher
+	manager.allowInternalWebhooks = true
+	if _, err := manager.RegisterCustomer(101, "Watcher", CURRENT_ACCOUNT, "1234"); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if _, err := manager.AddAlertRule(101, ALERT_LOW_BALANCE, 1000, server.URL, "s3cret"); err != nil {
+		t.Fatalf("add low balance rule: %v", err)
+	}
+	if _, err := manager.AddAlertRule(101, ALERT_LARGE_DEBIT, 5000, server.URL, "s3cret"); err != nil {
+		t.Fatalf("add large debit rule: %v", err)
+	}
+
+	steps := []func() error{
+		func() error { return manager.AddFunds(101, 10000) },
+		func() error { return manager.RemoveFunds(101, 6000) }, // large debit
+		func() error { return manager.RemoveFunds(101, 3500) }, // crosses below 1000
+		func() error { return manager.RemoveFunds(101, 100) },  // already below
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+	flush()
+
+	kinds := make([]string, 0)
+	for _, call := range hook.received() {
+		var payload AlertPayload
+		if err := json.Unmarshal(call.body, &payload); err != nil {
+			t.Fatalf("payload %s: %v", call.body, err)
+		}
+		kinds = append(kinds, payload.Kind)
+	}
+	if len(kinds) != 2 {
+		t.Fatalf("alerts %v; want one large debit and one low balance", kinds)
+	}
+	counts := map[string]int{}
+	for _, kind := range kinds {
+		counts[kind]++
+	}
+	if counts[ALERT_LARGE_DEBIT] != 1 || counts[ALERT_LOW_BALANCE] != 1 {
+		t.Errorf("alerts %v; want one large debit and one low balance", kinds)
+	}
+}
+
+func TestAlertRuleDestinations(t *testing.T) {
+	manager := InitializeManager()
+	if _, err := manager.RegisterCustomer(101, "Watcher", CURRENT_ACCOUNT, "1234"); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	cases := []struct {
+		url    string
+		public bool
+	}{
+		{url: "https://example.com/hook", public: true},
+		{url: "http://93.184.216.34/hook", public: true},
+		{url: "http://127.0.0.1:8080/hook"},
+		{url: "http://[::1]/hook"},
+		{url: "http://localhost/hook"},
+		{url: "http://api.localhost/hook"},
+		{url: "http://10.0.0.5/hook"},
+		{url: "http://172.16.4.1/hook"},
+		{url: "http://192.168.1.1/hook"},
+		{url: "http://169.254.169.254/latest/meta-data"},
+		{url: "http://100.64.0.1/hook"},
+		{url: "http://0.0.0.0/hook"},
+		{url: "http://[fd00::1]/hook"},
+		{url: "http://metadata.google.internal/hook"},
+		{url: "http://printer.local/hook"},
+		{url: "http://intranet/hook"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.url, func(t *testing.T) {
+			_, err := manager.AddAlertRule(101, ALERT_LOW_BALANCE, 1000, tc.url, "s3cret")
+			if tc.public && err != nil {
+				t.Errorf("public webhook refused: %v", err)
+			}
+			if !tc.public && !errors.Is(err, ErrWebhookNotPublic) {
+				t.Errorf("AddAlertRule() = %v; want %v", err, ErrWebhookNotPublic)
+			}
+		})
+	}
+}
+
+func TestAlertDispatcherRefusesInternalAddresses(t *testing.T) {
+	// The rule check passes names it cannot judge without resolving them,
+	// so the dispatcher checks the address it connects to as well
+	server, hook, dispatcher, deadLetterPath, flush := newAlertTestTo(t, false, http.StatusOK)
+	dispatcher.enqueue(testDelivery(server.URL))
+	waits := flush()
+
+	if calls := hook.received(); len(calls) != 0 {
+		t.Errorf("%d requests reached a loopback webhook; want none", len(calls))
+	}
+	if len(waits) != 0 {
+		t.Errorf("refused delivery was retried after %v", waits)
+	}
+	letters := readDeadLetters(t, deadLetterPath)
+	if len(letters) != 1 || letters[0].Attempts != 1 {
+		t.Fatalf("dead letters %+v; want one after a single attempt", letters)
+	}
+}
+
+func TestAlertsFollowManagerClock(t *testing.T) {
+	server, hook, dispatcher, _, flush := newAlertTest(t, http.StatusOK)
+	manager := InitializeManager()
+	manager.alerts = dispatcher
+	manager.allowInternalWebhooks = true
+
+	// A batch run swaps the clock after the workers have started
+	clock := &manualClock{now: time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)}
+	manager.SetClock(clock)
+	if _, err := manager.RegisterCustomer(101, "Watcher", CURRENT_ACCOUNT, "1234"); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if _, err := manager.AddAlertRule(101, ALERT_LARGE_DEBIT, 100, server.URL, "s3cret"); err != nil {
+		t.Fatalf("add rule: %v", err)
+	}
+	if err := manager.AddFunds(101, 1000); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	clock.Advance(time.Hour)
+	if err := manager.RemoveFunds(101, 500); err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	flush()
+
+	calls := hook.received()
+	if len(calls) != 1 {
+		t.Fatalf("%d requests; want 1", len(calls))
+	}
+	if got, want := calls[0].header.Get(ALERT_TIMESTAMP_HEADER), strconv.FormatInt(clock.Now().Unix(), 10); got != want {
+		t.Errorf("timestamp %q; want %q from the manager's clock at sending", got, want)
+	}
+}
@@ -0,0 +1,865 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IDEMPOTENCY_HEADER carries the client-supplied idempotency key
+const IDEMPOTENCY_HEADER = "Idempotency-Key"
+
+// APIServer exposes a FinancialManager over a JSON HTTP API
+type APIServer struct {
+	manager     *FinancialManager
+	mux         *http.ServeMux
+	sessions    *sessionStore
+	operatorKey string
+}
+
+// accountView is the JSON form of an account
+type accountView struct {
+	ProfileID      int     `json:"profile_id"`
+	FullName       string  `json:"full_name"`
+	AccountType    string  `json:"account_type"`
+	Currency       string  `json:"currency"`
+	Status         string  `json:"status"`
+	Balance        float64 `json:"balance"`
+	AvailableFunds float64 `json:"available_funds"`
+	OverdraftLimit float64 `json:"overdraft_limit,omitempty"`
+	InterestRate   float64 `json:"interest_rate,omitempty"`
+}
+
+// transactionView is the JSON form of a transaction
+type transactionView struct {
+	ID         int     `json:"id"`
+	Type       string  `json:"type"`
+	Amount     float64 `json:"amount"`
+	Balance    float64 `json:"balance"`
+	Timestamp  string  `json:"timestamp"`
+	LinkedID   int     `json:"linked_id,omitempty"`
+	ReversedBy int     `json:"reversed_by,omitempty"`
+}
+
+// alertRuleView is the JSON form of an alert rule. The signing secret is
+// left out; it is only returned once, when the rule is created.
+type alertRuleView struct {
+	ID        int     `json:"id"`
+	Kind      string  `json:"kind"`
+	Threshold float64 `json:"threshold"`
+	URL       string  `json:"url"`
+}
+
+// newAlertView is the JSON response to creating an alert rule
+type newAlertView struct {
+	alertRuleView
+	Secret string `json:"secret"`
+}
+
+// operationView is the JSON response to a deposit, withdrawal or transfer
+type operationView struct {
+	ProfileID      int     `json:"profile_id"`
+	Amount         float64 `json:"amount"`
+	Balance        float64 `json:"balance"`
+	TransactionIDs []int   `json:"transaction_ids"`
+	Replayed       bool    `json:"replayed"`
+}
+
+// registerRequest is the body of POST /accounts
+type registerRequest struct {
+	ProfileID   int    `json:"profile_id"`
+	FullName    string `json:"full_name"`
+	AccountType string `json:"account_type"`
+	Currency    string `json:"currency,omitempty"`
+	PIN         string `json:"pin"`
+}
+
+// amountRequest is the body of deposit, withdrawal and transfer requests
+type amountRequest struct {
+	Amount      float64 `json:"amount"`
+	ToProfileID int     `json:"to_profile_id,omitempty"`
+	Currency    string  `json:"currency,omitempty"`
+}
+
+// statusRequest is the body of the account status endpoints
+type statusRequest struct {
+	Status          string `json:"status,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+	PayoutProfileID int    `json:"payout_profile_id,omitempty"`
+}
+
+// loanRequest is the body of the loan endpoints
+type loanRequest struct {
+	Principal    float64 `json:"principal,omitempty"`
+	TenureMonths int     `json:"tenure_months,omitempty"`
+	Amount       float64 `json:"amount,omitempty"`
+	Mode         string  `json:"mode,omitempty"`
+}
+
+// loanRateRequest is the body of POST /operator/loans/rate and the reply
+// of GET /loans/rate
+type loanRateRequest struct {
+	AnnualRate float64 `json:"annual_rate"`
+}
+
+// alertRequest is the body of POST /accounts/{id}/alerts
+type alertRequest struct {
+	Kind      string  `json:"kind"`
+	Threshold float64 `json:"threshold"`
+	URL       string  `json:"url"`
+	Secret    string  `json:"secret,omitempty"`
+}
+
+// disputeRequest is the body of the dispute endpoints
+type disputeRequest struct {
+	TransactionID int    `json:"transaction_id,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+	Note          string `json:"note,omitempty"`
+	Refund        bool   `json:"refund,omitempty"`
+}
+
+// NewAPIServer creates the HTTP API for a manager. Registration and login
+// are open; customer routes need the bearer token issued by POST /sessions
+// and only reach the profile it was issued for. Back-office routes under
+// /operator need operatorKey instead.
+func NewAPIServer(manager *FinancialManager, operatorKey string) *APIServer {
+	s := &APIServer{manager: manager, mux: http.NewServeMux(), sessions: newSessionStore(), operatorKey: operatorKey}
+	s.mux.HandleFunc("POST /accounts", s.handleRegister)
+	s.mux.HandleFunc("POST /sessions", s.handleLogin)
+	s.mux.HandleFunc("DELETE /sessions", s.requireCustomer(s.handleLogout))
+	s.mux.HandleFunc("GET /accounts/{id}", s.requireCustomer(s.handleBalance))
+	s.mux.HandleFunc("GET /accounts/{id}/balance", s.requireCustomer(s.handleBalance))
+	s.mux.HandleFunc("POST /accounts/{id}/deposit", s.requireCustomer(s.handleDeposit))
+	s.mux.HandleFunc("POST /accounts/{id}/withdraw", s.requireCustomer(s.handleWithdraw))
+	s.mux.HandleFunc("POST /accounts/{id}/transfer", s.requireCustomer(s.handleTransfer))
+	s.mux.HandleFunc("GET /accounts/{id}/history", s.requireCustomer(s.handleHistory))
+	s.mux.HandleFunc("POST /accounts/{id}/reactivate", s.requireCustomer(s.handleReactivate))
+	s.mux.HandleFunc("POST /accounts/{id}/close", s.requireCustomer(s.handleClose))
+	s.mux.HandleFunc("GET /loans/rate", s.handleLoanRate)
+	s.mux.HandleFunc("GET /accounts/{id}/loans", s.requireCustomer(s.handleListLoans))
+	s.mux.HandleFunc("POST /accounts/{id}/loans", s.requireCustomer(s.handleOpenLoan))
+	s.mux.HandleFunc("POST /loans/{loan}/prepay", s.requireCustomer(s.handlePrepayLoan))
+	s.mux.HandleFunc("GET /accounts/{id}/alerts", s.requireCustomer(s.handleListAlerts))
+	s.mux.HandleFunc("POST /accounts/{id}/alerts", s.requireCustomer(s.handleAddAlert))
+	s.mux.HandleFunc("DELETE /accounts/{id}/alerts/{alert}", s.requireCustomer(s.handleRemoveAlert))
+	s.mux.HandleFunc("GET /accounts/{id}/disputes", s.requireCustomer(s.handleListDisputes))
+	s.mux.HandleFunc("POST /accounts/{id}/disputes", s.requireCustomer(s.handleOpenDispute))
+	s.mux.HandleFunc("POST /operator/accounts/{id}/status", s.requireOperator(s.handleStatus))
+	s.mux.HandleFunc("POST /operator/accounts/{id}/transactions/{txn}/reverse", s.requireOperator(s.handleReverse))
+	s.mux.HandleFunc("POST /operator/disputes/{dispute}/review", s.requireOperator(s.handleReviewDispute))
+	s.mux.HandleFunc("POST /operator/disputes/{dispute}/resolve", s.requireOperator(s.handleResolveDispute))
+	s.mux.HandleFunc("POST /operator/loans/rate", s.requireOperator(s.handleSetLoanRate))
+	return s
+}
+
+// ServeHTTP dispatches a request to the matching handler
+func (s *APIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe runs the API on the given address
+func (s *APIServer) ListenAndServe(addr string) error {
+	log.Printf("Bank API listening on %s", addr)
+	return http.ListenAndServe(addr, s)
+}
+
+// writeJSON sends a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError maps a manager error onto an HTTP status and JSON error body
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, ErrProfileNotFound), errors.Is(err, ErrTransactionNotFound), errors.Is(err, ErrDisputeNotFound),
+		errors.Is(err, ErrLoanNotFound), errors.Is(err, ErrAlertRuleNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrProfileExists), errors.Is(err, ErrIdempotencyConflict),
+		errors.Is(err, ErrAccountFrozen), errors.Is(err, ErrAccountDormant), errors.Is(err, ErrAccountClosed):
+		status = http.StatusConflict
+	case errors.Is(err, ErrInsufficientFunds), errors.Is(err, ErrUnsupportedCurrency):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, ErrLoginFailed), errors.Is(err, ErrUnauthenticated):
+		status = http.StatusUnauthorized
+	case errors.Is(err, ErrDebitBlocked), errors.Is(err, ErrForbidden):
+		status = http.StatusForbidden
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// profileIDFromPath reads the {id} path segment
+func profileIDFromPath(r *http.Request) (int, error) {
+	return intFromPath(r, "id", "profile ID")
+}
+
+// intFromPath reads a numeric path segment
+func intFromPath(r *http.Request, name, label string) (int, error) {
+	value, err := strconv.Atoi(r.PathValue(name))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", label, r.PathValue(name))
+	}
+	return value, nil
+}
+
+// decodeBody parses a JSON request body, rejecting unknown fields
+func decodeBody(r *http.Request, target interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return fmt.Errorf("invalid request payload: %v", err)
+	}
+	return nil
+}
+
+// newAccountView converts an account for the response body
+func newAccountView(user *UserAccount) accountView {
+	return accountView{
+		ProfileID:      user.ProfileID,
+		FullName:       user.FullName,
+		AccountType:    user.AccountType,
+		Currency:       user.Currency,
+		Status:         user.Status,
+		Balance:        user.CurrentFunds,
+		AvailableFunds: user.AvailableFunds(),
+		OverdraftLimit: user.OverdraftLimit,
+		InterestRate:   user.InterestRate,
+	}
+}
+
+// newAlertRuleView converts an alert rule for the response body
+func newAlertRuleView(rule *AlertRule) alertRuleView {
+	return alertRuleView{
+		ID:        rule.ID,
+		Kind:      rule.Kind,
+		Threshold: rule.Threshold,
+		URL:       rule.URL,
+	}
+}
+
+// handleRegister creates a new customer account
+func (s *APIServer) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var req registerRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if req.AccountType == "" {
+		req.AccountType = SAVINGS_ACCOUNT
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	user, err := s.manager.RegisterCustomer(req.ProfileID, req.FullName, req.AccountType, req.PIN)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if req.Currency != "" {
+		if err := s.manager.SetCurrency(user.ProfileID, req.Currency); err != nil {
+			s.manager.removeUser(user.ProfileID)
+			writeError(w, err)
+			return
+		}
+	}
+	s.persist()
+	writeJSON(w, http.StatusCreated, newAccountView(user))
+}
+
+// handleBalance returns an account and its balance
+func (s *APIServer) handleBalance(w http.ResponseWriter, r *http.Request) {
+	profileID, err := profileIDFromPath(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	s.manager.ProcessAccruals()
+	user, err := s.manager.LocateUser(profileID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAccountView(user))
+}
+
+// handleDeposit adds funds to an account, converting them when the
+// request gives a currency other than the account's
+func (s *APIServer) handleDeposit(w http.ResponseWriter, r *http.Request) {
+	s.handleOperation(w, r, func(key string, profileID int, req amountRequest) (*OperationResult, error) {
+		if req.Currency != "" {
+			if key != "" {
+				return s.manager.DepositForeignOnce(key, profileID, req.Amount, req.Currency)
+			}
+			return s.manager.resultOf(OP_ADD_FUNDS, profileID, 0, req.Amount, func() error {
+				_, err := s.manager.DepositForeign(profileID, req.Amount, req.Currency)
+				return err
+			})
+		}
+		if key != "" {
+			return s.manager.AddFundsOnce(key, profileID, req.Amount)
+		}
+		return s.manager.resultOf(OP_ADD_FUNDS, profileID, 0, req.Amount, func() error {
+			return s.manager.AddFunds(profileID, req.Amount)
+		})
+	})
+}
+
+// handleWithdraw removes funds from an account
+func (s *APIServer) handleWithdraw(w http.ResponseWriter, r *http.Request) {
+	s.handleOperation(w, r, func(key string, profileID int, req amountRequest) (*OperationResult, error) {
+		if key != "" {
+			return s.manager.RemoveFundsOnce(key, profileID, req.Amount)
+		}
+		return s.manager.resultOf(OP_REMOVE_FUNDS, profileID, 0, req.Amount, func() error {
+			return s.manager.RemoveFunds(profileID, req.Amount)
+		})
+	})
+}
+
+// handleTransfer moves funds to another account
+func (s *APIServer) handleTransfer(w http.ResponseWriter, r *http.Request) {
+	s.handleOperation(w, r, func(key string, profileID int, req amountRequest) (*OperationResult, error) {
+		if key != "" {
+			return s.manager.TransferFundsOnce(key, profileID, req.ToProfileID, req.Amount)
+		}
+		return s.manager.resultOf(OP_TRANSFER, profileID, req.ToProfileID, req.Amount, func() error {
+			return s.manager.TransferFunds(profileID, req.ToProfileID, req.Amount)
+		})
+	})
+}
+
+// handleOperation decodes a money movement request, runs it under the
+// manager lock and writes the outcome
+func (s *APIServer) handleOperation(w http.ResponseWriter, r *http.Request,
+	perform func(key string, profileID int, req amountRequest) (*OperationResult, error)) {
+	profileID, err := profileIDFromPath(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req amountRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	result, err := perform(r.Header.Get(IDEMPOTENCY_HEADER), profileID, req)
+	if err != nil {
+		// Blocked attempts are recorded on the account, so keep them
+		if errors.Is(err, ErrDebitBlocked) {
+			s.persist()
+		}
+		writeError(w, err)
+		return
+	}
+	if !result.Replayed {
+		s.persist()
+	}
+
+	writeJSON(w, http.StatusOK, operationView{
+		ProfileID:      result.ProfileID,
+		Amount:         result.Amount,
+		Balance:        result.Balance,
+		TransactionIDs: result.TransactionIDs,
+		Replayed:       result.Replayed,
+	})
+}
+
+// handleHistory lists an account's transactions. Supported query filters:
+// type, from and to (YYYY-MM-DD, inclusive), min_amount, max_amount
+// (absolute value) and limit (most recent N).
+func (s *APIServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	profileID, err := profileIDFromPath(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	user, err := s.manager.LocateUser(profileID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	history := make([]transactionView, 0)
+	for _, txn := range user.Transactions {
+		if !filter.matches(txn) {
+			continue
+		}
+		view := transactionView{
+			ID:        txn.ID,
+			Type:      txn.Type,
+			Amount:    txn.Amount,
+			Balance:   txn.Balance,
+			Timestamp: txn.Timestamp.Format(time.RFC3339),
+			LinkedID:  txn.LinkedID,
+		}
+		if reversal := user.reversalOf(txn.ID); reversal != nil {
+			view.ReversedBy = reversal.ID
+		}
+		history = append(history, view)
+	}
+	if filter.limit > 0 && len(history) > filter.limit {
+		history = history[len(history)-filter.limit:]
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+// handleReverse posts a compensating entry for a transaction on behalf of
+// the back office
+func (s *APIServer) handleReverse(w http.ResponseWriter, r *http.Request) {
+	profileID, err := profileIDFromPath(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	transactionID, err := intFromPath(r, "txn", "transaction ID")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req disputeRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	if err := s.manager.ReverseTransaction(profileID, transactionID, req.Reason); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.persist()
+
+	user, err := s.manager.LocateUser(profileID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAccountView(user))
+}
+
+// handleStatus freezes or unfreezes an account on behalf of the back office
+func (s *APIServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	s.handleLifecycle(w, r, func(profileID int, req statusRequest) error {
+		return s.manager.SetAccountStatus(profileID, req.Status, req.Reason)
+	})
+}
+
+// handleReactivate wakes a dormant account at its owner's request
+func (s *APIServer) handleReactivate(w http.ResponseWriter, r *http.Request) {
+	s.handleLifecycle(w, r, func(profileID int, req statusRequest) error {
+		return s.manager.ReactivateAccount(profileID, req.Reason)
+	})
+}
+
+// handleClose settles and closes an account
+func (s *APIServer) handleClose(w http.ResponseWriter, r *http.Request) {
+	s.handleLifecycle(w, r, func(profileID int, req statusRequest) error {
+		_, err := s.manager.CloseAccount(profileID, req.PayoutProfileID)
+		return err
+	})
+}
+
+// handleLifecycle decodes a status request, applies it under the manager
+// lock and returns the updated account
+func (s *APIServer) handleLifecycle(w http.ResponseWriter, r *http.Request,
+	apply func(profileID int, req statusRequest) error) {
+	profileID, err := profileIDFromPath(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req statusRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	if err := apply(profileID, req); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.persist()
+
+	user, err := s.manager.LocateUser(profileID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAccountView(user))
+}
+
+// handleListLoans lists the loans linked to an account
+func (s *APIServer) handleListLoans(w http.ResponseWriter, r *http.Request) {
+	profileID, err := profileIDFromPath(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	if _, err := s.manager.LocateUser(profileID); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.manager.LoansFor(profileID))
+}
+
+// handleOpenLoan disburses a loan into an account
+func (s *APIServer) handleOpenLoan(w http.ResponseWriter, r *http.Request) {
+	profileID, err := profileIDFromPath(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req loanRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	loan, err := s.manager.OpenLoan(profileID, req.Principal, req.TenureMonths)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.persist()
+	writeJSON(w, http.StatusCreated, loan)
+}
+
+// handlePrepayLoan pays down a loan early
+func (s *APIServer) handlePrepayLoan(w http.ResponseWriter, r *http.Request) {
+	loanID, err := intFromPath(r, "loan", "loan ID")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req loanRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = PREPAY_REDUCE_EMI
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	profileID := sessionProfile(r)
+	if err := s.manager.PrepayLoan(profileID, loanID, req.Amount, req.Mode); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.persist()
+
+	loan, _, err := s.manager.locateLoan(profileID, loanID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, loan)
+}
+
+// handleLoanRate reports the annual rate new loans are offered at
+func (s *APIServer) handleLoanRate(w http.ResponseWriter, r *http.Request) {
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+	writeJSON(w, http.StatusOK, loanRateRequest{AnnualRate: s.manager.LoanRate()})
+}
+
+// handleSetLoanRate changes the annual rate new loans are offered at
+func (s *APIServer) handleSetLoanRate(w http.ResponseWriter, r *http.Request) {
+	var req loanRateRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	if err := s.manager.SetLoanRate(req.AnnualRate); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.persist()
+	writeJSON(w, http.StatusOK, loanRateRequest{AnnualRate: s.manager.LoanRate()})
+}
+
+// handleListAlerts lists the alert rules of an account
+func (s *APIServer) handleListAlerts(w http.ResponseWriter, r *http.Request) {
+	profileID, err := profileIDFromPath(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	if _, err := s.manager.LocateUser(profileID); err != nil {
+		writeError(w, err)
+		return
+	}
+	rules := make([]alertRuleView, 0)
+	for _, rule := range s.manager.AlertRulesFor(profileID) {
+		rules = append(rules, newAlertRuleView(rule))
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+// handleAddAlert registers a webhook alert on an account
+func (s *APIServer) handleAddAlert(w http.ResponseWriter, r *http.Request) {
+	profileID, err := profileIDFromPath(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req alertRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	rule, err := s.manager.AddAlertRule(profileID, req.Kind, req.Threshold, req.URL, req.Secret)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.persist()
+	writeJSON(w, http.StatusCreated, newAlertView{alertRuleView: newAlertRuleView(rule), Secret: rule.Secret})
+}
+
+// handleRemoveAlert deletes an alert rule
+func (s *APIServer) handleRemoveAlert(w http.ResponseWriter, r *http.Request) {
+	profileID, err := profileIDFromPath(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	ruleID, err := intFromPath(r, "alert", "alert ID")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	if err := s.manager.RemoveAlertRule(profileID, ruleID); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.persist()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListDisputes lists the disputes raised by an account
+func (s *APIServer) handleListDisputes(w http.ResponseWriter, r *http.Request) {
+	profileID, err := profileIDFromPath(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	if _, err := s.manager.LocateUser(profileID); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.manager.DisputesFor(profileID))
+}
+
+// handleOpenDispute raises a dispute against a debit
+func (s *APIServer) handleOpenDispute(w http.ResponseWriter, r *http.Request) {
+	profileID, err := profileIDFromPath(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req disputeRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	dispute, err := s.manager.OpenDispute(profileID, req.TransactionID, req.Reason)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.persist()
+	writeJSON(w, http.StatusCreated, dispute)
+}
+
+// handleReviewDispute moves a dispute under review
+func (s *APIServer) handleReviewDispute(w http.ResponseWriter, r *http.Request) {
+	s.handleDisputeTransition(w, r, func(disputeID int, req disputeRequest) error {
+		return s.manager.ReviewDispute(disputeID, req.Note)
+	})
+}
+
+// handleResolveDispute refunds or rejects a dispute under review
+func (s *APIServer) handleResolveDispute(w http.ResponseWriter, r *http.Request) {
+	s.handleDisputeTransition(w, r, func(disputeID int, req disputeRequest) error {
+		return s.manager.ResolveDispute(disputeID, req.Refund, req.Note)
+	})
+}
+
+// handleDisputeTransition applies a status change and returns the dispute
+func (s *APIServer) handleDisputeTransition(w http.ResponseWriter, r *http.Request,
+	transition func(disputeID int, req disputeRequest) error) {
+	disputeID, err := intFromPath(r, "dispute", "dispute ID")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req disputeRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	if err := transition(disputeID, req); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.persist()
+
+	dispute, _, err := s.manager.locateDispute(disputeID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, dispute)
+}
+
+// historyFilter holds the parsed history query parameters
+type historyFilter struct {
+	recordType string
+	from       time.Time
+	to         time.Time
+	minAmount  float64
+	maxAmount  float64
+	limit      int
+}
+
+// parseHistoryFilter reads the history query parameters
+func parseHistoryFilter(r *http.Request) (historyFilter, error) {
+	query := r.URL.Query()
+	filter := historyFilter{recordType: strings.ToUpper(query.Get("type"))}
+
+	var err error
+	if value := query.Get("from"); value != "" {
+		if filter.from, err = time.ParseInLocation(DATE_FORMAT, value, time.Local); err != nil {
+			return filter, fmt.Errorf("invalid from date %q", value)
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if filter.to, err = time.ParseInLocation(DATE_FORMAT, value, time.Local); err != nil {
+			return filter, fmt.Errorf("invalid to date %q", value)
+		}
+		filter.to = filter.to.AddDate(0, 0, 1)
+	}
+	if value := query.Get("min_amount"); value != "" {
+		if filter.minAmount, err = strconv.ParseFloat(value, 64); err != nil {
+			return filter, fmt.Errorf("invalid min_amount %q", value)
+		}
+	}
+	if value := query.Get("max_amount"); value != "" {
+		if filter.maxAmount, err = strconv.ParseFloat(value, 64); err != nil {
+			return filter, fmt.Errorf("invalid max_amount %q", value)
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if filter.limit, err = strconv.Atoi(value); err != nil || filter.limit < 0 {
+			return filter, fmt.Errorf("invalid limit %q", value)
+		}
+	}
+	return filter, nil
+}
+
+// matches reports whether a transaction passes the filter
+func (f historyFilter) matches(txn Transaction) bool {
+	amount := txn.Amount
+	if amount < 0 {
+		amount = -amount
+	}
+
+	switch {
+	case f.recordType != "" && txn.Type != f.recordType:
+		return false
+	case !f.from.IsZero() && txn.Timestamp.Before(f.from):
+		return false
+	case !f.to.IsZero() && !txn.Timestamp.Before(f.to):
+		return false
+	case f.minAmount > 0 && amount < f.minAmount:
+		return false
+	case f.maxAmount > 0 && amount > f.maxAmount:
+		return false
+	}
+	return true
+}
+
+// persist saves the account data, logging any failure
+func (s *APIServer) persist() {
+	if err := s.manager.Save(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
@@ -0,0 +1,645 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TEST_OPERATOR_KEY is the back-office key of the test server
+const TEST_OPERATOR_KEY = "test-operator-key"
+
+// operatorHeaders authenticate a request as the back office
+var operatorHeaders = map[string]string{OPERATOR_KEY_HEADER: TEST_OPERATOR_KEY}
+
+// newTestAPI starts an API server backed by a fresh manager
+func newTestAPI(t *testing.T) (*httptest.Server, *manualClock) {
+	t.Helper()
+	clock := &manualClock{now: time.Date(2024, 6, 10, 9, 0, 0, 0, time.Local)}
+	manager := InitializeManager()
+	manager.SetClock(clock)
+
+	server := httptest.NewServer(NewAPIServer(manager, TEST_OPERATOR_KEY))
+	t.Cleanup(server.Close)
+	return server, clock
+}
+
+// doJSON sends a request and decodes the JSON response into out
+func doJSON(t *testing.T, method, url string, headers map[string]string, body interface{}, out interface{}) int {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("encode request: %v", err)
+		}
+	}
+
+	req, err := http.NewRequest(method, url, &payload)
+	if err != nil {
+		t.Fatalf("build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("decode response of %s %s: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// registerTestAccount opens an account and returns the headers that
+// authenticate as it
+func registerTestAccount(t *testing.T, baseURL string, profileID int, accountType string) map[string]string {
+	t.Helper()
+	status := doJSON(t, http.MethodPost, baseURL+"/accounts", nil, registerRequest{
+		ProfileID:   profileID,
+		FullName:    "Test Customer",
+		AccountType: accountType,
+		PIN:         "1234",
+	}, nil)
+	if status != http.StatusCreated {
+		t.Fatalf("register %d: got status %d, want %d", profileID, status, http.StatusCreated)
+	}
+	return loginTestAccount(t, baseURL, profileID, "1234")
+}
+
+// loginTestAccount starts an API session and returns its bearer header
+func loginTestAccount(t *testing.T, baseURL string, profileID int, pin string) map[string]string {
+	t.Helper()
+	var session sessionView
+	status := doJSON(t, http.MethodPost, baseURL+"/sessions", nil, loginRequest{ProfileID: profileID, PIN: pin}, &session)
+	if status != http.StatusCreated {
+		t.Fatalf("login %d: got status %d, want %d", profileID, status, http.StatusCreated)
+	}
+	return map[string]string{"Authorization": "Bearer " + session.Token}
+}
+
+func TestAPIRegisterAndBalance(t *testing.T) {
+	server, _ := newTestAPI(t)
+	auth := registerTestAccount(t, server.URL, 101, SAVINGS_ACCOUNT)
+
+	var account accountView
+	status := doJSON(t, http.MethodGet, server.URL+"/accounts/101/balance", auth, nil, &account)
+	if status != http.StatusOK {
+		t.Fatalf("balance: got status %d, want %d", status, http.StatusOK)
+	}
+	if account.ProfileID != 101 || account.Balance != 0 || account.AccountType != SAVINGS_ACCOUNT {
+		t.Errorf("balance: got %+v", account)
+	}
+
+	status = doJSON(t, http.MethodPost, server.URL+"/accounts", nil, registerRequest{
+		ProfileID: 101, FullName: "Duplicate", PIN: "1234",
+	}, nil)
+	if status != http.StatusConflict {
+		t.Errorf("duplicate register: got status %d, want %d", status, http.StatusConflict)
+	}
+
+	status = doJSON(t, http.MethodPost, server.URL+"/accounts", nil, registerRequest{
+		ProfileID: 102, FullName: "Bad PIN", PIN: "12",
+	}, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("invalid PIN: got status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestAPIRequiresSession(t *testing.T) {
+	server, clock := newTestAPI(t)
+	auth := registerTestAccount(t, server.URL, 101, SAVINGS_ACCOUNT)
+	registerTestAccount(t, server.URL, 102, SAVINGS_ACCOUNT)
+
+	requests := []struct {
+		method string
+		path   string
+		body   interface{}
+	}{
+		{http.MethodGet, "/accounts/101/balance", nil},
+		{http.MethodPost, "/accounts/101/withdraw", amountRequest{Amount: 10}},
+		{http.MethodGet, "/accounts/101/history", nil},
+		{http.MethodPost, "/accounts/101/reactivate", statusRequest{}},
+		{http.MethodPost, "/loans/1/prepay", loanRequest{Amount: 10}},
+	}
+	bad := map[string]map[string]string{
+		"no token":      nil,
+		"unknown token": {"Authorization": "Bearer not-a-token"},
+		"wrong scheme":  {"Authorization": "Basic MTAxOjEyMzQ="},
+	}
+	for name, headers := range bad {
+		for _, req := range requests {
+			var body map[string]string
+			status := doJSON(t, req.method, server.URL+req.path, headers, req.body, &body)
+			if status != http.StatusUnauthorized || body["error"] == "" {
+				t.Errorf("%s: %s %s got status %d, want %d", name, req.method, req.path, status, http.StatusUnauthorized)
+			}
+		}
+	}
+
+	// A token only reaches the profile it was issued for
+	status := doJSON(t, http.MethodGet, server.URL+"/accounts/102/balance", auth, nil, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("other profile's balance: got status %d, want %d", status, http.StatusForbidden)
+	}
+	status = doJSON(t, http.MethodPost, server.URL+"/accounts/102/withdraw", auth, amountRequest{Amount: 10}, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("other profile's withdraw: got status %d, want %d", status, http.StatusForbidden)
+	}
+
+	// Tokens expire and can be revoked
+	clock.Advance(API_SESSION_TTL)
+	status = doJSON(t, http.MethodGet, server.URL+"/accounts/101/balance", auth, nil, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("expired token: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+	auth = loginTestAccount(t, server.URL, 101, "1234")
+	if status := doJSON(t, http.MethodDelete, server.URL+"/sessions", auth, nil, nil); status != http.StatusNoContent {
+		t.Errorf("logout: got status %d, want %d", status, http.StatusNoContent)
+	}
+	status = doJSON(t, http.MethodGet, server.URL+"/accounts/101/balance", auth, nil, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("revoked token: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestAPILogin(t *testing.T) {
+	server, _ := newTestAPI(t)
+	registerTestAccount(t, server.URL, 101, SAVINGS_ACCOUNT)
+
+	var wrongPIN, unknown map[string]string
+	status := doJSON(t, http.MethodPost, server.URL+"/sessions", nil, loginRequest{ProfileID: 101, PIN: "9999"}, &wrongPIN)
+	if status != http.StatusUnauthorized {
+		t.Errorf("wrong PIN: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+	status = doJSON(t, http.MethodPost, server.URL+"/sessions", nil, loginRequest{ProfileID: 999, PIN: "1234"}, &unknown)
+	if status != http.StatusUnauthorized {
+		t.Errorf("unknown profile: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+	if wrongPIN["error"] != unknown["error"] {
+		t.Errorf("login errors differ (%q, %q); they should not reveal which profiles exist", wrongPIN["error"], unknown["error"])
+	}
+
+	// The lockout applies to API logins too
+	for i := 1; i < MAX_LOGIN_ATTEMPTS; i++ {
+		doJSON(t, http.MethodPost, server.URL+"/sessions", nil, loginRequest{ProfileID: 101, PIN: "9999"}, nil)
+	}
+	status = doJSON(t, http.MethodPost, server.URL+"/sessions", nil, loginRequest{ProfileID: 101, PIN: "1234"}, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("login while locked: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestAPIProfileNotFound(t *testing.T) {
+	server, _ := newTestAPI(t)
+	auth := registerTestAccount(t, server.URL, 101, SAVINGS_ACCOUNT)
+	doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", auth, amountRequest{Amount: 100}, nil)
+
+	var body map[string]string
+	status := doJSON(t, http.MethodPost, server.URL+"/accounts/101/transfer", auth, amountRequest{Amount: 10, ToProfileID: 999}, &body)
+	if status != http.StatusNotFound {
+		t.Errorf("transfer: got status %d, want %d", status, http.StatusNotFound)
+	}
+	if body["error"] == "" {
+		t.Errorf("transfer: expected an error message")
+	}
+
+	status = doJSON(t, http.MethodPost, server.URL+"/loans/999/prepay", auth, loanRequest{Amount: 10}, nil)
+	if status != http.StatusNotFound {
+		t.Errorf("prepay: got status %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestAPIDepositAndWithdraw(t *testing.T) {
+	server, _ := newTestAPI(t)
+	auth := registerTestAccount(t, server.URL, 101, SAVINGS_ACCOUNT)
+
+	var result operationView
+	status := doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", auth, amountRequest{Amount: 1000}, &result)
+	if status != http.StatusOK || result.Balance != 1000 {
+		t.Fatalf("deposit: got status %d, result %+v", status, result)
+	}
+
+	status = doJSON(t, http.MethodPost, server.URL+"/accounts/101/withdraw", auth, amountRequest{Amount: 400}, &result)
+	if status != http.StatusOK || result.Balance != 600 {
+		t.Fatalf("withdraw: got status %d, result %+v", status, result)
+	}
+
+	status = doJSON(t, http.MethodPost, server.URL+"/accounts/101/withdraw", auth, amountRequest{Amount: 601}, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("overdrawn withdraw: got status %d, want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	status = doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", auth, amountRequest{Amount: -5}, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("negative deposit: got status %d, want %d", status, http.StatusBadRequest)
+	}
+
+	status = doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", auth, map[string]string{"amount": "ten"}, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("malformed deposit: got status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+// withHeader returns a copy of headers with one more header set
+func withHeader(headers map[string]string, name, value string) map[string]string {
+	combined := map[string]string{name: value}
+	for key, existing := range headers {
+		combined[key] = existing
+	}
+	return combined
+}
+
+func TestAPIIdempotentDeposit(t *testing.T) {
+	server, _ := newTestAPI(t)
+	auth := registerTestAccount(t, server.URL, 101, SAVINGS_ACCOUNT)
+	headers := withHeader(auth, IDEMPOTENCY_HEADER, "deposit-1")
+
+	var first, second operationView
+	doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", headers, amountRequest{Amount: 250}, &first)
+	doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", headers, amountRequest{Amount: 250}, &second)
+
+	if first.Replayed || !second.Replayed {
+		t.Errorf("replayed flags: first %v, second %v", first.Replayed, second.Replayed)
+	}
+	if second.Balance != 250 {
+		t.Errorf("replayed balance: got %.2f, want 250", second.Balance)
+	}
+
+	var account accountView
+	doJSON(t, http.MethodGet, server.URL+"/accounts/101/balance", auth, nil, &account)
+	if account.Balance != 250 {
+		t.Errorf("balance after retry: got %.2f, want 250", account.Balance)
+	}
+
+	status := doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", headers, amountRequest{Amount: 300}, nil)
+	if status != http.StatusConflict {
+		t.Errorf("key reuse: got status %d, want %d", status, http.StatusConflict)
+	}
+}
+
+func TestAPIIdempotencyKeysScopedByProfile(t *testing.T) {
+	server, _ := newTestAPI(t)
+	first := registerTestAccount(t, server.URL, 101, SAVINGS_ACCOUNT)
+	second := registerTestAccount(t, server.URL, 102, SAVINGS_ACCOUNT)
+
+	var result operationView
+	doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", withHeader(first, IDEMPOTENCY_HEADER, "payday"), amountRequest{Amount: 250}, nil)
+	status := doJSON(t, http.MethodPost, server.URL+"/accounts/102/deposit", withHeader(second, IDEMPOTENCY_HEADER, "payday"), amountRequest{Amount: 400}, &result)
+	if status != http.StatusOK || result.Replayed || result.Balance != 400 {
+		t.Errorf("same key on another profile: status %d, replayed %v, balance %.2f; want a fresh deposit of 400",
+			status, result.Replayed, result.Balance)
+	}
+
+	reserved := withHeader(first, IDEMPOTENCY_HEADER, INTERNAL_KEY_PREFIX+"scheduled-1-1")
+	status = doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", reserved, amountRequest{Amount: 10}, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("reserved key: got status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestAPIBlockedWithdrawal(t *testing.T) {
+	server, _ := newTestAPI(t)
+	auth := registerTestAccount(t, server.URL, 101, SAVINGS_ACCOUNT)
+	doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", auth, amountRequest{Amount: 90000}, nil)
+
+	status := doJSON(t, http.MethodPost, server.URL+"/accounts/101/withdraw", auth, amountRequest{Amount: MAX_WITHDRAWAL_PER_TXN + 1}, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("blocked withdraw: got status %d, want %d", status, http.StatusForbidden)
+	}
+}
+
+func TestAPITransfer(t *testing.T) {
+	server, _ := newTestAPI(t)
+	sender := registerTestAccount(t, server.URL, 101, SAVINGS_ACCOUNT)
+	recipient := registerTestAccount(t, server.URL, 102, CURRENT_ACCOUNT)
+	doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", sender, amountRequest{Amount: 500}, nil)
+
+	var result operationView
+	status := doJSON(t, http.MethodPost, server.URL+"/accounts/101/transfer", sender, amountRequest{Amount: 200, ToProfileID: 102}, &result)
+	if status != http.StatusOK || result.Balance != 300 {
+		t.Fatalf("transfer: got status %d, result %+v", status, result)
+	}
+
+	var account accountView
+	doJSON(t, http.MethodGet, server.URL+"/accounts/102/balance", recipient, nil, &account)
+	if account.Balance != 200 {
+		t.Errorf("recipient balance: got %.2f, want 200", account.Balance)
+	}
+}
+
+func TestAPIHistoryFilters(t *testing.T) {
+	server, clock := newTestAPI(t)
+	auth := registerTestAccount(t, server.URL, 101, SAVINGS_ACCOUNT)
+
+	doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", auth, amountRequest{Amount: 1000}, nil)
+	clock.Advance(24 * time.Hour)
+	auth = loginTestAccount(t, server.URL, 101, "1234")
+	doJSON(t, http.MethodPost, server.URL+"/accounts/101/withdraw", auth, amountRequest{Amount: 100}, nil)
+	clock.Advance(24 * time.Hour)
+	auth = loginTestAccount(t, server.URL, 101, "1234")
+	doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", auth, amountRequest{Amount: 50}, nil)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"all", "", []string{ADD_FUNDS_TYPE, REMOVE_FUNDS_TYPE, ADD_FUNDS_TYPE}},
+		{"by type", "?type=add_funds", []string{ADD_FUNDS_TYPE, ADD_FUNDS_TYPE}},
+		{"by date", "?from=2024-06-11&to=2024-06-11", []string{REMOVE_FUNDS_TYPE}},
+		{"by amount", "?min_amount=100", []string{ADD_FUNDS_TYPE, REMOVE_FUNDS_TYPE}},
+		{"limit", "?limit=1", []string{ADD_FUNDS_TYPE}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var history []transactionView
+			status := doJSON(t, http.MethodGet, server.URL+"/accounts/101/history"+tc.query, auth, nil, &history)
+			if status != http.StatusOK {
+				t.Fatalf("got status %d, want %d", status, http.StatusOK)
+			}
+			if len(history) != len(tc.want) {
+				t.Fatalf("got %d transactions, want %d: %+v", len(history), len(tc.want), history)
+			}
+			for i, txn := range history {
+				if txn.Type != tc.want[i] {
+					t.Errorf("transaction %d: got type %s, want %s", i, txn.Type, tc.want[i])
+				}
+			}
+		})
+	}
+
+	status := doJSON(t, http.MethodGet, server.URL+"/accounts/101/history?from=yesterday", auth, nil, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("invalid filter: got status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestAPIBackOfficeNeedsOperatorKey(t *testing.T) {
+	server, _ := newTestAPI(t)
+	auth := registerTestAccount(t, server.URL, 101, SAVINGS_ACCOUNT)
+	var deposit operationView
+	doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", auth, amountRequest{Amount: 500}, &deposit)
+	reversePath := fmt.Sprintf("/operator/accounts/101/transactions/%d/reverse", deposit.TransactionIDs[0])
+
+	// Customers cannot reach the back office, by either route
+	status := doJSON(t, http.MethodPost, server.URL+reversePath, auth, disputeRequest{Reason: "mine"}, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("customer reversal: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+	status = doJSON(t, http.MethodPost, fmt.Sprintf("%s/accounts/101/transactions/%d/reverse", server.URL, deposit.TransactionIDs[0]), auth, disputeRequest{}, nil)
+	if status != http.StatusNotFound && status != http.StatusMethodNotAllowed {
+		t.Errorf("old customer reversal route: got status %d, want it gone", status)
+	}
+	wrongKey := map[string]string{OPERATOR_KEY_HEADER: "guess"}
+	status = doJSON(t, http.MethodPost, server.URL+reversePath, wrongKey, disputeRequest{}, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("wrong operator key: got status %d, want %d", status, http.StatusForbidden)
+	}
+
+	var account accountView
+	status = doJSON(t, http.MethodPost, server.URL+reversePath, operatorHeaders, disputeRequest{Reason: "duplicate"}, &account)
+	if status != http.StatusOK || account.Balance != 0 {
+		t.Errorf("operator reversal: got status %d, balance %.2f; want 200 and 0", status, account.Balance)
+	}
+}
+
+func TestAPIDisputeLifecycle(t *testing.T) {
+	server, _ := newTestAPI(t)
+	auth := registerTestAccount(t, server.URL, 101, SAVINGS_ACCOUNT)
+	doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", auth, amountRequest{Amount: 500}, nil)
+	var withdrawal operationView
+	doJSON(t, http.MethodPost, server.URL+"/accounts/101/withdraw", auth, amountRequest{Amount: 200}, &withdrawal)
+
+	var dispute Dispute
+	status := doJSON(t, http.MethodPost, server.URL+"/accounts/101/disputes", auth,
+		disputeRequest{TransactionID: withdrawal.TransactionIDs[0], Reason: "not me"}, &dispute)
+	if status != http.StatusCreated || dispute.Status != DISPUTE_OPENED {
+		t.Fatalf("open dispute: got status %d, dispute %+v", status, dispute)
+	}
+	var account accountView
+	doJSON(t, http.MethodGet, server.URL+"/accounts/101/balance", auth, nil, &account)
+	if account.Balance != 500 {
+		t.Errorf("balance with provisional credit: got %.2f, want 500", account.Balance)
+	}
+
+	reviewPath := fmt.Sprintf("%s/operator/disputes/%d/review", server.URL, dispute.ID)
+	resolvePath := fmt.Sprintf("%s/operator/disputes/%d/resolve", server.URL, dispute.ID)
+	if status := doJSON(t, http.MethodPost, reviewPath, auth, disputeRequest{}, nil); status != http.StatusUnauthorized {
+		t.Errorf("customer review: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status := doJSON(t, http.MethodPost, resolvePath, operatorHeaders, disputeRequest{Refund: true}, nil); status != http.StatusBadRequest {
+		t.Errorf("resolve before review: got status %d, want %d", status, http.StatusBadRequest)
+	}
+	if status := doJSON(t, http.MethodPost, reviewPath, operatorHeaders, disputeRequest{Note: "checking"}, &dispute); status != http.StatusOK || dispute.Status != DISPUTE_UNDER_REVIEW {
+		t.Fatalf("review: got status %d, dispute %+v", status, dispute)
+	}
+	if status := doJSON(t, http.MethodPost, resolvePath, operatorHeaders, disputeRequest{Note: "card skimmed"}, &dispute); status != http.StatusOK || dispute.Status != DISPUTE_REJECTED {
+		t.Fatalf("reject: got status %d, dispute %+v", status, dispute)
+	}
+
+	var disputes []Dispute
+	doJSON(t, http.MethodGet, server.URL+"/accounts/101/disputes", auth, nil, &disputes)
+	if len(disputes) != 1 || disputes[0].Status != DISPUTE_REJECTED {
+		t.Errorf("disputes: got %+v", disputes)
+	}
+	doJSON(t, http.MethodGet, server.URL+"/accounts/101/balance", auth, nil, &account)
+	if account.Balance != 300 {
+		t.Errorf("balance after rejection: got %.2f, want 300", account.Balance)
+	}
+}
+
+func TestAPIAccountStatus(t *testing.T) {
+	server, clock := newTestAPI(t)
+	auth := registerTestAccount(t, server.URL, 101, SAVINGS_ACCOUNT)
+	doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", auth, amountRequest{Amount: 500}, nil)
+	statusPath := server.URL + "/operator/accounts/101/status"
+	reactivatePath := server.URL + "/accounts/101/reactivate"
+
+	// Only the back office sets or lifts a freeze
+	status := doJSON(t, http.MethodPost, server.URL+"/accounts/101/status", auth, statusRequest{Status: STATUS_FROZEN}, nil)
+	if status != http.StatusNotFound && status != http.StatusMethodNotAllowed {
+		t.Errorf("old customer status route: got status %d, want it gone", status)
+	}
+	if status := doJSON(t, http.MethodPost, statusPath, auth, statusRequest{Status: STATUS_FROZEN}, nil); status != http.StatusUnauthorized {
+		t.Errorf("customer freeze: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status := doJSON(t, http.MethodPost, reactivatePath, auth, statusRequest{}, nil); status != http.StatusBadRequest {
+		t.Errorf("reactivate an active account: got status %d, want %d", status, http.StatusBadRequest)
+	}
+
+	var account accountView
+	status = doJSON(t, http.MethodPost, statusPath, operatorHeaders, statusRequest{Status: STATUS_FROZEN, Reason: "fraud check"}, &account)
+	if status != http.StatusOK || account.Status != STATUS_FROZEN {
+		t.Fatalf("operator freeze: got status %d, account %+v", status, account)
+	}
+	if status := doJSON(t, http.MethodPost, reactivatePath, auth, statusRequest{}, nil); status != http.StatusConflict {
+		t.Errorf("customer lifting a freeze: got status %d, want %d", status, http.StatusConflict)
+	}
+	if status := doJSON(t, http.MethodPost, server.URL+"/accounts/101/withdraw", auth, amountRequest{Amount: 10}, nil); status != http.StatusConflict {
+		t.Errorf("withdraw while frozen: got status %d, want %d", status, http.StatusConflict)
+	}
+	status = doJSON(t, http.MethodPost, statusPath, operatorHeaders, statusRequest{Status: STATUS_ACTIVE, Reason: "cleared"}, &account)
+	if status != http.StatusOK || account.Status != STATUS_ACTIVE {
+		t.Fatalf("operator unfreeze: got status %d, account %+v", status, account)
+	}
+
+	// A customer can wake their own dormant account
+	clock.Advance(DORMANCY_PERIOD)
+	auth = loginTestAccount(t, server.URL, 101, "1234")
+	if status := doJSON(t, http.MethodPost, server.URL+"/accounts/101/withdraw", auth, amountRequest{Amount: 10}, nil); status != http.StatusConflict {
+		t.Errorf("withdraw while dormant: got status %d, want %d", status, http.StatusConflict)
+	}
+	status = doJSON(t, http.MethodPost, reactivatePath, auth, statusRequest{Reason: "back from abroad"}, &account)
+	if status != http.StatusOK || account.Status != STATUS_ACTIVE {
+		t.Fatalf("reactivate a dormant account: got status %d, account %+v", status, account)
+	}
+	if status := doJSON(t, http.MethodPost, server.URL+"/accounts/101/withdraw", auth, amountRequest{Amount: 10}, nil); status != http.StatusOK {
+		t.Errorf("withdraw after reactivation: got status %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestAPICloseAccount(t *testing.T) {
+	server, _ := newTestAPI(t)
+	auth := registerTestAccount(t, server.URL, 101, SAVINGS_ACCOUNT)
+	payeeAuth := registerTestAccount(t, server.URL, 102, SAVINGS_ACCOUNT)
+	doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", auth, amountRequest{Amount: 750}, nil)
+
+	if status := doJSON(t, http.MethodPost, server.URL+"/accounts/102/close", auth, statusRequest{}, nil); status != http.StatusForbidden {
+		t.Errorf("closing another profile: got status %d, want %d", status, http.StatusForbidden)
+	}
+
+	var account accountView
+	status := doJSON(t, http.MethodPost, server.URL+"/accounts/101/close", auth, statusRequest{PayoutProfileID: 102}, &account)
+	if status != http.StatusOK || account.Status != STATUS_CLOSED || account.Balance != 0 {
+		t.Fatalf("close: got status %d, account %+v", status, account)
+	}
+	doJSON(t, http.MethodGet, server.URL+"/accounts/102/balance", payeeAuth, nil, &account)
+	if account.Balance != 750 {
+		t.Errorf("payee balance: got %.2f, want 750", account.Balance)
+	}
+
+	if status := doJSON(t, http.MethodPost, server.URL+"/accounts/101/deposit", auth, amountRequest{Amount: 10}, nil); status != http.StatusConflict {
+		t.Errorf("deposit to a closed account: got status %d, want %d", status, http.StatusConflict)
+	}
+	if status := doJSON(t, http.MethodPost, server.URL+"/accounts/101/close", auth, statusRequest{}, nil); status != http.StatusBadRequest {
+		t.Errorf("closing twice: got status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestAPILoans(t *testing.T) {
+	server, _ := newTestAPI(t)
+	auth := registerTestAccount(t, server.URL, 101, CURRENT_ACCOUNT)
+	otherAuth := registerTestAccount(t, server.URL, 102, CURRENT_ACCOUNT)
+
+	status := doJSON(t, http.MethodPost, server.URL+"/accounts/101/loans", auth,
+		loanRequest{Principal: 12000, TenureMonths: MAX_LOAN_TENURE + 1}, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("tenure too long: got status %d, want %d", status, http.StatusBadRequest)
+	}
+
+	// The borrower cannot choose the rate; only the back office sets it
+	status = doJSON(t, http.MethodPost, server.URL+"/accounts/101/loans", auth,
+		map[string]interface{}{"principal": 12000, "annual_rate": 0, "tenure_months": 12}, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("borrower-chosen rate: got status %d, want %d", status, http.StatusBadRequest)
+	}
+	if status := doJSON(t, http.MethodPost, server.URL+"/operator/loans/rate", auth, loanRateRequest{AnnualRate: 0}, nil); status != http.StatusUnauthorized {
+		t.Errorf("customer setting the loan rate: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status := doJSON(t, http.MethodPost, server.URL+"/operator/loans/rate", operatorHeaders, loanRateRequest{AnnualRate: 0}, nil); status != http.StatusOK {
+		t.Fatalf("operator setting the loan rate: got status %d", status)
+	}
+	var offer loanRateRequest
+	if status := doJSON(t, http.MethodGet, server.URL+"/loans/rate", nil, nil, &offer); status != http.StatusOK || offer.AnnualRate != 0 {
+		t.Errorf("loan rate: got status %d, %+v", status, offer)
+	}
+
+	var loan Loan
+	status = doJSON(t, http.MethodPost, server.URL+"/accounts/101/loans", auth,
+		loanRequest{Principal: 12000, TenureMonths: 12}, &loan)
+	if status != http.StatusCreated || loan.AnnualRate != 0 || loan.EMI != 1000 || len(loan.Schedule) != 12 {
+		t.Fatalf("open loan: got status %d, loan %+v", status, loan)
+	}
+	var account accountView
+	doJSON(t, http.MethodGet, server.URL+"/accounts/101/balance", auth, nil, &account)
+	if account.Balance != 12000 {
+		t.Errorf("balance after disbursal: got %.2f, want 12000", account.Balance)
+	}
+
+	var loans []Loan
+	doJSON(t, http.MethodGet, server.URL+"/accounts/101/loans", auth, nil, &loans)
+	if len(loans) != 1 || loans[0].ID != loan.ID {
+		t.Errorf("loans: got %+v", loans)
+	}
+	doJSON(t, http.MethodGet, server.URL+"/accounts/102/loans", otherAuth, nil, &loans)
+	if len(loans) != 0 {
+		t.Errorf("other profile's loans: got %+v", loans)
+	}
+
+	prepayPath := fmt.Sprintf("%s/loans/%d/prepay", server.URL, loan.ID)
+	if status := doJSON(t, http.MethodPost, prepayPath, otherAuth, loanRequest{Amount: 2000}, nil); status != http.StatusNotFound {
+		t.Errorf("prepaying another profile's loan: got status %d, want %d", status, http.StatusNotFound)
+	}
+	status = doJSON(t, http.MethodPost, prepayPath, auth, loanRequest{Amount: 2000, Mode: PREPAY_REDUCE_TENURE}, &loan)
+	if status != http.StatusOK || loan.Outstanding != 10000 || loan.EMI != 1000 || len(loan.Schedule) != 10 {
+		t.Errorf("prepay: got status %d, loan %+v", status, loan)
+	}
+}
+
+func TestAPIAlerts(t *testing.T) {
+	server, _ := newTestAPI(t)
+	auth := registerTestAccount(t, server.URL, 101, SAVINGS_ACCOUNT)
+	otherAuth := registerTestAccount(t, server.URL, 102, SAVINGS_ACCOUNT)
+
+	status := doJSON(t, http.MethodPost, server.URL+"/accounts/101/alerts", auth,
+		alertRequest{Kind: ALERT_LOW_BALANCE, Threshold: 100, URL: "ftp://example.com/hook"}, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("non-HTTP webhook: got status %d, want %d", status, http.StatusBadRequest)
+	}
+
+	var rule newAlertView
+	status = doJSON(t, http.MethodPost, server.URL+"/accounts/101/alerts", auth,
+		alertRequest{Kind: "large_debit", Threshold: 5000, URL: "https://example.com/hook"}, &rule)
+	if status != http.StatusCreated || rule.Kind != ALERT_LARGE_DEBIT || rule.Threshold != 5000 {
+		t.Fatalf("add alert: got status %d, rule %+v", status, rule)
+	}
+	if len(rule.Secret) != 2*ALERT_SECRET_BYTES {
+		t.Errorf("generated secret %q was not returned on creation", rule.Secret)
+	}
+
+	// The secret is not shown again
+	var rules []map[string]interface{}
+	doJSON(t, http.MethodGet, server.URL+"/accounts/101/alerts", auth, nil, &rules)
+	if len(rules) != 1 || rules[0]["id"] != float64(rule.ID) {
+		t.Errorf("alerts: got %+v", rules)
+	}
+	for _, listed := range rules {
+		if _, ok := listed["secret"]; ok {
+			t.Errorf("alert list exposes the secret: %+v", listed)
+		}
+	}
+
+	alertPath := fmt.Sprintf("%s/accounts/%%d/alerts/%d", server.URL, rule.ID)
+	if status := doJSON(t, http.MethodDelete, fmt.Sprintf(alertPath, 102), otherAuth, nil, nil); status != http.StatusNotFound {
+		t.Errorf("removing another profile's alert: got status %d, want %d", status, http.StatusNotFound)
+	}
+	if status := doJSON(t, http.MethodDelete, fmt.Sprintf(alertPath, 101), auth, nil, nil); status != http.StatusNoContent {
+		t.Errorf("remove alert: got status %d, want %d", status, http.StatusNoContent)
+	}
+	doJSON(t, http.MethodGet, server.URL+"/accounts/101/alerts", auth, nil, &rules)
+	if len(rules) != 0 {
+		t.Errorf("alerts after removal: got %+v", rules)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Authentication settings
+const (
+	MIN_PIN_LENGTH     = 4
+	MAX_PIN_LENGTH     = 6
+	PIN_HASH_COST      = bcrypt.DefaultCost
+	MAX_LOGIN_ATTEMPTS = 3
+	LOCKOUT_DURATION   = 15 * time.Minute
+)
+
+// Session tracks the currently logged-in user of the menu
+type Session struct {
+	User      *UserAccount
+	StartedAt time.Time
+}
+
+// validatePIN checks that a PIN is made only of digits and has a valid length
+func validatePIN(pin string) error {
+	if len(pin) < MIN_PIN_LENGTH || len(pin) > MAX_PIN_LENGTH {
+		return fmt.Errorf("PIN must be %d to %d digits long", MIN_PIN_LENGTH, MAX_PIN_LENGTH)
+	}
+	for _, ch := range pin {
+		if ch < '0' || ch > '9' {
+			return errors.New("PIN must contain digits only")
+		}
+	}
+	return nil
+}
+
+// hashPIN derives a bcrypt hash of a PIN. bcrypt generates and embeds a
+// random salt, so equal PINs never share a hash.
+func hashPIN(pin string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), PIN_HASH_COST)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash PIN: %v", err)
+	}
+	return string(hash), nil
+}
+
+// checkPIN reports whether a PIN matches the user's stored hash
+func checkPIN(user *UserAccount, pin string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(user.PINHash), []byte(pin)) == nil
+}
+
+// SetPIN stores a bcrypt hash of a new PIN on a user account
+func (fm *FinancialManager) SetPIN(profileID int, pin string) error {
+	if err := validatePIN(pin); err != nil {
+		return err
+	}
+
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return err
+	}
+
+	hash, err := hashPIN(pin)
+	if err != nil {
+		return err
+	}
+
+	user.PINHash = hash
+	user.FailedLogins = 0
+	user.LockedUntil = time.Time{}
+	return nil
+}
+
+// RegisterCustomer creates a new user account of the given product protected by a PIN
+func (fm *FinancialManager) RegisterCustomer(profileID int, fullName string, accountType string, pin string) (*UserAccount, error) {
+	if fullName == "" {
+		return nil, errors.New("full name cannot be empty")
+	}
+	if err := validatePIN(pin); err != nil {
+		return nil, err
+	}
+
+	user, err := fm.RegisterUser(profileID, fullName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fm.SetAccountType(profileID, accountType); err != nil {
+		fm.removeUser(profileID)
+		return nil, err
+	}
+	if err := fm.SetPIN(profileID, pin); err != nil {
+		fm.removeUser(profileID)
+		return nil, err
+	}
+	return user, nil
+}
+
+// Authenticate verifies a PIN and starts a session for the user
+func (fm *FinancialManager) Authenticate(profileID int, pin string) (*UserAccount, error) {
+	user, err := fm.VerifyPIN(profileID, pin)
+	if err != nil {
+		return nil, err
+	}
+	fm.session = &Session{User: user, StartedAt: fm.clock.Now()}
+	return user, nil
+}
+
+// VerifyPIN checks a PIN against the account, counting failures towards a
+// lockout, without starting a menu session
+func (fm *FinancialManager) VerifyPIN(profileID int, pin string) (*UserAccount, error) {
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := fm.clock.Now()
+	if now.Before(user.LockedUntil) {
+		return nil, fmt.Errorf("profile %d is locked until %s", profileID, user.LockedUntil.Format(TIMESTAMP_FORMAT))
+	}
+
+	if user.PINHash == "" {
+		return nil, fmt.Errorf("profile %d has no PIN set", profileID)
+	}
+
+	if !checkPIN(user, pin) {
+		user.FailedLogins++
+		if user.FailedLogins >= MAX_LOGIN_ATTEMPTS {
+			user.FailedLogins = 0
+			user.LockedUntil = now.Add(LOCKOUT_DURATION)
+			return nil, fmt.Errorf("too many failed attempts. Profile %d locked for %v", profileID, LOCKOUT_DURATION)
+		}
+		return nil, fmt.Errorf("incorrect PIN. %d attempt(s) remaining", MAX_LOGIN_ATTEMPTS-user.FailedLogins)
+	}
+
+	user.FailedLogins = 0
+	user.LockedUntil = time.Time{}
+	return user, nil
+}
+
+// Logout ends the current session
+func (fm *FinancialManager) Logout() {
+	fm.session = nil
+}
+
+// CurrentUser returns the logged-in user, if any
+func (fm *FinancialManager) CurrentUser() (*UserAccount, error) {
+	if fm.session == nil {
+		return nil, errors.New("no user is logged in")
+	}
+	return fm.session.User, nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPINHashedWithBcrypt(t *testing.T) {
+	manager := InitializeManager()
+	manager.SetClock(&manualClock{now: time.Date(2024, 6, 10, 9, 0, 0, 0, time.Local)})
+	first, err := manager.RegisterCustomer(1, "First", SAVINGS_ACCOUNT, "1234")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	second, err := manager.RegisterCustomer(2, "Second", SAVINGS_ACCOUNT, "1234")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	if !strings.HasPrefix(first.PINHash, "$2") || first.PINHash == second.PINHash {
+		t.Fatalf("hashes %q and %q; want distinct bcrypt hashes", first.PINHash, second.PINHash)
+	}
+	if _, err := manager.Authenticate(1, "9999"); err == nil {
+		t.Error("wrong PIN accepted")
+	}
+	if _, err := manager.Authenticate(1, "1234"); err != nil {
+		t.Errorf("right PIN rejected: %v", err)
+	}
+}
@@ -0,0 +1,876 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Batch script formats
+const (
+	BATCH_FORMAT_LINES = "lines"
+	BATCH_FORMAT_CSV   = "csv"
+)
+
+// BATCH_DEFAULT_PIN is used when a batch register command gives no PIN
+const BATCH_DEFAULT_PIN = "0000"
+
+// BATCH_EXPECT_FAILURE prefixes a command that is expected to fail
+const BATCH_EXPECT_FAILURE = "!"
+
+// batchEpoch is the clock's starting point, so runs are reproducible
+var batchEpoch = time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+
+// BatchResult is the outcome of one script line
+type BatchResult struct {
+	Line    int
+	Command string
+	Message string
+	Err     error
+}
+
+// BatchReport summarises a batch run
+type BatchReport struct {
+	Results   []BatchResult
+	Succeeded int
+	Failed    int
+}
+
+// batchRunner executes script commands against a manager
+type batchRunner struct {
+	manager *FinancialManager
+	clock   *manualClock
+}
+
+// batchCommand describes a script command and how to run it
+type batchCommand struct {
+	usage   string
+	minArgs int
+	run     func(b *batchRunner, args []string) (string, error)
+}
+
+// batchCommands lists the customer commands a script may use
+var batchCommands = map[string]batchCommand{
+	"register":       {"register <id> <name> [SAVINGS|CURRENT] [pin] [currency]", 2, (*batchRunner).register},
+	"deposit":        {"deposit <id> <amount> [idempotency-key]", 2, (*batchRunner).deposit},
+	"deposit-fx":     {"deposit-fx <id> <amount> <currency> [idempotency-key]", 3, (*batchRunner).depositForeign},
+	"rates":          {"rates <rates-file>", 1, (*batchRunner).loadRates},
+	"withdraw":       {"withdraw <id> <amount> [idempotency-key]", 2, (*batchRunner).withdraw},
+	"transfer":       {"transfer <from-id> <to-id> <amount> [idempotency-key]", 3, (*batchRunner).transfer},
+	"balance":        {"balance <id> [expected]", 1, (*batchRunner).balance},
+	"reactivate":     {"reactivate <id> [reason]", 1, (*batchRunner).reactivate},
+	"close":          {"close <id> [payout-id]", 1, (*batchRunner).close},
+	"status":         {"status <id> [expected]", 1, (*batchRunner).status},
+	"loan":           {"loan <id> <principal> <months>", 3, (*batchRunner).loan},
+	"prepay":         {"prepay <id> <loan-id> <amount> [REDUCE_EMI|REDUCE_TENURE]", 3, (*batchRunner).prepay},
+	"run-loans":      {"run-loans", 0, (*batchRunner).runLoans},
+	"loan-status":    {"loan-status <id> <loan-id> [expected-outstanding] [expected-arrears]", 2, (*batchRunner).loanStatus},
+	"alert":          {"alert <id> <LOW_BALANCE|LARGE_DEBIT> <threshold> <url> [secret]", 4, (*batchRunner).alert},
+	"overdraft":      {"overdraft <id> <limit>", 2, (*batchRunner).overdraft},
+	"rate":           {"rate <id> <annual-percent>", 2, (*batchRunner).rate},
+	"schedule":       {"schedule <id> <ADD_FUNDS|REMOVE_FUNDS> <amount> <frequency> <start-date> [end-date]", 5, (*batchRunner).schedule},
+	"run-scheduled":  {"run-scheduled", 0, (*batchRunner).runScheduled},
+	"reconcile":      {"reconcile", 0, (*batchRunner).reconcile},
+	"dispute":        {"dispute <id> <transaction-id> <reason>", 3, (*batchRunner).dispute},
+	"dispute-status": {"dispute-status <dispute-id> [expected]", 1, (*batchRunner).disputeStatus},
+	"clock":          {"clock <YYYY-MM-DD> [HH:MM:SS]", 1, (*batchRunner).setClock},
+	"advance":        {"advance <days>d | advance <duration>", 1, (*batchRunner).advance},
+}
+
+// BATCH_OPERATOR_PREFIX starts a back-office command, keeping corrections
+// apart from what a customer can do
+const BATCH_OPERATOR_PREFIX = "operator"
+
+// operatorBatchCommands lists the back-office commands, each run as
+// "operator <command> ..."
+var operatorBatchCommands = map[string]batchCommand{
+	"freeze":          {"operator freeze <id> [reason]", 1, (*batchRunner).freeze},
+	"unfreeze":        {"operator unfreeze <id> [reason]", 1, (*batchRunner).unfreeze},
+	"reverse":         {"operator reverse <id> <transaction-id> [reason]", 2, (*batchRunner).reverse},
+	"review-dispute":  {"operator review-dispute <dispute-id> [note]", 1, (*batchRunner).reviewDispute},
+	"resolve-dispute": {"operator resolve-dispute <dispute-id> <REFUND|REJECT> [note]", 2, (*batchRunner).resolveDispute},
+	"loan-rate":       {"operator loan-rate <annual-percent>", 1, (*batchRunner).loanRate},
+}
+
+// RunBatch executes a script of operations, one per line or CSV record,
+// writing a result line for each and the final balances to out. The
+// manager's clock is replaced by one that starts at a fixed time and only
+// moves with the clock and advance commands.
+func (fm *FinancialManager) RunBatch(script io.Reader, format string, out io.Writer) (*BatchReport, error) {
+	records, err := readBatchScript(script, format)
+	if err != nil {
+		return nil, err
+	}
+
+	runner := &batchRunner{manager: fm, clock: &manualClock{now: batchEpoch}}
+	fm.SetClock(runner.clock)
+
+	report := &BatchReport{Results: make([]BatchResult, 0, len(records))}
+	for _, record := range records {
+		result := runner.execute(record.line, record.fields)
+		report.Results = append(report.Results, result)
+
+		if result.Err != nil {
+			report.Failed++
+			fmt.Fprintf(out, "line %d: FAILED %s: %v\n", result.Line, result.Command, result.Err)
+		} else {
+			report.Succeeded++
+			fmt.Fprintf(out, "line %d: OK %s", result.Line, result.Command)
+			if result.Message != "" {
+				fmt.Fprintf(out, " (%s)", result.Message)
+			}
+			fmt.Fprintln(out)
+		}
+	}
+
+	fmt.Fprintf(out, "\n%d command(s) succeeded, %d failed\n", report.Succeeded, report.Failed)
+	fmt.Fprintln(out, "Final balances:")
+	for _, user := range fm.users {
+		fmt.Fprintf(out, "  %d %s (%s): %s\n", user.ProfileID, user.FullName, user.AccountType, user.money(user.CurrentFunds))
+	}
+	return report, nil
+}
+
+// batchRecord is one parsed script line
+type batchRecord struct {
+	line   int
+	fields []string
+}
+
+// readBatchScript splits a script into commands, skipping blank lines and
+// lines starting with #
+func readBatchScript(script io.Reader, format string) ([]batchRecord, error) {
+	records := make([]batchRecord, 0)
+
+	switch format {
+	case BATCH_FORMAT_CSV:
+		reader := csv.NewReader(script)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		reader.Comment = '#'
+		for {
+			fields, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CSV script: %v", err)
+			}
+			line, _ := reader.FieldPos(0)
+			records = append(records, batchRecord{line: line, fields: trimFields(fields)})
+		}
+
+	case BATCH_FORMAT_LINES:
+		scanner := bufio.NewScanner(script)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			fields, err := splitBatchLine(text)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			records = append(records, batchRecord{line: line, fields: fields})
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read script: %v", err)
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown batch format: %s", format)
+	}
+	return records, nil
+}
+
+// trimFields strips spaces from CSV fields and drops trailing empty ones
+func trimFields(fields []string) []string {
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	for len(fields) > 0 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	return fields
+}
+
+// splitBatchLine splits a line on whitespace, keeping "double quoted" text together
+func splitBatchLine(text string) ([]string, error) {
+	fields := make([]string, 0)
+	var current strings.Builder
+	inQuotes, inField := false, false
+
+	for _, ch := range text {
+		switch {
+		case ch == '"':
+			inQuotes = !inQuotes
+			inField = true
+		case (ch == ' ' || ch == '\t') && !inQuotes:
+			if inField {
+				fields = append(fields, current.String())
+				current.Reset()
+				inField = false
+			}
+		default:
+			current.WriteRune(ch)
+			inField = true
+		}
+	}
+	if inQuotes {
+		return nil, errors.New("unterminated quote")
+	}
+	if inField {
+		fields = append(fields, current.String())
+	}
+	return fields, nil
+}
+
+// execute runs a single command, honouring the expected-failure prefix
+func (b *batchRunner) execute(line int, fields []string) BatchResult {
+	result := BatchResult{Line: line, Command: strings.Join(fields, " ")}
+	if len(fields) == 0 {
+		result.Err = errors.New("empty command")
+		return result
+	}
+
+	expectFailure := false
+	if fields[0] == BATCH_EXPECT_FAILURE {
+		expectFailure = true
+		fields = fields[1:]
+	} else if strings.HasPrefix(fields[0], BATCH_EXPECT_FAILURE) {
+		expectFailure = true
+		fields = append([]string{strings.TrimPrefix(fields[0], BATCH_EXPECT_FAILURE)}, fields[1:]...)
+	}
+	if len(fields) == 0 {
+		result.Err = errors.New("empty command")
+		return result
+	}
+
+	commands := batchCommands
+	if strings.ToLower(fields[0]) == BATCH_OPERATOR_PREFIX && len(fields) > 1 {
+		commands = operatorBatchCommands
+		fields = fields[1:]
+	}
+	command, ok := commands[strings.ToLower(fields[0])]
+	if !ok {
+		result.Err = fmt.Errorf("unknown command %q", fields[0])
+		return result
+	}
+
+	args := fields[1:]
+	if len(args) < command.minArgs {
+		result.Err = fmt.Errorf("usage: %s", command.usage)
+		return result
+	}
+
+	message, err := command.run(b, args)
+	switch {
+	case expectFailure && err == nil:
+		result.Err = errors.New("expected the command to fail but it succeeded")
+	case expectFailure:
+		result.Message = "failed as expected: " + err.Error()
+	default:
+		result.Message, result.Err = message, err
+	}
+	return result
+}
+
+// parseBatchID reads a profile or transaction ID argument
+func parseBatchID(value string) (int, error) {
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ID %q", value)
+	}
+	return id, nil
+}
+
+// parseBatchAmount reads an amount argument
+func parseBatchAmount(value string) (float64, error) {
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	return amount, nil
+}
+
+// optionalArg returns args[i] or an empty string
+func optionalArg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
+
+// balanceMessage describes an account's balance after a command
+func (b *batchRunner) balanceMessage(profileID int) string {
+	user, err := b.manager.LocateUser(profileID)
+	if err != nil {
+		return ""
+	}
+	return "balance " + user.money(user.CurrentFunds)
+}
+
+func (b *batchRunner) register(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+
+	accountType := optionalArg(args, 2)
+	if accountType == "" {
+		accountType = SAVINGS_ACCOUNT
+	}
+	pin := optionalArg(args, 3)
+	if pin == "" {
+		pin = BATCH_DEFAULT_PIN
+	}
+
+	user, err := b.manager.RegisterCustomer(profileID, args[1], accountType, pin)
+	if err != nil {
+		return "", err
+	}
+	if currency := optionalArg(args, 4); currency != "" {
+		if err := b.manager.SetCurrency(profileID, currency); err != nil {
+			b.manager.removeUser(profileID)
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%s %s account for %s", user.Currency, user.AccountType, user.FullName), nil
+}
+
+func (b *batchRunner) deposit(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	amount, err := parseBatchAmount(args[1])
+	if err != nil {
+		return "", err
+	}
+
+	if key := optionalArg(args, 2); key != "" {
+		result, err := b.manager.AddFundsOnce(key, profileID, amount)
+		if err != nil {
+			return "", err
+		}
+		return b.replayMessage(result), nil
+	}
+	if err := b.manager.AddFunds(profileID, amount); err != nil {
+		return "", err
+	}
+	return b.balanceMessage(profileID), nil
+}
+
+func (b *batchRunner) withdraw(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	amount, err := parseBatchAmount(args[1])
+	if err != nil {
+		return "", err
+	}
+
+	if key := optionalArg(args, 2); key != "" {
+		result, err := b.manager.RemoveFundsOnce(key, profileID, amount)
+		if err != nil {
+			return "", err
+		}
+		return b.replayMessage(result), nil
+	}
+	if err := b.manager.RemoveFunds(profileID, amount); err != nil {
+		return "", err
+	}
+	return b.balanceMessage(profileID), nil
+}
+
+func (b *batchRunner) transfer(args []string) (string, error) {
+	fromID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	toID, err := parseBatchID(args[1])
+	if err != nil {
+		return "", err
+	}
+	amount, err := parseBatchAmount(args[2])
+	if err != nil {
+		return "", err
+	}
+
+	if key := optionalArg(args, 3); key != "" {
+		result, err := b.manager.TransferFundsOnce(key, fromID, toID, amount)
+		if err != nil {
+			return "", err
+		}
+		return b.replayMessage(result), nil
+	}
+	if err := b.manager.TransferFunds(fromID, toID, amount); err != nil {
+		return "", err
+	}
+	return b.balanceMessage(fromID), nil
+}
+
+// replayMessage describes the result of an idempotent operation
+func (b *batchRunner) replayMessage(result *OperationResult) string {
+	balance := fmt.Sprintf("balance %.2f", result.Balance)
+	if user, err := b.manager.LocateUser(result.ProfileID); err == nil {
+		balance = "balance " + user.money(result.Balance)
+	}
+	if result.Replayed {
+		return "replayed, " + balance
+	}
+	return balance
+}
+
+func (b *batchRunner) depositForeign(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	amount, err := parseBatchAmount(args[1])
+	if err != nil {
+		return "", err
+	}
+
+	if key := optionalArg(args, 3); key != "" {
+		result, err := b.manager.DepositForeignOnce(key, profileID, amount, args[2])
+		if err != nil {
+			return "", err
+		}
+		return b.replayMessage(result), nil
+	}
+	if _, err := b.manager.DepositForeign(profileID, amount, args[2]); err != nil {
+		return "", err
+	}
+	return b.balanceMessage(profileID), nil
+}
+
+func (b *batchRunner) loadRates(args []string) (string, error) {
+	if err := b.manager.LoadExchangeRates(args[0]); err != nil {
+		return "", err
+	}
+	return strings.Join(b.manager.rates.Currencies(), ", "), nil
+}
+
+func (b *batchRunner) balance(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+
+	b.manager.ProcessAccruals()
+	user, err := b.manager.LocateUser(profileID)
+	if err != nil {
+		return "", err
+	}
+
+	if expectedArg := optionalArg(args, 1); expectedArg != "" {
+		expected, err := parseBatchAmount(expectedArg)
+		if err != nil {
+			return "", err
+		}
+		if roundAmount(user.CurrentFunds) != roundAmount(expected) {
+			return "", fmt.Errorf("balance is %s, expected %s", user.money(user.CurrentFunds), user.money(expected))
+		}
+	}
+	return "balance " + user.money(user.CurrentFunds), nil
+}
+
+func (b *batchRunner) freeze(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	return "", b.manager.SetAccountStatus(profileID, STATUS_FROZEN, strings.Join(args[1:], " "))
+}
+
+func (b *batchRunner) unfreeze(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	return "", b.manager.SetAccountStatus(profileID, STATUS_ACTIVE, strings.Join(args[1:], " "))
+}
+
+func (b *batchRunner) loanRate(args []string) (string, error) {
+	rate, err := parseBatchAmount(args[0])
+	if err != nil {
+		return "", err
+	}
+	return "", b.manager.SetLoanRate(rate)
+}
+
+func (b *batchRunner) reactivate(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	return "", b.manager.ReactivateAccount(profileID, strings.Join(args[1:], " "))
+}
+
+func (b *batchRunner) close(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+
+	payoutProfileID := 0
+	if value := optionalArg(args, 1); value != "" {
+		if payoutProfileID, err = parseBatchID(value); err != nil {
+			return "", err
+		}
+	}
+
+	payout, err := b.manager.CloseAccount(profileID, payoutProfileID)
+	if err != nil {
+		return "", err
+	}
+	user, _ := b.manager.LocateUser(profileID)
+	return "paid out " + user.money(payout), nil
+}
+
+func (b *batchRunner) status(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+
+	b.manager.ProcessDormancy()
+	user, err := b.manager.LocateUser(profileID)
+	if err != nil {
+		return "", err
+	}
+
+	if expected := strings.ToUpper(optionalArg(args, 1)); expected != "" && user.Status != expected {
+		return "", fmt.Errorf("status is %s, expected %s", user.Status, expected)
+	}
+	return user.Status, nil
+}
+
+func (b *batchRunner) loan(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	principal, err := parseBatchAmount(args[1])
+	if err != nil {
+		return "", err
+	}
+	months, err := strconv.Atoi(args[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid number of months %q", args[2])
+	}
+
+	loan, err := b.manager.OpenLoan(profileID, principal, months)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("loan #%d, EMI %.2f", loan.ID, loan.EMI), nil
+}
+
+func (b *batchRunner) prepay(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	loanID, err := parseBatchID(args[1])
+	if err != nil {
+		return "", err
+	}
+	amount, err := parseBatchAmount(args[2])
+	if err != nil {
+		return "", err
+	}
+	mode := optionalArg(args, 3)
+	if mode == "" {
+		mode = PREPAY_REDUCE_EMI
+	}
+
+	if err := b.manager.PrepayLoan(profileID, loanID, amount, mode); err != nil {
+		return "", err
+	}
+	return b.loanMessage(profileID, loanID), nil
+}
+
+func (b *batchRunner) runLoans(args []string) (string, error) {
+	runs := b.manager.RunLoanInstallments()
+	failed := 0
+	for _, run := range runs {
+		if !run.Succeeded {
+			failed++
+		}
+	}
+	return fmt.Sprintf("%d installment(s), %d failed", len(runs), failed), nil
+}
+
+func (b *batchRunner) loanStatus(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	loanID, err := parseBatchID(args[1])
+	if err != nil {
+		return "", err
+	}
+	loan, _, err := b.manager.locateLoan(profileID, loanID)
+	if err != nil {
+		return "", err
+	}
+
+	if value := optionalArg(args, 2); value != "" {
+		expected, err := parseBatchAmount(value)
+		if err != nil {
+			return "", err
+		}
+		if loan.Outstanding != roundAmount(expected) {
+			return "", fmt.Errorf("outstanding is %.2f, expected %.2f", loan.Outstanding, expected)
+		}
+	}
+	if value := optionalArg(args, 3); value != "" {
+		expected, err := parseBatchAmount(value)
+		if err != nil {
+			return "", err
+		}
+		if loan.Arrears() != roundAmount(expected) {
+			return "", fmt.Errorf("arrears are %.2f, expected %.2f", loan.Arrears(), expected)
+		}
+	}
+	return b.loanMessage(profileID, loanID), nil
+}
+
+// loanMessage summarises a loan after a command
+func (b *batchRunner) loanMessage(profileID, loanID int) string {
+	loan, _, err := b.manager.locateLoan(profileID, loanID)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s, EMI %.2f, outstanding %.2f, arrears %.2f, %d installment(s) left",
+		loan.Status, loan.EMI, loan.Outstanding, loan.Arrears(), len(loan.Schedule)-loan.paidInstallments())
+}
+
+func (b *batchRunner) alert(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	threshold, err := parseBatchAmount(args[2])
+	if err != nil {
+		return "", err
+	}
+
+	rule, err := b.manager.AddAlertRule(profileID, args[1], threshold, args[3], optionalArg(args, 4))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("alert #%d", rule.ID), nil
+}
+
+func (b *batchRunner) overdraft(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	limit, err := parseBatchAmount(args[1])
+	if err != nil {
+		return "", err
+	}
+	return "", b.manager.SetOverdraftLimit(profileID, limit)
+}
+
+func (b *batchRunner) rate(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	rate, err := parseBatchAmount(args[1])
+	if err != nil {
+		return "", err
+	}
+	return "", b.manager.SetInterestRate(profileID, rate)
+}
+
+func (b *batchRunner) schedule(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	amount, err := parseBatchAmount(args[2])
+	if err != nil {
+		return "", err
+	}
+	startDate, err := time.ParseInLocation(DATE_FORMAT, args[4], time.Local)
+	if err != nil {
+		return "", fmt.Errorf("invalid start date %q", args[4])
+	}
+
+	var endDate time.Time
+	if value := optionalArg(args, 5); value != "" {
+		if endDate, err = time.ParseInLocation(DATE_FORMAT, value, time.Local); err != nil {
+			return "", fmt.Errorf("invalid end date %q", value)
+		}
+	}
+
+	payment, err := b.manager.SchedulePayment(profileID, args[1], amount, args[3], startDate, endDate)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("payment #%d", payment.ID), nil
+}
+
+func (b *batchRunner) runScheduled(args []string) (string, error) {
+	runs := b.manager.RunDuePayments()
+	failed := 0
+	for _, run := range runs {
+		if !run.Succeeded {
+			failed++
+		}
+	}
+	return fmt.Sprintf("%d run(s), %d failed", len(runs), failed), nil
+}
+
+func (b *batchRunner) reverse(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	transactionID, err := parseBatchID(args[1])
+	if err != nil {
+		return "", err
+	}
+
+	reason := strings.Join(args[2:], " ")
+	if err := b.manager.ReverseTransaction(profileID, transactionID, reason); err != nil {
+		return "", err
+	}
+	return b.balanceMessage(profileID), nil
+}
+
+func (b *batchRunner) dispute(args []string) (string, error) {
+	profileID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	transactionID, err := parseBatchID(args[1])
+	if err != nil {
+		return "", err
+	}
+
+	dispute, err := b.manager.OpenDispute(profileID, transactionID, strings.Join(args[2:], " "))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("dispute #%d, %s", dispute.ID, b.balanceMessage(profileID)), nil
+}
+
+func (b *batchRunner) reviewDispute(args []string) (string, error) {
+	disputeID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	if err := b.manager.ReviewDispute(disputeID, strings.Join(args[1:], " ")); err != nil {
+		return "", err
+	}
+	return b.disputeMessage(disputeID), nil
+}
+
+func (b *batchRunner) resolveDispute(args []string) (string, error) {
+	disputeID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+
+	var refund bool
+	switch strings.ToUpper(args[1]) {
+	case "REFUND":
+		refund = true
+	case "REJECT":
+	default:
+		return "", fmt.Errorf("invalid dispute outcome %q: use REFUND or REJECT", args[1])
+	}
+
+	if err := b.manager.ResolveDispute(disputeID, refund, strings.Join(args[2:], " ")); err != nil {
+		return "", err
+	}
+	return b.disputeMessage(disputeID), nil
+}
+
+func (b *batchRunner) disputeStatus(args []string) (string, error) {
+	disputeID, err := parseBatchID(args[0])
+	if err != nil {
+		return "", err
+	}
+	dispute, _, err := b.manager.locateDispute(disputeID)
+	if err != nil {
+		return "", err
+	}
+
+	if expected := strings.ToUpper(optionalArg(args, 1)); expected != "" && dispute.Status != expected {
+		return "", fmt.Errorf("dispute status is %s, expected %s", dispute.Status, expected)
+	}
+	return b.disputeMessage(disputeID), nil
+}
+
+// disputeMessage describes a dispute and its account's balance
+func (b *batchRunner) disputeMessage(disputeID int) string {
+	dispute, _, err := b.manager.locateDispute(disputeID)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s, %s", dispute.Status, b.balanceMessage(dispute.ProfileID))
+}
+
+func (b *batchRunner) reconcile(args []string) (string, error) {
+	reports := b.manager.Reconcile()
+	for _, report := range reports {
+		if !report.OK() {
+			return "", fmt.Errorf("profile %d entry %d: %s", report.ProfileID, report.Issue.Position, report.Issue.Problem)
+		}
+	}
+	return fmt.Sprintf("%d account(s) consistent", len(reports)), nil
+}
+
+func (b *batchRunner) setClock(args []string) (string, error) {
+	value := strings.Join(args, " ")
+	layout := DATE_FORMAT
+	if len(args) > 1 {
+		layout = TIMESTAMP_FORMAT
+	}
+
+	now, err := time.ParseInLocation(layout, value, time.Local)
+	if err != nil {
+		return "", fmt.Errorf("invalid time %q", value)
+	}
+	if now.Before(b.clock.Now()) {
+		return "", errors.New("the clock cannot move backwards")
+	}
+	b.clock.Set(now)
+	return now.Format(TIMESTAMP_FORMAT), nil
+}
+
+func (b *batchRunner) advance(args []string) (string, error) {
+	var step time.Duration
+	if days, ok := strings.CutSuffix(args[0], "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return "", fmt.Errorf("invalid number of days %q", args[0])
+		}
+		step = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if step, err = time.ParseDuration(args[0]); err != nil {
+			return "", fmt.Errorf("invalid duration %q", args[0])
+		}
+	}
+	if step < 0 {
+		return "", errors.New("the clock cannot move backwards")
+	}
+
+	b.clock.Advance(step)
+	return b.clock.Now().Format(TIMESTAMP_FORMAT), nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRunBatchSampleScript(t *testing.T) {
+	script, err := os.Open("testdata/sample.txt")
+	if err != nil {
+		t.Fatalf("open script: %v", err)
+	}
+	defer script.Close()
+
+	var out bytes.Buffer
+	report, err := InitializeManager().RunBatch(script, BATCH_FORMAT_LINES, &out)
+	if err != nil {
+		t.Fatalf("RunBatch: %v", err)
+	}
+	if report.Failed != 0 {
+		t.Fatalf("%d command(s) failed:\n%s", report.Failed, out.String())
+	}
+
+	expectedFailures := 0
+	for _, result := range report.Results {
+		if strings.HasPrefix(result.Command, BATCH_EXPECT_FAILURE) {
+			expectedFailures++
+			if !strings.HasPrefix(result.Message, "failed as expected") {
+				t.Errorf("line %d: message %q; want the expected failure reported", result.Line, result.Message)
+			}
+		}
+	}
+	if expectedFailures == 0 {
+		t.Error("the sample script has no expected-failure lines")
+	}
+	if !strings.Contains(out.String(), "101 Asha Rao (SAVINGS): Rs.2800.00") {
+		t.Errorf("final balances missing from output:\n%s", out.String())
+	}
+}
+
+func TestRunBatchReportsFailures(t *testing.T) {
+	script := strings.Join([]string{
+		"register,101,Asha,SAVINGS",
+		"deposit,101,100",
+		"# an expected failure that succeeds is itself a failure",
+		"!withdraw,101,50",
+		"withdraw,101,500",
+		"reverse,101,1",
+		"operator,reverse,101,1",
+	}, "\n")
+
+	var out bytes.Buffer
+	report, err := InitializeManager().RunBatch(strings.NewReader(script), BATCH_FORMAT_CSV, &out)
+	if err != nil {
+		t.Fatalf("RunBatch: %v", err)
+	}
+	if report.Succeeded != 3 || report.Failed != 3 {
+		t.Fatalf("%d succeeded and %d failed; want 3 and 3:\n%s", report.Succeeded, report.Failed, out.String())
+	}
+
+	failedLines := make([]int, 0)
+	for _, result := range report.Results {
+		if result.Err != nil {
+			failedLines = append(failedLines, result.Line)
+		}
+	}
+	if len(failedLines) != 3 || failedLines[0] != 4 || failedLines[1] != 5 || failedLines[2] != 6 {
+		t.Errorf("failed lines %v; want [4 5 6]", failedLines)
+	}
+	if !strings.Contains(out.String(), `unknown command "reverse"`) {
+		t.Errorf("reverse should only be available to the back office:\n%s", out.String())
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Currency settings
+const (
+	BASE_CURRENCY = "INR"
+	RATES_FILE    = "exchange_rates.json"
+)
+
+// CONVERSION_FEE_TYPE is the fee charged when money changes currency
+const CONVERSION_FEE_TYPE = "CONVERSION_FEE"
+
+// ErrUnsupportedCurrency is returned for currencies missing from the rate table
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// currencySymbols holds display prefixes for common currencies; others
+// are shown by their code
+var currencySymbols = map[string]string{
+	"INR": "Rs.",
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+}
+
+// ExchangeRates is the rate table. Each rate is the value of one unit of
+// the currency in the base currency.
+type ExchangeRates struct {
+	Base       string             `json:"base"`
+	FeePercent float64            `json:"fee_percent"`
+	Rates      map[string]float64 `json:"rates"`
+}
+
+// currencySymbol returns the display prefix for a currency
+func currencySymbol(currency string) string {
+	if symbol, ok := currencySymbols[currency]; ok {
+		return symbol
+	}
+	return currency + " "
+}
+
+// formatMoney renders an amount in a currency, e.g. Rs.10.00 or $10.00
+func formatMoney(currency string, amount float64) string {
+	return fmt.Sprintf("%s%.2f", currencySymbol(currency), amount)
+}
+
+// money renders an amount in the account's currency
+func (user *UserAccount) money(amount float64) string {
+	return formatMoney(user.Currency, amount)
+}
+
+// defaultExchangeRates supports only the base currency, with no fee
+func defaultExchangeRates() *ExchangeRates {
+	return &ExchangeRates{Base: BASE_CURRENCY, Rates: map[string]float64{}}
+}
+
+// LoadExchangeRates reads a rate table from a JSON file
+func LoadExchangeRates(path string) (*ExchangeRates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates: %v", err)
+	}
+
+	var rates ExchangeRates
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return nil, fmt.Errorf("failed to parse exchange rates: %v", err)
+	}
+
+	rates.Base = strings.ToUpper(rates.Base)
+	if rates.Base == "" {
+		rates.Base = BASE_CURRENCY
+	}
+	if rates.FeePercent < 0 || rates.FeePercent >= 100 {
+		return nil, fmt.Errorf("invalid conversion fee: %.2f%%", rates.FeePercent)
+	}
+
+	normalised := make(map[string]float64, len(rates.Rates))
+	for currency, rate := range rates.Rates {
+		if rate <= 0 {
+			return nil, fmt.Errorf("invalid rate for %s: %v", currency, rate)
+		}
+		normalised[strings.ToUpper(currency)] = rate
+	}
+	rates.Rates = normalised
+	return &rates, nil
+}
+
+// rate returns the value of one unit of a currency in the base currency
+func (r *ExchangeRates) rate(currency string) (float64, error) {
+	if currency == r.Base {
+		return 1, nil
+	}
+	rate, ok := r.Rates[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, currency)
+	}
+	return rate, nil
+}
+
+// Supports reports whether a currency is in the rate table
+func (r *ExchangeRates) Supports(currency string) bool {
+	_, err := r.rate(currency)
+	return err == nil
+}
+
+// Currencies lists the supported currency codes
+func (r *ExchangeRates) Currencies() []string {
+	currencies := []string{r.Base}
+	for currency := range r.Rates {
+		if currency != r.Base {
+			currencies = append(currencies, currency)
+		}
+	}
+	sort.Strings(currencies[1:])
+	return currencies
+}
+
+// Convert changes an amount from one currency to another at the table's rates
+func (r *ExchangeRates) Convert(amount float64, from, to string) (float64, error) {
+	fromRate, err := r.rate(from)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := r.rate(to)
+	if err != nil {
+		return 0, err
+	}
+	return amount * fromRate / toRate, nil
+}
+
+// loadDefaultRates loads RATES_FILE when it exists
+func (fm *FinancialManager) loadDefaultRates() error {
+	if _, err := os.Stat(RATES_FILE); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return fm.LoadExchangeRates(RATES_FILE)
+}
+
+// LoadExchangeRates replaces the manager's rate table from a file
+func (fm *FinancialManager) LoadExchangeRates(path string) error {
+	rates, err := LoadExchangeRates(path)
+	if err != nil {
+		return err
+	}
+	fm.rates = rates
+	return nil
+}
+
+// SetCurrency changes the currency of an account that has no transactions yet
+func (fm *FinancialManager) SetCurrency(profileID int, currency string) error {
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return err
+	}
+
+	currency = strings.ToUpper(currency)
+	if !fm.rates.Supports(currency) {
+		return fmt.Errorf("%w: %s", ErrUnsupportedCurrency, currency)
+	}
+	if len(user.Transactions) > 0 {
+		return errors.New("the currency cannot be changed once the account has transactions")
+	}
+
+	user.Currency = currency
+	return nil
+}
+
+// DepositForeign adds money given in any supported currency, converting it
+// to the account currency and charging the conversion fee. It returns the
+// amount credited before the fee.
+func (fm *FinancialManager) DepositForeign(profileID int, amount float64, currency string) (float64, error) {
+	if amount <= 0 {
+		return 0, ErrInvalidAmount
+	}
+
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return 0, err
+	}
+
+	currency = strings.ToUpper(currency)
+	if currency == user.Currency {
+		return amount, fm.AddFunds(profileID, amount)
+	}
+	if err := fm.checkStatus(user, false); err != nil {
+		return 0, err
+	}
+
+	converted, fee, err := fm.conversion(amount, currency, user.Currency)
+	if err != nil {
+		return 0, err
+	}
+	fm.creditConverted(user, amount, currency, converted, fee, ADD_FUNDS_TYPE, 0)
+	fm.touch(user)
+	return converted, nil
+}
+
+// DepositForeignOnce adds money in any supported currency under an
+// idempotency key
+func (fm *FinancialManager) DepositForeignOnce(key string, profileID int, amount float64, currency string) (*OperationResult, error) {
+	if err := checkClientKey(key); err != nil {
+		return nil, err
+	}
+	currency = strings.ToUpper(currency)
+	return fm.runOnce(key, OP_ADD_FUNDS+"_"+currency, profileID, 0, amount, func() error {
+		_, err := fm.DepositForeign(profileID, amount, currency)
+		return err
+	})
+}
+
+// conversion works out the converted amount and fee for a currency change
+func (fm *FinancialManager) conversion(amount float64, from, to string) (float64, float64, error) {
+	converted, err := fm.rates.Convert(amount, from, to)
+	if err != nil {
+		return 0, 0, err
+	}
+	converted = roundAmount(converted)
+	fee := roundAmount(converted * fm.rates.FeePercent / 100)
+	return converted, fee, nil
+}
+
+// creditConverted posts a credit that arrived in another currency, noting
+// the original amount, followed by the conversion fee linked to it so a
+// reversal of the credit refunds the fee too. It returns the credit's
+// transaction ID.
+func (fm *FinancialManager) creditConverted(user *UserAccount, original float64, fromCurrency string,
+	converted, fee float64, recordType string, linkedID int) int {
+	now := fm.clock.Now()
+	fm.accrueInterest(user, startOfDay(now))
+
+	user.CurrentFunds += converted
+	note := fmt.Sprintf("converted from %s", formatMoney(fromCurrency, original))
+	id := fm.recordLinkedActivity(user, recordType, converted, now, linkedID, note)
+
+	if fee > 0 {
+		user.CurrentFunds -= fee
+		fm.recordLinkedActivity(user, CONVERSION_FEE_TYPE, -fee, now, id, "")
+	}
+	return id
+}
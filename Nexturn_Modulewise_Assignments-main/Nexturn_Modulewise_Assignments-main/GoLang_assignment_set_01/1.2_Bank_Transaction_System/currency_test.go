@@ -0,0 +1,124 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newCurrencyTest returns a manager with a rupee and a dollar current
+// account under a fixed rate table with a 1.5% conversion fee
+func newCurrencyTest(t *testing.T) (*FinancialManager, *UserAccount, *UserAccount) {
+	t.Helper()
+	manager := InitializeManager()
+	manager.SetClock(&manualClock{now: time.Date(2024, 6, 10, 9, 0, 0, 0, time.UTC)})
+	manager.rates = &ExchangeRates{
+		Base:       "INR",
+		FeePercent: 1.5,
+		Rates:      map[string]float64{"USD": 83.25, "EUR": 90.10, "JPY": 0.56},
+	}
+
+	rupees, err := manager.RegisterCustomer(1, "Rupees", CURRENT_ACCOUNT, "1234")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	dollars, err := manager.RegisterCustomer(2, "Dollars", CURRENT_ACCOUNT, "1234")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := manager.SetCurrency(2, "usd"); err != nil {
+		t.Fatalf("set currency: %v", err)
+	}
+	return manager, rupees, dollars
+}
+
+func TestConversionRounding(t *testing.T) {
+	manager, _, _ := newCurrencyTest(t)
+	cases := []struct {
+		amount    float64
+		from, to  string
+		converted float64
+		fee       float64
+	}{
+		{amount: 1000, from: "INR", to: "USD", converted: 12.01, fee: 0.18},
+		{amount: 100, from: "USD", to: "INR", converted: 8325, fee: 124.88},
+		{amount: 250, from: "EUR", to: "USD", converted: 270.57, fee: 4.06},
+		{amount: 33.33, from: "USD", to: "EUR", converted: 30.80, fee: 0.46},
+		{amount: 0.01, from: "USD", to: "JPY", converted: 1.49, fee: 0.02},
+		{amount: 1, from: "JPY", to: "INR", converted: 0.56, fee: 0.01},
+	}
+
+	for _, tc := range cases {
+		converted, fee, err := manager.conversion(tc.amount, tc.from, tc.to)
+		if err != nil {
+			t.Fatalf("conversion(%.2f %s to %s): %v", tc.amount, tc.from, tc.to, err)
+		}
+		if converted != tc.converted || fee != tc.fee {
+			t.Errorf("conversion(%.2f %s to %s) = %.2f, fee %.2f; want %.2f, fee %.2f",
+				tc.amount, tc.from, tc.to, converted, fee, tc.converted, tc.fee)
+		}
+	}
+
+	if _, _, err := manager.conversion(10, "INR", "CHF"); err == nil {
+		t.Error("converted to a currency missing from the rate table")
+	}
+}
+
+func TestForeignDepositChargesFee(t *testing.T) {
+	manager, rupees, _ := newCurrencyTest(t)
+
+	credited, err := manager.DepositForeign(1, 100, "usd")
+	if err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	if credited != 8325 || roundAmount(rupees.CurrentFunds) != 8200.12 {
+		t.Errorf("credited %.2f, balance %.2f; want 8325 and 8200.12", credited, rupees.CurrentFunds)
+	}
+
+	credit, fee := rupees.Transactions[0], rupees.Transactions[1]
+	if fee.Type != CONVERSION_FEE_TYPE || fee.Amount != -124.88 || fee.LinkedID != credit.ID {
+		t.Errorf("fee %+v; want -124.88 linked to credit %d", fee, credit.ID)
+	}
+
+	// Money in the account's own currency is not converted
+	if credited, err := manager.DepositForeign(1, 50, "INR"); err != nil || credited != 50 {
+		t.Errorf("same-currency deposit = %.2f, %v; want 50 without a fee", credited, err)
+	}
+}
+
+func TestReversingConvertedTransferRefundsFee(t *testing.T) {
+	for _, leg := range []string{TRANSFER_OUT_TYPE, TRANSFER_IN_TYPE} {
+		t.Run(leg, func(t *testing.T) {
+			manager, rupees, dollars := newCurrencyTest(t)
+			if err := manager.AddFunds(1, 5000); err != nil {
+				t.Fatalf("deposit: %v", err)
+			}
+			if err := manager.TransferFunds(1, 2, 1000); err != nil {
+				t.Fatalf("transfer: %v", err)
+			}
+			if roundAmount(rupees.CurrentFunds) != 4000 || roundAmount(dollars.CurrentFunds) != 11.83 {
+				t.Fatalf("balances %.2f and %.2f after the transfer; want 4000 and 11.83", rupees.CurrentFunds, dollars.CurrentFunds)
+			}
+
+			owner, id := rupees, rupees.Transactions[len(rupees.Transactions)-1].ID
+			if leg == TRANSFER_IN_TYPE {
+				owner, id = dollars, dollars.Transactions[0].ID
+			}
+			if err := manager.ReverseTransaction(owner.ProfileID, id, "wrong payee"); err != nil {
+				t.Fatalf("reverse: %v", err)
+			}
+
+			if roundAmount(rupees.CurrentFunds) != 5000 || roundAmount(dollars.CurrentFunds) != 0 {
+				t.Errorf("balances %.2f and %.2f after the reversal; want 5000 and 0", rupees.CurrentFunds, dollars.CurrentFunds)
+			}
+			fee := dollars.feeOn(dollars.Transactions[0].ID)
+			if fee == nil || dollars.reversalOf(fee.ID) == nil {
+				t.Errorf("conversion fee %+v was not refunded with the transfer", fee)
+			}
+			for _, id := range []int{1, 2} {
+				if issue := reconcileIssue(t, manager, id); issue != nil {
+					t.Errorf("profile %d after the reversal: %+v", id, issue)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Record types for corrections
+const (
+	REVERSAL_TYPE             = "REVERSAL"
+	PROVISIONAL_CREDIT_TYPE   = "PROVISIONAL_CREDIT"
+	PROVISIONAL_REVERSAL_TYPE = "PROVISIONAL_CREDIT_REVERSAL"
+	DISPUTE_EVENT_TYPE        = "DISPUTE"
+)
+
+// Dispute statuses
+const (
+	DISPUTE_OPENED       = "OPENED"
+	DISPUTE_UNDER_REVIEW = "UNDER_REVIEW"
+	DISPUTE_REFUNDED     = "RESOLVED_REFUNDED"
+	DISPUTE_REJECTED     = "REJECTED"
+)
+
+// Errors callers can check for with errors.Is
+var (
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrDisputeNotFound     = errors.New("dispute not found")
+)
+
+// DisputeEvent records a status change of a dispute
+type DisputeEvent struct {
+	Status    string
+	Note      string
+	Timestamp time.Time
+}
+
+// Dispute tracks a customer's challenge to a debit
+type Dispute struct {
+	ID                  int
+	ProfileID           int
+	TransactionID       int
+	Amount              float64
+	Reason              string
+	Status              string
+	ProvisionalCreditID int
+	OpenedAt            time.Time
+	History             []DisputeEvent
+}
+
+// ReverseTransaction posts a compensating entry for a mistaken transaction.
+// Reversing either leg of a transfer reverses both legs, and reversing a
+// posting also refunds the overdraft or conversion fee it was charged.
+// Reversals are corrections, so withdrawal rules and funds checks do not
+// apply.
+func (fm *FinancialManager) ReverseTransaction(profileID, transactionID int, reason string) error {
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return err
+	}
+
+	original := user.findTransaction(transactionID)
+	if original == nil {
+		return fmt.Errorf("%w (ID %d on profile %d)", ErrTransactionNotFound, transactionID, profileID)
+	}
+	if err := user.checkOpen(); err != nil {
+		return err
+	}
+	if err := fm.checkReversible(user, original); err != nil {
+		return err
+	}
+
+	// Check the other leg before posting anything
+	var counterparty *UserAccount
+	var otherLeg *Transaction
+	if original.Type == TRANSFER_IN_TYPE || original.Type == TRANSFER_OUT_TYPE {
+		counterparty, otherLeg = fm.otherLegOf(original)
+		if otherLeg == nil {
+			return fmt.Errorf("other leg of transfer %d not found", original.ID)
+		}
+		if err := counterparty.checkOpen(); err != nil {
+			return err
+		}
+		if err := fm.checkReversible(counterparty, otherLeg); err != nil {
+			return err
+		}
+	}
+
+	otherLegID := 0
+	if otherLeg != nil {
+		otherLegID = otherLeg.ID
+	}
+	fm.reverseWithFee(user, original, reason)
+	if counterparty != nil {
+		fm.reverseWithFee(counterparty, counterparty.findTransaction(otherLegID), reason)
+	}
+	return nil
+}
+
+// otherLegOf finds the matching leg of a transfer and the account holding
+// it. The incoming leg links to the outgoing one; transfers saved before
+// that carry the link on both legs.
+func (fm *FinancialManager) otherLegOf(txn *Transaction) (*UserAccount, *Transaction) {
+	if txn.LinkedID != 0 {
+		if owner := fm.ownerOf(txn.LinkedID); owner != nil {
+			return owner, owner.findTransaction(txn.LinkedID)
+		}
+		return nil, nil
+	}
+	for _, user := range fm.users {
+		for i := range user.Transactions {
+			if leg := &user.Transactions[i]; leg.Type == TRANSFER_IN_TYPE && leg.LinkedID == txn.ID {
+				return user, leg
+			}
+		}
+	}
+	return nil, nil
+}
+
+// reversalOf finds the entry that reversed a transaction, if any
+func (user *UserAccount) reversalOf(transactionID int) *Transaction {
+	for i := range user.Transactions {
+		txn := &user.Transactions[i]
+		if txn.LinkedID == transactionID && (txn.Type == REVERSAL_TYPE || txn.Type == PROVISIONAL_REVERSAL_TYPE) {
+			return txn
+		}
+	}
+	return nil
+}
+
+// reverseWithFee reverses a transaction and any fee charged on it
+func (fm *FinancialManager) reverseWithFee(user *UserAccount, original *Transaction, reason string) {
+	originalID := original.ID
+	fm.postReversal(user, original, reason)
+	if fee := user.feeOn(originalID); fee != nil && user.reversalOf(fee.ID) == nil {
+		fm.postReversal(user, fee, reason)
+	}
+}
+
+// feeOn finds the fee linked to a posting: the overdraft fee of a debit or
+// the conversion fee of a credit that changed currency
+func (user *UserAccount) feeOn(transactionID int) *Transaction {
+	for i := range user.Transactions {
+		txn := &user.Transactions[i]
+		if (txn.Type == OVERDRAFT_FEE_TYPE || txn.Type == CONVERSION_FEE_TYPE) && txn.LinkedID == transactionID {
+			return txn
+		}
+	}
+	return nil
+}
+
+// checkReversible rejects transactions that are already corrected, are
+// corrections themselves or are covered by a pending dispute
+func (fm *FinancialManager) checkReversible(user *UserAccount, txn *Transaction) error {
+	if reversal := user.reversalOf(txn.ID); reversal != nil {
+		return fmt.Errorf("transaction %d was already reversed by transaction %d", txn.ID, reversal.ID)
+	}
+	switch txn.Type {
+	case REVERSAL_TYPE, PROVISIONAL_CREDIT_TYPE, PROVISIONAL_REVERSAL_TYPE:
+		return fmt.Errorf("transaction %d is a correction and cannot be reversed", txn.ID)
+	case LOAN_DISBURSAL_TYPE, LOAN_EMI_TYPE, LOAN_PREPAYMENT_TYPE:
+		return fmt.Errorf("transaction %d is a loan posting and cannot be reversed", txn.ID)
+	}
+	for _, dispute := range fm.disputes {
+		if dispute.TransactionID == txn.ID && dispute.Status != DISPUTE_REJECTED {
+			return fmt.Errorf("transaction %d is covered by dispute %d", txn.ID, dispute.ID)
+		}
+	}
+	return nil
+}
+
+// postReversal posts the compensating entry, linked to the original
+func (fm *FinancialManager) postReversal(user *UserAccount, original *Transaction, reason string) {
+	originalID := original.ID
+	amount := -original.Amount
+	note := fmt.Sprintf("reverses transaction %d", originalID)
+	if reason != "" {
+		note += ": " + reason
+	}
+
+	user.CurrentFunds += amount
+	fm.recordLinkedActivity(user, REVERSAL_TYPE, amount, fm.clock.Now(), originalID, note)
+}
+
+// ownerOf finds the account holding a transaction
+func (fm *FinancialManager) ownerOf(transactionID int) *UserAccount {
+	for _, user := range fm.users {
+		if user.findTransaction(transactionID) != nil {
+			return user
+		}
+	}
+	return nil
+}
+
+// OpenDispute raises a dispute against a debit and posts a provisional
+// credit for its amount while the dispute is investigated. A debit that
+// was disputed before cannot be disputed again.
+func (fm *FinancialManager) OpenDispute(profileID, transactionID int, reason string) (*Dispute, error) {
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return nil, err
+	}
+
+	txn := user.findTransaction(transactionID)
+	if txn == nil {
+		return nil, fmt.Errorf("%w (ID %d on profile %d)", ErrTransactionNotFound, transactionID, profileID)
+	}
+	if txn.Amount >= 0 {
+		return nil, fmt.Errorf("only debits can be disputed; transaction %d is a credit", transactionID)
+	}
+	if err := user.checkOpen(); err != nil {
+		return nil, err
+	}
+	if err := fm.checkReversible(user, txn); err != nil {
+		return nil, err
+	}
+	// Each dispute pays a provisional credit, so a transaction can only be
+	// disputed once, however the earlier dispute ended
+	for _, earlier := range fm.disputes {
+		if earlier.TransactionID == transactionID {
+			return nil, fmt.Errorf("transaction %d was already disputed in dispute %d (%s)",
+				transactionID, earlier.ID, earlier.Status)
+		}
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, errors.New("a reason is required to open a dispute")
+	}
+
+	now := fm.clock.Now()
+	fm.lastDisputeID++
+	dispute := &Dispute{
+		ID:            fm.lastDisputeID,
+		ProfileID:     profileID,
+		TransactionID: transactionID,
+		Amount:        -txn.Amount,
+		Reason:        reason,
+		Status:        DISPUTE_OPENED,
+		OpenedAt:      now,
+		History:       make([]DisputeEvent, 0),
+	}
+
+	user.CurrentFunds += dispute.Amount
+	dispute.ProvisionalCreditID = fm.recordLinkedActivity(user, PROVISIONAL_CREDIT_TYPE, dispute.Amount, now,
+		transactionID, fmt.Sprintf("dispute %d", dispute.ID))
+	fm.recordDisputeEvent(user, dispute, DISPUTE_OPENED, reason)
+
+	fm.disputes = append(fm.disputes, dispute)
+	return dispute, nil
+}
+
+// ReviewDispute moves an opened dispute under review
+func (fm *FinancialManager) ReviewDispute(disputeID int, note string) error {
+	dispute, user, err := fm.locateDispute(disputeID)
+	if err != nil {
+		return err
+	}
+	if dispute.Status != DISPUTE_OPENED {
+		return fmt.Errorf("dispute %d cannot move from %s to %s", disputeID, dispute.Status, DISPUTE_UNDER_REVIEW)
+	}
+
+	fm.recordDisputeEvent(user, dispute, DISPUTE_UNDER_REVIEW, note)
+	return nil
+}
+
+// ResolveDispute closes a dispute under review. A refund makes the
+// provisional credit final; a rejection takes it back.
+func (fm *FinancialManager) ResolveDispute(disputeID int, refund bool, note string) error {
+	dispute, user, err := fm.locateDispute(disputeID)
+	if err != nil {
+		return err
+	}
+
+	status := DISPUTE_REJECTED
+	if refund {
+		status = DISPUTE_REFUNDED
+	}
+	if dispute.Status != DISPUTE_UNDER_REVIEW {
+		return fmt.Errorf("dispute %d cannot move from %s to %s", disputeID, dispute.Status, status)
+	}
+
+	if !refund {
+		user.CurrentFunds -= dispute.Amount
+		fm.recordLinkedActivity(user, PROVISIONAL_REVERSAL_TYPE, -dispute.Amount, fm.clock.Now(),
+			dispute.ProvisionalCreditID, fmt.Sprintf("dispute %d rejected", dispute.ID))
+	}
+
+	fm.recordDisputeEvent(user, dispute, status, note)
+	return nil
+}
+
+// locateDispute finds a dispute and the account it belongs to
+func (fm *FinancialManager) locateDispute(disputeID int) (*Dispute, *UserAccount, error) {
+	for _, dispute := range fm.disputes {
+		if dispute.ID == disputeID {
+			user, err := fm.LocateUser(dispute.ProfileID)
+			if err != nil {
+				return nil, nil, err
+			}
+			return dispute, user, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%w (ID %d)", ErrDisputeNotFound, disputeID)
+}
+
+// recordDisputeEvent moves a dispute to a status and notes it in the activity log
+func (fm *FinancialManager) recordDisputeEvent(user *UserAccount, dispute *Dispute, status, note string) {
+	now := fm.clock.Now()
+	dispute.Status = status
+	dispute.History = append(dispute.History, DisputeEvent{Status: status, Note: note, Timestamp: now})
+
+	message := fmt.Sprintf("dispute %d on transaction %d %s", dispute.ID, dispute.TransactionID, status)
+	if note != "" {
+		message += " (" + note + ")"
+	}
+	fm.logEvent(user, DISPUTE_EVENT_TYPE, message, now)
+}
+
+// DisputesFor returns the disputes raised by a profile
+func (fm *FinancialManager) DisputesFor(profileID int) []*Dispute {
+	disputes := make([]*Dispute, 0)
+	for _, dispute := range fm.disputes {
+		if dispute.ProfileID == profileID {
+			disputes = append(disputes, dispute)
+		}
+	}
+	return disputes
+}
+
+// ShowDisputes displays a user's disputes and their history
+func (fm *FinancialManager) ShowDisputes(profileID int) {
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	disputes := fm.DisputesFor(profileID)
+	if len(disputes) == 0 {
+		fmt.Println("No disputes found.")
+		return
+	}
+
+	fmt.Printf("\nDisputes for Profile %d:\n", profileID)
+	fmt.Println("----------------------------------------")
+	for _, dispute := range disputes {
+		fmt.Printf("#%d transaction %d %s [%s] - %s\n",
+			dispute.ID, dispute.TransactionID, user.money(dispute.Amount), dispute.Status, dispute.Reason)
+		for _, event := range dispute.History {
+			fmt.Printf("    %s %s %s\n", event.Timestamp.Format(TIMESTAMP_FORMAT), event.Status, event.Note)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReversingDebitRefundsOverdraftFee(t *testing.T) {
+	manager := InitializeManager()
+	manager.SetClock(&manualClock{now: time.Date(2024, 6, 10, 9, 0, 0, 0, time.Local)})
+	user, err := manager.RegisterCustomer(1, "Overdrawn", CURRENT_ACCOUNT, "1234")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := manager.SetOverdraftLimit(1, 1000); err != nil {
+		t.Fatalf("overdraft: %v", err)
+	}
+	if err := manager.AddFunds(1, 100); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	if err := manager.RemoveFunds(1, 300); err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	if user.CurrentFunds != 100-300-OVERDRAFT_FEE {
+		t.Fatalf("balance %.2f after the overdrawn debit; want %.2f", user.CurrentFunds, 100-300-OVERDRAFT_FEE)
+	}
+
+	debit := user.Transactions[len(user.Transactions)-2]
+	if err := manager.ReverseTransaction(1, debit.ID, "keyed twice"); err != nil {
+		t.Fatalf("reverse: %v", err)
+	}
+	if user.CurrentFunds != 100 {
+		t.Errorf("balance %.2f after the reversal; want 100", user.CurrentFunds)
+	}
+	fee := user.feeOn(debit.ID)
+	if fee == nil || user.reversalOf(fee.ID) == nil {
+		t.Errorf("fee %+v was not reversed with its debit", fee)
+	}
+	if err := manager.ReverseTransaction(1, debit.ID, "again"); err == nil {
+		t.Error("a reversed debit was reversed twice")
+	}
+}
+
+func TestRejectedDisputeCannotBeRefiled(t *testing.T) {
+	manager := InitializeManager()
+	manager.SetClock(&manualClock{now: time.Date(2024, 6, 10, 9, 0, 0, 0, time.Local)})
+	user, err := manager.RegisterCustomer(1, "Disputer", CURRENT_ACCOUNT, "1234")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := manager.AddFunds(1, 500); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	if err := manager.RemoveFunds(1, 200); err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	debit := user.Transactions[len(user.Transactions)-1]
+
+	dispute, err := manager.OpenDispute(1, debit.ID, "not me")
+	if err != nil {
+		t.Fatalf("open dispute: %v", err)
+	}
+	if _, err := manager.OpenDispute(1, debit.ID, "still not me"); err == nil {
+		t.Error("a second dispute was opened while the first is pending")
+	}
+	if err := manager.ReviewDispute(dispute.ID, ""); err != nil {
+		t.Fatalf("review: %v", err)
+	}
+	if err := manager.ResolveDispute(dispute.ID, false, "card present"); err != nil {
+		t.Fatalf("reject: %v", err)
+	}
+	if user.CurrentFunds != 300 {
+		t.Fatalf("balance %.2f after the rejection; want 300", user.CurrentFunds)
+	}
+
+	// Filing again would pay another provisional credit
+	if _, err := manager.OpenDispute(1, debit.ID, "really not me"); err == nil {
+		t.Error("a rejected dispute was filed again")
+	}
+	if user.CurrentFunds != 300 || len(manager.disputes) != 1 {
+		t.Errorf("balance %.2f with %d dispute(s); want 300 and 1", user.CurrentFunds, len(manager.disputes))
+	}
+
+	// The bank can still correct the debit itself
+	if err := manager.ReverseTransaction(1, debit.ID, "refunded by the branch"); err != nil {
+		t.Errorf("reverse after a rejected dispute: %v", err)
+	}
+}
@@ -1,3 +1,5 @@
 module main.go
 
 go 1.23.3
+
+require golang.org/x/crypto v0.23.0
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrIdempotencyConflict is returned when a key is reused for a different request
+var ErrIdempotencyConflict = errors.New("idempotency key already used for a different request")
+
+// ErrReservedIdempotencyKey is returned when a client key uses the
+// namespace kept for keys the bank generates itself
+var ErrReservedIdempotencyKey = errors.New("idempotency key uses a reserved prefix")
+
+// INTERNAL_KEY_PREFIX starts every key generated by the bank, such as
+// those of scheduled payments. Clients may not use it.
+const INTERNAL_KEY_PREFIX = "internal:"
+
+// DEFAULT_IDEMPOTENCY_WINDOW is how long a key is remembered by default
+const DEFAULT_IDEMPOTENCY_WINDOW = 24 * time.Hour
+
+// Idempotent operation names
+const (
+	OP_ADD_FUNDS    = "ADD_FUNDS"
+	OP_REMOVE_FUNDS = "REMOVE_FUNDS"
+	OP_TRANSFER     = "TRANSFER"
+)
+
+// OperationResult is the stored outcome of an operation performed under an
+// idempotency key. Replayed is set when the result was served from storage.
+type OperationResult struct {
+	Key            string
+	Operation      string
+	ProfileID      int
+	TargetID       int
+	Amount         float64
+	Balance        float64
+	TransactionIDs []int
+	CreatedAt      time.Time
+	Replayed       bool `json:"-"`
+}
+
+// SetIdempotencyWindow sets how long idempotency keys are retained
+func (fm *FinancialManager) SetIdempotencyWindow(window time.Duration) error {
+	if window <= 0 {
+		return errors.New("idempotency window must be positive")
+	}
+	fm.idempotencyWindow = window
+	return nil
+}
+
+// checkClientKey rejects client keys in the internal namespace
+func checkClientKey(key string) error {
+	if strings.HasPrefix(key, INTERNAL_KEY_PREFIX) {
+		return fmt.Errorf("%w (key %q)", ErrReservedIdempotencyKey, key)
+	}
+	return nil
+}
+
+// internalKey builds a key in the namespace reserved for the bank
+func internalKey(format string, args ...interface{}) string {
+	return INTERNAL_KEY_PREFIX + fmt.Sprintf(format, args...)
+}
+
+// scopedKey is the map key under which a profile's idempotency key is
+// stored, so two customers choosing the same key never collide
+func scopedKey(profileID int, key string) string {
+	return fmt.Sprintf("%d/%s", profileID, key)
+}
+
+// AddFundsOnce adds money under an idempotency key
+func (fm *FinancialManager) AddFundsOnce(key string, profileID int, amount float64) (*OperationResult, error) {
+	if err := checkClientKey(key); err != nil {
+		return nil, err
+	}
+	return fm.runOnce(key, OP_ADD_FUNDS, profileID, 0, amount, func() error {
+		return fm.AddFunds(profileID, amount)
+	})
+}
+
+// RemoveFundsOnce withdraws money under an idempotency key
+func (fm *FinancialManager) RemoveFundsOnce(key string, profileID int, amount float64) (*OperationResult, error) {
+	if err := checkClientKey(key); err != nil {
+		return nil, err
+	}
+	return fm.runOnce(key, OP_REMOVE_FUNDS, profileID, 0, amount, func() error {
+		return fm.RemoveFunds(profileID, amount)
+	})
+}
+
+// TransferFundsOnce moves money between accounts under an idempotency key
+func (fm *FinancialManager) TransferFundsOnce(key string, fromProfileID, toProfileID int, amount float64) (*OperationResult, error) {
+	if err := checkClientKey(key); err != nil {
+		return nil, err
+	}
+	return fm.runOnce(key, OP_TRANSFER, fromProfileID, toProfileID, amount, func() error {
+		return fm.TransferFunds(fromProfileID, toProfileID, amount)
+	})
+}
+
+// runOnce performs an operation unless the key has already been used, in
+// which case the original result is returned. Keys are scoped to the
+// profile performing the operation. Failed operations are not stored, so a
+// failed request can be retried with the same key.
+func (fm *FinancialManager) runOnce(key, operation string, profileID, targetID int, amount float64, perform func() error) (*OperationResult, error) {
+	if key == "" {
+		return nil, errors.New("idempotency key cannot be empty")
+	}
+
+	now := fm.clock.Now()
+	fm.purgeIdempotencyKeys(now)
+
+	stored := scopedKey(profileID, key)
+	if previous, exists := fm.idempotencyKeys[stored]; exists {
+		if previous.Operation != operation || previous.ProfileID != profileID ||
+			previous.TargetID != targetID || previous.Amount != amount {
+			return nil, fmt.Errorf("%w (key %q)", ErrIdempotencyConflict, key)
+		}
+		replay := *previous
+		replay.Replayed = true
+		return &replay, nil
+	}
+
+	result, err := fm.resultOf(operation, profileID, targetID, amount, perform)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Key = key
+	fm.idempotencyKeys[stored] = result
+	copied := *result
+	return &copied, nil
+}
+
+// resultOf performs an operation and describes the transactions it posted
+func (fm *FinancialManager) resultOf(operation string, profileID, targetID int, amount float64, perform func() error) (*OperationResult, error) {
+	firstID := fm.lastTransactionID + 1
+	if err := perform(); err != nil {
+		return nil, err
+	}
+
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &OperationResult{
+		Operation:      operation,
+		ProfileID:      profileID,
+		TargetID:       targetID,
+		Amount:         amount,
+		Balance:        user.CurrentFunds,
+		TransactionIDs: make([]int, 0),
+		CreatedAt:      fm.clock.Now(),
+	}
+	for id := firstID; id <= fm.lastTransactionID; id++ {
+		result.TransactionIDs = append(result.TransactionIDs, id)
+	}
+	return result, nil
+}
+
+// purgeIdempotencyKeys forgets keys older than the retention window
+func (fm *FinancialManager) purgeIdempotencyKeys(now time.Time) {
+	cutoff := now.Add(-fm.idempotencyWindow)
+	for key, result := range fm.idempotencyKeys {
+		if result.CreatedAt.Before(cutoff) {
+			delete(fm.idempotencyKeys, key)
+		}
+	}
+}
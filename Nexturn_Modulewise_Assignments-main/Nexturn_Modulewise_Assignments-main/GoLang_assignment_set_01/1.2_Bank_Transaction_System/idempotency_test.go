@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newIdempotencyTest returns a manager saving to a temporary file with
+// one funded account, and the clock it runs on
+func newIdempotencyTest(t *testing.T) (*FinancialManager, *manualClock, string) {
+	t.Helper()
+	t.Setenv(LEDGER_KEY_ENV, "")
+	path := filepath.Join(t.TempDir(), DATA_FILE)
+	clock := &manualClock{now: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+
+	manager := InitializeManager()
+	manager.SetClock(clock)
+	if err := manager.EnableStorage(path); err != nil {
+		t.Fatalf("enable storage: %v", err)
+	}
+	if _, err := manager.RegisterCustomer(1, "Holder", CURRENT_ACCOUNT, "1234"); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := manager.AddFunds(1, 1000); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	return manager, clock, path
+}
+
+// reload reads the saved data into a new manager on the same clock
+func reload(t *testing.T, clock *manualClock, path string) *FinancialManager {
+	t.Helper()
+	manager := InitializeManager()
+	manager.SetClock(clock)
+	if err := manager.EnableStorage(path); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	return manager
+}
+
+func TestIdempotencyKeysSurviveReload(t *testing.T) {
+	manager, clock, path := newIdempotencyTest(t)
+	if _, err := manager.RegisterCustomer(2, "Other", CURRENT_ACCOUNT, "1234"); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	first, err := manager.RemoveFundsOnce("rent", 1, 100)
+	if err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	reloaded := reload(t, clock, path)
+	replay, err := reloaded.RemoveFundsOnce("rent", 1, 100)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if !replay.Replayed || !reflect.DeepEqual(replay.TransactionIDs, first.TransactionIDs) || replay.Balance != 900 {
+		t.Errorf("replay after reload = %+v; want the stored result of %+v", replay, first)
+	}
+	if user, _ := reloaded.LocateUser(1); user.CurrentFunds != 900 {
+		t.Errorf("balance %.2f after the replay; want 900", user.CurrentFunds)
+	}
+
+	if _, err := reloaded.RemoveFundsOnce("rent", 1, 150); !errors.Is(err, ErrIdempotencyConflict) {
+		t.Errorf("reused key with another amount = %v; want a conflict", err)
+	}
+
+	// Keys stay scoped to the profile that used them
+	if err := reloaded.AddFunds(2, 500); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	other, err := reloaded.RemoveFundsOnce("rent", 2, 100)
+	if err != nil || other.Replayed {
+		t.Errorf("another profile's key after reload = %+v, %v; want a new withdrawal", other, err)
+	}
+}
+
+func TestIdempotencyKeysExpireAfterWindow(t *testing.T) {
+	manager, clock, path := newIdempotencyTest(t)
+	if err := manager.SetIdempotencyWindow(time.Hour); err != nil {
+		t.Fatalf("window: %v", err)
+	}
+	if _, err := manager.AddFundsOnce("salary", 1, 50); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	clock.Advance(time.Hour)
+	reloaded := reload(t, clock, path)
+	if err := reloaded.SetIdempotencyWindow(time.Hour); err != nil {
+		t.Fatalf("window: %v", err)
+	}
+	if result, err := reloaded.AddFundsOnce("salary", 1, 50); err != nil || !result.Replayed {
+		t.Fatalf("key at the end of its window = %+v, %v; want a replay", result, err)
+	}
+
+	clock.Advance(time.Second)
+	result, err := reloaded.AddFundsOnce("salary", 1, 50)
+	if err != nil || result.Replayed {
+		t.Fatalf("key past its window = %+v, %v; want a new deposit", result, err)
+	}
+	if user, _ := reloaded.LocateUser(1); user.CurrentFunds != 1100 {
+		t.Errorf("balance %.2f; want 1100 after two deposits of 50", user.CurrentFunds)
+	}
+
+	// An expired key is not written back
+	reloaded.idempotencyKeys[scopedKey(1, "stale")] = &OperationResult{
+		Key: "stale", Operation: OP_ADD_FUNDS, ProfileID: 1, CreatedAt: clock.Now().Add(-2 * time.Hour),
+	}
+	if err := reloaded.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if _, kept := reload(t, clock, path).idempotencyKeys[scopedKey(1, "stale")]; kept {
+		t.Error("expired key was saved")
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GENESIS_HASH is the previous hash of an account's first transaction
+const GENESIS_HASH = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// Ledger key settings. Transaction hashes are keyed with a secret kept out
+// of the data file, so editing the file cannot produce a valid chain. The
+// key is read from the environment variable if set, otherwise from the key
+// file beside the data file.
+const (
+	LEDGER_KEY_ENV   = "BANK_LEDGER_KEY"
+	LEDGER_KEY_FILE  = "bank_ledger.key"
+	LEDGER_KEY_BYTES = 32
+)
+
+// ErrLedgerKeyMissing is returned when stored data cannot be verified
+// because its ledger key is gone
+var ErrLedgerKeyMissing = errors.New("ledger key not found")
+
+// LedgerIssue describes the first entry of an account that fails reconciliation
+type LedgerIssue struct {
+	TransactionID int
+	Position      int
+	Problem       string
+}
+
+// ReconciliationReport is the outcome of checking one account's ledger
+type ReconciliationReport struct {
+	ProfileID     int
+	FullName      string
+	Transactions  int
+	RecordedFunds float64
+	ComputedFunds float64
+	Issue         *LedgerIssue
+}
+
+// OK reports whether the account's ledger and balance are consistent
+func (r ReconciliationReport) OK() bool {
+	return r.Issue == nil
+}
+
+// newLedgerKey generates a random ledger key
+func newLedgerKey() []byte {
+	key := make([]byte, LEDGER_KEY_BYTES)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("failed to generate ledger key: %v", err))
+	}
+	return key
+}
+
+// loadLedgerKey returns the key for the data file at dataPath. A missing
+// key file is only created when create is set, which is when there is no
+// data file yet whose history an unknown key would fail to verify.
+func loadLedgerKey(dataPath string, create bool) ([]byte, error) {
+	if key := os.Getenv(LEDGER_KEY_ENV); key != "" {
+		return []byte(key), nil
+	}
+
+	path := filepath.Join(filepath.Dir(dataPath), LEDGER_KEY_FILE)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) == 0 {
+			return nil, fmt.Errorf("invalid ledger key in %s", path)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read ledger key: %v", err)
+	}
+	if !create {
+		return nil, fmt.Errorf("%w: %s is needed to verify %s", ErrLedgerKeyMissing, path, dataPath)
+	}
+
+	key := newLedgerKey()
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write ledger key: %v", err)
+	}
+	return key, nil
+}
+
+// hashFields lists the parts of a transaction its hash covers
+func hashFields(profileID int, txn Transaction, prevHash string) []byte {
+	fields := []string{
+		strconv.Itoa(profileID),
+		strconv.Itoa(txn.ID),
+		txn.Type,
+		strconv.FormatFloat(txn.Amount, 'f', -1, 64),
+		strconv.FormatFloat(txn.Balance, 'f', -1, 64),
+		txn.Timestamp.UTC().Format(time.RFC3339Nano),
+		strconv.Itoa(txn.LinkedID),
+		prevHash,
+	}
+	return []byte(strings.Join(fields, "|"))
+}
+
+// transactionHash chains a transaction to the hash of the one before it
+// with an HMAC under the ledger key. Entries are never changed once
+// posted: links are set when an entry is posted and a reversal is a new
+// entry pointing back at the one it reverses.
+func (fm *FinancialManager) transactionHash(profileID int, txn Transaction, prevHash string) string {
+	mac := hmac.New(sha256.New, fm.ledgerKey)
+	mac.Write(hashFields(profileID, txn, prevHash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// lastHash returns the hash the next transaction of an account chains to
+func (user *UserAccount) lastHash() string {
+	if len(user.Transactions) == 0 {
+		return GENESIS_HASH
+	}
+	return user.Transactions[len(user.Transactions)-1].Hash
+}
+
+// ReconcileAccount recomputes an account's balance from its history and
+// verifies the hash chain, stopping at the first bad entry
+func (fm *FinancialManager) ReconcileAccount(profileID int) (ReconciliationReport, error) {
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return ReconciliationReport{}, err
+	}
+
+	report := ReconciliationReport{
+		ProfileID:     user.ProfileID,
+		FullName:      user.FullName,
+		Transactions:  len(user.Transactions),
+		RecordedFunds: roundAmount(user.CurrentFunds),
+	}
+
+	prevHash, prevID := GENESIS_HASH, 0
+	balance := 0.0
+	for i, txn := range user.Transactions {
+		issue := func(format string, args ...interface{}) ReconciliationReport {
+			report.Issue = &LedgerIssue{TransactionID: txn.ID, Position: i + 1, Problem: fmt.Sprintf(format, args...)}
+			report.ComputedFunds = balance
+			return report
+		}
+
+		if txn.ID <= prevID {
+			return issue("transaction ID %d is out of order after %d", txn.ID, prevID), nil
+		}
+		if txn.Hash == "" {
+			return issue("entry has no hash: it was added or altered outside the bank"), nil
+		}
+		if txn.PrevHash != prevHash {
+			return issue("chain broken: previous hash does not match the entry before it"), nil
+		}
+		if !hmac.Equal([]byte(txn.Hash), []byte(fm.transactionHash(user.ProfileID, txn, prevHash))) {
+			return issue("hash mismatch: the entry was modified after it was posted"), nil
+		}
+
+		balance = roundAmount(balance + txn.Amount)
+		if roundAmount(txn.Balance) != balance {
+			return issue("recorded balance %s does not match the running total %s",
+				user.money(txn.Balance), user.money(balance)), nil
+		}
+		prevHash, prevID = txn.Hash, txn.ID
+	}
+
+	report.ComputedFunds = balance
+	if report.RecordedFunds != balance {
+		report.Issue = &LedgerIssue{
+			Position: len(user.Transactions),
+			Problem: fmt.Sprintf("current funds %s do not match the history total %s",
+				user.money(report.RecordedFunds), user.money(balance)),
+		}
+	}
+	return report, nil
+}
+
+// Reconcile checks every account and returns one report per account
+func (fm *FinancialManager) Reconcile() []ReconciliationReport {
+	reports := make([]ReconciliationReport, 0, len(fm.users))
+	for _, user := range fm.users {
+		report, err := fm.ReconcileAccount(user.ProfileID)
+		if err != nil {
+			continue
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// WriteReconciliation prints reconciliation reports and returns the number
+// of accounts that failed
+func WriteReconciliation(w io.Writer, reports []ReconciliationReport) int {
+	failed := 0
+	for _, report := range reports {
+		if report.OK() {
+			fmt.Fprintf(w, "Profile %d (%s): OK, %d transaction(s), balance %.2f\n",
+				report.ProfileID, report.FullName, report.Transactions, report.ComputedFunds)
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(w, "Profile %d (%s): MISMATCH at entry %d", report.ProfileID, report.FullName, report.Issue.Position)
+		if report.Issue.TransactionID != 0 {
+			fmt.Fprintf(w, " (transaction %d)", report.Issue.TransactionID)
+		}
+		fmt.Fprintf(w, ": %s\n", report.Issue.Problem)
+	}
+	fmt.Fprintf(w, "%d account(s) checked, %d failed reconciliation\n", len(reports), failed)
+	return failed
+}
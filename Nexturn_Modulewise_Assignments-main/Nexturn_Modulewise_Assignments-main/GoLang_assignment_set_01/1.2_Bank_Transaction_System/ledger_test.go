@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newStoredLedger saves two accounts with a transfer between them to a
+// data file in a temporary directory and returns its path
+func newStoredLedger(t *testing.T) string {
+	t.Helper()
+	t.Setenv(LEDGER_KEY_ENV, "")
+	path := filepath.Join(t.TempDir(), DATA_FILE)
+
+	manager := InitializeManager()
+	manager.SetClock(&manualClock{now: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)})
+	if err := manager.EnableStorage(path); err != nil {
+		t.Fatalf("enable storage: %v", err)
+	}
+	for _, id := range []int{1, 2} {
+		if _, err := manager.RegisterCustomer(id, "Holder", CURRENT_ACCOUNT, "1234"); err != nil {
+			t.Fatalf("register %d: %v", id, err)
+		}
+	}
+	if err := manager.AddFunds(1, 500); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	if err := manager.TransferFunds(1, 2, 200); err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	return path
+}
+
+// loadLedger reads a data file into a fresh manager
+func loadLedger(t *testing.T, path string) (*FinancialManager, error) {
+	t.Helper()
+	manager := InitializeManager()
+	return manager, manager.EnableStorage(path)
+}
+
+// editSnapshot rewrites a data file through the given function
+func editSnapshot(t *testing.T, path string, edit func(state *snapshot)) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var state snapshot
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	edit(&state)
+	if data, err = json.Marshal(state); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+// reconcileIssue returns the issue reported for an account, if any
+func reconcileIssue(t *testing.T, manager *FinancialManager, profileID int) *LedgerIssue {
+	t.Helper()
+	report, err := manager.ReconcileAccount(profileID)
+	if err != nil {
+		t.Fatalf("reconcile %d: %v", profileID, err)
+	}
+	return report.Issue
+}
+
+func TestLedgerReloadsWithItsKey(t *testing.T) {
+	path := newStoredLedger(t)
+
+	manager, err := loadLedger(t, path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	for _, id := range []int{1, 2} {
+		if issue := reconcileIssue(t, manager, id); issue != nil {
+			t.Errorf("profile %d: %+v", id, issue)
+		}
+	}
+}
+
+func TestLedgerNeedsKeyOfCurrentFile(t *testing.T) {
+	path := newStoredLedger(t)
+	if err := os.Remove(filepath.Join(filepath.Dir(path), LEDGER_KEY_FILE)); err != nil {
+		t.Fatalf("remove key: %v", err)
+	}
+
+	if _, err := loadLedger(t, path); !errors.Is(err, ErrLedgerKeyMissing) {
+		t.Fatalf("load without the key: %v; want ErrLedgerKeyMissing", err)
+	}
+}
+
+func TestLedgerFlagsStrippedHashes(t *testing.T) {
+	path := newStoredLedger(t)
+	editSnapshot(t, path, func(state *snapshot) {
+		for i := range state.Users[0].Transactions {
+			state.Users[0].Transactions[i].PrevHash = ""
+			state.Users[0].Transactions[i].Hash = ""
+		}
+	})
+
+	manager, err := loadLedger(t, path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if issue := reconcileIssue(t, manager, 1); issue == nil {
+		t.Error("stripped hashes in a current file were re-chained instead of flagged")
+	}
+	if issue := reconcileIssue(t, manager, 2); issue != nil {
+		t.Errorf("untouched account flagged: %+v", issue)
+	}
+}
+
+func TestLedgerFlagsRechainedEdit(t *testing.T) {
+	path := newStoredLedger(t)
+	// A chain recomputed under a guessed key over an edited amount is what
+	// someone without the key could produce
+	forger := &FinancialManager{ledgerKey: []byte("guessed key")}
+	editSnapshot(t, path, func(state *snapshot) {
+		user := state.Users[0]
+		user.Transactions[0].Amount = 5000
+		prevHash := GENESIS_HASH
+		for i := range user.Transactions {
+			user.Transactions[i].PrevHash = prevHash
+			user.Transactions[i].Hash = forger.transactionHash(user.ProfileID, user.Transactions[i], prevHash)
+			prevHash = user.Transactions[i].Hash
+		}
+	})
+
+	manager, err := loadLedger(t, path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if issue := reconcileIssue(t, manager, 1); issue == nil {
+		t.Error("edited entry with a recomputed chain was not flagged")
+	}
+}
+
+func TestLedgerRefusesOtherSchemaVersions(t *testing.T) {
+	for _, version := range []int{0, CURRENT_SCHEMA_VERSION + 1} {
+		t.Run(strconv.Itoa(version), func(t *testing.T) {
+			path := newStoredLedger(t)
+			// Downgrading the file, dropping the hashes and inflating the
+			// history must not get the forged history signed on load
+			editSnapshot(t, path, func(state *snapshot) {
+				state.SchemaVersion = version
+				user := state.Users[0]
+				for i := range user.Transactions {
+					user.Transactions[i].Amount *= 16
+					user.Transactions[i].Balance *= 16
+					user.Transactions[i].PrevHash = ""
+					user.Transactions[i].Hash = ""
+				}
+				user.CurrentFunds *= 16
+			})
+			before, _ := os.ReadFile(path)
+
+			if _, err := loadLedger(t, path); err == nil || !strings.Contains(err.Error(), "schema version") {
+				t.Fatalf("load of schema version %d: %v; want it refused", version, err)
+			}
+			if after, _ := os.ReadFile(path); string(after) != string(before) {
+				t.Error("refused data file was rewritten")
+			}
+		})
+	}
+}
+
+func TestTransferLegsArePostedLinked(t *testing.T) {
+	path := newStoredLedger(t)
+	manager, err := loadLedger(t, path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	manager.SetClock(&manualClock{now: time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)})
+
+	sender, _ := manager.LocateUser(1)
+	receiver, _ := manager.LocateUser(2)
+	out := sender.Transactions[len(sender.Transactions)-1]
+	in := receiver.Transactions[len(receiver.Transactions)-1]
+	if out.Type != TRANSFER_OUT_TYPE || in.Type != TRANSFER_IN_TYPE || in.LinkedID != out.ID {
+		t.Fatalf("legs %+v and %+v are not linked", out, in)
+	}
+
+	if err := manager.ReverseTransaction(1, out.ID, "sent in error"); err != nil {
+		t.Fatalf("reverse: %v", err)
+	}
+	if sender.CurrentFunds != 500 || receiver.CurrentFunds != 0 {
+		t.Errorf("balances %.2f and %.2f after the reversal; want 500 and 0", sender.CurrentFunds, receiver.CurrentFunds)
+	}
+	if receiver.reversalOf(in.ID) == nil {
+		t.Error("incoming leg was not reversed with the outgoing one")
+	}
+	for _, id := range []int{1, 2} {
+		if issue := reconcileIssue(t, manager, id); issue != nil {
+			t.Errorf("profile %d after the reversal: %+v", id, issue)
+		}
+	}
+}
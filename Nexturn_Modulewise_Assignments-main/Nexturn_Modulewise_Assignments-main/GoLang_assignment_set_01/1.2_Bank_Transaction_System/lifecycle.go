@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Account lifecycle states
+const (
+	STATUS_ACTIVE  = "ACTIVE"
+	STATUS_FROZEN  = "FROZEN"
+	STATUS_DORMANT = "DORMANT"
+	STATUS_CLOSED  = "CLOSED"
+)
+
+// Lifecycle record types
+const (
+	STATUS_EVENT_TYPE   = "STATUS_CHANGE"
+	CLOSURE_PAYOUT_TYPE = "CLOSURE_PAYOUT"
+)
+
+// DORMANCY_PERIOD is how long an account may go without customer activity
+// before it becomes dormant
+const DORMANCY_PERIOD = 365 * 24 * time.Hour
+
+// Errors returned when an account's state does not allow an operation
+var (
+	ErrAccountFrozen  = errors.New("account is frozen")
+	ErrAccountDormant = errors.New("account is dormant")
+	ErrAccountClosed  = errors.New("account is closed")
+)
+
+// statusTransitions lists the states each state may move to
+var statusTransitions = map[string][]string{
+	STATUS_ACTIVE:  {STATUS_FROZEN, STATUS_DORMANT, STATUS_CLOSED},
+	STATUS_FROZEN:  {STATUS_ACTIVE},
+	STATUS_DORMANT: {STATUS_ACTIVE, STATUS_FROZEN, STATUS_CLOSED},
+	STATUS_CLOSED:  {},
+}
+
+// canTransition reports whether an account may move between two states
+func canTransition(from, to string) bool {
+	for _, allowed := range statusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// changeStatus moves an account to a new state and records it in the
+// account history
+func (fm *FinancialManager) changeStatus(user *UserAccount, status, reason string, at time.Time) error {
+	if !canTransition(user.Status, status) {
+		return fmt.Errorf("cannot change account %d from %s to %s", user.ProfileID, user.Status, status)
+	}
+
+	message := fmt.Sprintf("%s -> %s", user.Status, status)
+	if reason != "" {
+		message += " (" + reason + ")"
+	}
+	user.Status = status
+	fm.logEvent(user, STATUS_EVENT_TYPE, message, at)
+	return nil
+}
+
+// SetAccountStatus freezes or unfreezes an account on behalf of the bank.
+// Customers cannot call it: they may only wake a dormant account with
+// ReactivateAccount. Accounts become dormant on their own and are closed
+// with CloseAccount.
+func (fm *FinancialManager) SetAccountStatus(profileID int, status, reason string) error {
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return err
+	}
+
+	status = strings.ToUpper(status)
+	if status != STATUS_ACTIVE && status != STATUS_FROZEN {
+		return fmt.Errorf("account status can only be set to %s or %s", STATUS_ACTIVE, STATUS_FROZEN)
+	}
+	return fm.changeStatus(user, status, reason, fm.clock.Now())
+}
+
+// ReactivateAccount wakes a dormant account at its owner's request. A
+// frozen account stays frozen until the bank lifts it.
+func (fm *FinancialManager) ReactivateAccount(profileID int, reason string) error {
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return err
+	}
+
+	now := fm.clock.Now()
+	fm.updateDormancy(user, now)
+	switch user.Status {
+	case STATUS_DORMANT:
+		user.LastActivity = now
+		return fm.changeStatus(user, STATUS_ACTIVE, reason, now)
+	case STATUS_FROZEN:
+		return fmt.Errorf("%w (ID %d): only the bank can lift a freeze", ErrAccountFrozen, profileID)
+	case STATUS_CLOSED:
+		return fmt.Errorf("%w (ID %d)", ErrAccountClosed, profileID)
+	}
+	return fmt.Errorf("account %d is not dormant", profileID)
+}
+
+// checkStatus reports whether an account's state allows a credit or a debit
+func (fm *FinancialManager) checkStatus(user *UserAccount, debit bool) error {
+	now := fm.clock.Now()
+	fm.updateDormancy(user, now)
+
+	switch user.Status {
+	case STATUS_CLOSED:
+		return fmt.Errorf("%w (ID %d)", ErrAccountClosed, user.ProfileID)
+	case STATUS_FROZEN:
+		if debit {
+			return fmt.Errorf("%w (ID %d): debits are not allowed", ErrAccountFrozen, user.ProfileID)
+		}
+	case STATUS_DORMANT:
+		if debit {
+			return fmt.Errorf("%w (ID %d): make a deposit or ask for the account to be reactivated", ErrAccountDormant, user.ProfileID)
+		}
+	}
+	return nil
+}
+
+// checkOpen rejects corrections to a closed account. Unlike checkStatus
+// it allows frozen and dormant accounts, since corrections are made by
+// the bank rather than the customer.
+func (user *UserAccount) checkOpen() error {
+	if user.Status == STATUS_CLOSED {
+		return fmt.Errorf("%w (ID %d)", ErrAccountClosed, user.ProfileID)
+	}
+	return nil
+}
+
+// touch records customer activity on an account, waking it if dormant
+func (fm *FinancialManager) touch(user *UserAccount) {
+	now := fm.clock.Now()
+	user.LastActivity = now
+	if user.Status == STATUS_DORMANT {
+		fm.changeStatus(user, STATUS_ACTIVE, "customer activity", now)
+	}
+}
+
+// updateDormancy marks an active account dormant once it has been idle
+// for DORMANCY_PERIOD
+func (fm *FinancialManager) updateDormancy(user *UserAccount, now time.Time) {
+	if user.Status != STATUS_ACTIVE || user.LastActivity.IsZero() {
+		return
+	}
+	if now.Sub(user.LastActivity) >= DORMANCY_PERIOD {
+		fm.changeStatus(user, STATUS_DORMANT,
+			"no activity since "+user.LastActivity.Format(DATE_FORMAT), now)
+	}
+}
+
+// ProcessDormancy marks every idle account dormant
+func (fm *FinancialManager) ProcessDormancy() {
+	now := fm.clock.Now()
+	for _, user := range fm.users {
+		fm.updateDormancy(user, now)
+	}
+}
+
+// CloseAccount settles and closes an account. Interest accrued so far is
+// posted first; a positive balance is then paid out to payoutProfileID,
+// or in cash when it is zero. Overdrawn accounts and accounts with open
+// disputes cannot be closed. It returns the amount paid out.
+func (fm *FinancialManager) CloseAccount(profileID, payoutProfileID int) (float64, error) {
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return 0, err
+	}
+
+	now := fm.clock.Now()
+	fm.updateDormancy(user, now)
+	if !canTransition(user.Status, STATUS_CLOSED) {
+		return 0, fmt.Errorf("a %s account cannot be closed", strings.ToLower(user.Status))
+	}
+	for _, dispute := range fm.DisputesFor(profileID) {
+		if dispute.Status == DISPUTE_OPENED || dispute.Status == DISPUTE_UNDER_REVIEW {
+			return 0, fmt.Errorf("dispute %d must be resolved before the account is closed", dispute.ID)
+		}
+	}
+
+	for _, loan := range fm.LoansFor(profileID) {
+		if loan.Status == LOAN_ACTIVE {
+			return 0, fmt.Errorf("loan %d must be repaid before the account is closed", loan.ID)
+		}
+	}
+
+	var payee *UserAccount
+	if payoutProfileID != 0 {
+		if payoutProfileID == profileID {
+			return 0, errors.New("cannot pay out a closing account to itself")
+		}
+		if payee, err = fm.LocateUser(payoutProfileID); err != nil {
+			return 0, err
+		}
+		if err := fm.checkStatus(payee, false); err != nil {
+			return 0, err
+		}
+	}
+
+	fm.accrueInterest(user, startOfDay(now))
+	fm.postInterest(user, now)
+
+	payout := roundAmount(user.CurrentFunds)
+	if payout < 0 {
+		return 0, fmt.Errorf("the overdrawn balance of %s must be repaid before the account is closed", user.money(-payout))
+	}
+
+	if payout > 0 {
+		var converted, fee float64
+		if payee != nil && payee.Currency != user.Currency {
+			if converted, fee, err = fm.conversion(payout, user.Currency, payee.Currency); err != nil {
+				return 0, err
+			}
+		}
+
+		user.CurrentFunds = 0
+		note := "paid out in cash"
+		if payee != nil {
+			note = fmt.Sprintf("paid out to profile %d", payee.ProfileID)
+		}
+		outID := fm.recordLinkedActivity(user, CLOSURE_PAYOUT_TYPE, -payout, now, 0, note)
+
+		if payee != nil {
+			if payee.Currency != user.Currency {
+				fm.creditConverted(payee, payout, user.Currency, converted, fee, TRANSFER_IN_TYPE, outID)
+			} else {
+				fm.creditAccount(payee, payout, TRANSFER_IN_TYPE, outID)
+			}
+		}
+	}
+
+	// Standing instructions end with the account
+	for _, payment := range fm.PaymentsFor(profileID) {
+		if payment.Status == PAYMENT_ACTIVE {
+			payment.Status = PAYMENT_CANCELLED
+		}
+	}
+
+	return payout, fm.changeStatus(user, STATUS_CLOSED, "closed at customer request", now)
+}
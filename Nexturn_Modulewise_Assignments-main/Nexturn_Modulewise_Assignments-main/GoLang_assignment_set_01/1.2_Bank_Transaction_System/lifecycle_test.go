@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// newDormancyTest returns a manager with two funded accounts whose last
+// activity is the clock's starting time
+func newDormancyTest(t *testing.T) (*FinancialManager, *manualClock, *UserAccount, *UserAccount) {
+	t.Helper()
+	clock := &manualClock{now: time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)}
+	manager := InitializeManager()
+	manager.SetClock(clock)
+
+	var accounts []*UserAccount
+	for _, id := range []int{1, 2} {
+		user, err := manager.RegisterCustomer(id, "Holder", CURRENT_ACCOUNT, "1234")
+		if err != nil {
+			t.Fatalf("register %d: %v", id, err)
+		}
+		if err := manager.AddFunds(id, 1000); err != nil {
+			t.Fatalf("deposit %d: %v", id, err)
+		}
+		accounts = append(accounts, user)
+	}
+	return manager, clock, accounts[0], accounts[1]
+}
+
+func TestDormancyDetection(t *testing.T) {
+	manager, clock, idle, _ := newDormancyTest(t)
+
+	clock.Advance(DORMANCY_PERIOD - time.Second)
+	manager.ProcessDormancy()
+	if idle.Status != STATUS_ACTIVE {
+		t.Fatalf("status %s a second before the dormancy period ends; want %s", idle.Status, STATUS_ACTIVE)
+	}
+
+	clock.Advance(time.Second)
+	manager.ProcessDormancy()
+	if idle.Status != STATUS_DORMANT {
+		t.Fatalf("status %s once the dormancy period ends; want %s", idle.Status, STATUS_DORMANT)
+	}
+	if err := manager.RemoveFunds(1, 10); !errors.Is(err, ErrAccountDormant) {
+		t.Errorf("withdrawal from a dormant account = %v; want %v", err, ErrAccountDormant)
+	}
+	if err := manager.TransferFunds(1, 2, 10); !errors.Is(err, ErrAccountDormant) {
+		t.Errorf("transfer from a dormant account = %v; want %v", err, ErrAccountDormant)
+	}
+
+	// Debits are checked even before the periodic sweep has run
+	unswept, unsweptClock, _, _ := newDormancyTest(t)
+	unsweptClock.Advance(DORMANCY_PERIOD)
+	if err := unswept.RemoveFunds(1, 10); !errors.Is(err, ErrAccountDormant) {
+		t.Errorf("withdrawal after the dormancy period without a sweep = %v; want %v", err, ErrAccountDormant)
+	}
+}
+
+func TestIncomingTransferDoesNotWakeDormantAccount(t *testing.T) {
+	manager, clock, sender, receiver := newDormancyTest(t)
+	clock.Advance(DORMANCY_PERIOD / 2)
+	if err := manager.AddFunds(1, 100); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	lastActivity := receiver.LastActivity
+
+	clock.Advance(DORMANCY_PERIOD / 2)
+	if err := manager.TransferFunds(1, 2, 250); err != nil {
+		t.Fatalf("transfer into a dormant account: %v", err)
+	}
+	if receiver.Status != STATUS_DORMANT || !receiver.LastActivity.Equal(lastActivity) {
+		t.Errorf("receiver %s, last active %v; want it left %s since %v",
+			receiver.Status, receiver.LastActivity, STATUS_DORMANT, lastActivity)
+	}
+	if receiver.CurrentFunds != 1250 {
+		t.Errorf("receiver balance %.2f; want 1250", receiver.CurrentFunds)
+	}
+	if sender.Status != STATUS_ACTIVE || !sender.LastActivity.Equal(clock.Now()) {
+		t.Errorf("sender %s, last active %v; want %s at %v", sender.Status, sender.LastActivity, STATUS_ACTIVE, clock.Now())
+	}
+}
+
+func TestDormantAccountReactivation(t *testing.T) {
+	cases := []struct {
+		name     string
+		activity func(manager *FinancialManager) error
+	}{
+		{
+			name: "reactivated on request",
+			activity: func(manager *FinancialManager) error {
+				return manager.ReactivateAccount(1, "back from abroad")
+			},
+		},
+		{
+			name: "woken by a deposit",
+			activity: func(manager *FinancialManager) error {
+				return manager.AddFunds(1, 50)
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			manager, clock, user, _ := newDormancyTest(t)
+			clock.Advance(DORMANCY_PERIOD)
+			manager.ProcessDormancy()
+			if user.Status != STATUS_DORMANT {
+				t.Fatalf("status %s; want %s", user.Status, STATUS_DORMANT)
+			}
+
+			if err := tc.activity(manager); err != nil {
+				t.Fatalf("wake: %v", err)
+			}
+			if user.Status != STATUS_ACTIVE || !user.LastActivity.Equal(clock.Now()) {
+				t.Errorf("status %s, last active %v; want %s at %v", user.Status, user.LastActivity, STATUS_ACTIVE, clock.Now())
+			}
+			if err := manager.RemoveFunds(1, 10); err != nil {
+				t.Errorf("withdrawal after waking: %v", err)
+			}
+
+			// The period starts again from the new activity
+			clock.Advance(DORMANCY_PERIOD - time.Second)
+			manager.ProcessDormancy()
+			if user.Status != STATUS_ACTIVE {
+				t.Errorf("status %s before a new dormancy period has passed; want %s", user.Status, STATUS_ACTIVE)
+			}
+		})
+	}
+
+	manager, _, _, _ := newDormancyTest(t)
+	if err := manager.ReactivateAccount(1, ""); err == nil {
+		t.Error("an active account was reactivated")
+	}
+	if err := manager.SetAccountStatus(1, STATUS_FROZEN, "fraud check"); err != nil {
+		t.Fatalf("freeze: %v", err)
+	}
+	if err := manager.ReactivateAccount(1, ""); !errors.Is(err, ErrAccountFrozen) {
+		t.Errorf("reactivating a frozen account = %v; want %v", err, ErrAccountFrozen)
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Loan statuses
+const (
+	LOAN_ACTIVE = "ACTIVE"
+	LOAN_CLOSED = "CLOSED"
+)
+
+// Loan record types
+const (
+	LOAN_DISBURSAL_TYPE  = "LOAN_DISBURSAL"
+	LOAN_EMI_TYPE        = "LOAN_EMI"
+	LOAN_PREPAYMENT_TYPE = "LOAN_PREPAYMENT"
+	LOAN_EVENT_TYPE      = "LOAN"
+)
+
+// Ways a prepayment can be applied to the remaining schedule
+const (
+	PREPAY_REDUCE_EMI    = "REDUCE_EMI"
+	PREPAY_REDUCE_TENURE = "REDUCE_TENURE"
+)
+
+// MAX_LOAN_TENURE is the longest loan offered, in months
+const MAX_LOAN_TENURE = 360
+
+// DEFAULT_LOAN_RATE is the annual interest in percent loans are offered at
+// until the bank sets another rate
+const DEFAULT_LOAN_RATE = 10.5
+
+// ErrLoanNotFound is returned for an unknown loan ID
+var ErrLoanNotFound = errors.New("loan not found")
+
+// Installment is one monthly repayment of a loan
+type Installment struct {
+	Number    int
+	DueDate   time.Time
+	Amount    float64
+	Principal float64
+	Interest  float64
+	Balance   float64
+	PaidAt    time.Time
+	Missed    bool
+}
+
+// LoanPrepayment records an early repayment of principal
+type LoanPrepayment struct {
+	PaidAt time.Time
+	Amount float64
+	Mode   string
+}
+
+// Loan is an amortising loan repaid from a linked account
+type Loan struct {
+	ID           int
+	ProfileID    int
+	Principal    float64
+	AnnualRate   float64
+	TenureMonths int
+	DisbursedAt  time.Time
+	EMI          float64
+	Outstanding  float64
+	Status       string
+	Schedule     []Installment
+	Prepayments  []LoanPrepayment
+}
+
+// InstallmentRun records one attempt to collect an installment
+type InstallmentRun struct {
+	LoanID    int
+	Number    int
+	DueDate   time.Time
+	Succeeded bool
+	Error     string
+}
+
+// calculateEMI returns the fixed monthly installment that repays principal
+// with interest over the given number of months
+func calculateEMI(principal, annualRate float64, months int) float64 {
+	rate := annualRate / 12 / 100
+	if rate == 0 {
+		return roundAmount(principal / float64(months))
+	}
+	growth := math.Pow(1+rate, float64(months))
+	return roundAmount(principal * rate * growth / (growth - 1))
+}
+
+// tenureFor returns how many months an installment takes to repay principal
+func tenureFor(principal, annualRate, emi float64) int {
+	rate := annualRate / 12 / 100
+	if rate == 0 {
+		return int(math.Ceil(principal / emi))
+	}
+	return int(math.Ceil(-math.Log(1-principal*rate/emi) / math.Log(1+rate)))
+}
+
+// buildSchedule lays out monthly installments of emi against principal,
+// numbered from firstNumber and due monthly after from. The last
+// installment clears whatever principal is left.
+func buildSchedule(principal, annualRate, emi float64, months int, from time.Time, firstNumber int) []Installment {
+	rate := annualRate / 12 / 100
+	schedule := make([]Installment, 0, months)
+	balance := principal
+
+	for i := 1; i <= months && balance > 0; i++ {
+		interest := roundAmount(balance * rate)
+		repaid := roundAmount(emi - interest)
+		if i == months || repaid >= balance {
+			repaid = balance
+		}
+		balance = roundAmount(balance - repaid)
+
+		schedule = append(schedule, Installment{
+			Number:    firstNumber + i - 1,
+			DueDate:   addMonths(from, i),
+			Amount:    roundAmount(repaid + interest),
+			Principal: repaid,
+			Interest:  interest,
+			Balance:   balance,
+		})
+	}
+	return schedule
+}
+
+// SetLoanRate sets the annual rate new loans are offered at. It is a bank
+// setting: a borrower takes the rate on offer and existing loans keep the
+// rate they were opened at.
+func (fm *FinancialManager) SetLoanRate(annualRate float64) error {
+	if annualRate < 0 || annualRate > 100 {
+		return fmt.Errorf("invalid loan rate: %.2f%%", annualRate)
+	}
+	fm.loanRate = annualRate
+	return nil
+}
+
+// LoanRate returns the annual rate new loans are offered at
+func (fm *FinancialManager) LoanRate() float64 {
+	return fm.loanRate
+}
+
+// OpenLoan disburses a loan into an account at the rate on offer and
+// schedules its repayments
+func (fm *FinancialManager) OpenLoan(profileID int, principal float64, tenureMonths int) (*Loan, error) {
+	if principal <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if tenureMonths < 1 || tenureMonths > MAX_LOAN_TENURE {
+		return nil, fmt.Errorf("loan tenure must be between 1 and %d months", MAX_LOAN_TENURE)
+	}
+
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return nil, err
+	}
+	if err := fm.checkStatus(user, false); err != nil {
+		return nil, err
+	}
+
+	now := fm.clock.Now()
+	annualRate := fm.loanRate
+	emi := calculateEMI(principal, annualRate, tenureMonths)
+	fm.lastLoanID++
+	loan := &Loan{
+		ID:           fm.lastLoanID,
+		ProfileID:    profileID,
+		Principal:    principal,
+		AnnualRate:   annualRate,
+		TenureMonths: tenureMonths,
+		DisbursedAt:  now,
+		EMI:          emi,
+		Outstanding:  principal,
+		Status:       LOAN_ACTIVE,
+		Schedule:     buildSchedule(principal, annualRate, emi, tenureMonths, now, 1),
+		Prepayments:  make([]LoanPrepayment, 0),
+	}
+	fm.loans = append(fm.loans, loan)
+
+	fm.creditAccount(user, principal, LOAN_DISBURSAL_TYPE, 0)
+	fm.touch(user)
+	fm.logEvent(user, LOAN_EVENT_TYPE, fmt.Sprintf("loan %d opened: %s at %.2f%% for %d months, EMI %s",
+		loan.ID, user.money(principal), annualRate, tenureMonths, user.money(emi)), now)
+	return loan, nil
+}
+
+// Arrears returns the total of installments that were missed and are
+// still unpaid
+func (loan *Loan) Arrears() float64 {
+	arrears := 0.0
+	for _, installment := range loan.Schedule {
+		if installment.Missed && installment.PaidAt.IsZero() {
+			arrears += installment.Amount
+		}
+	}
+	return roundAmount(arrears)
+}
+
+// paidInstallments counts the installments already paid
+func (loan *Loan) paidInstallments() int {
+	paid := 0
+	for _, installment := range loan.Schedule {
+		if !installment.PaidAt.IsZero() {
+			paid++
+		}
+	}
+	return paid
+}
+
+// nextInstallment returns the first unpaid installment, or nil
+func (loan *Loan) nextInstallment() *Installment {
+	for i := range loan.Schedule {
+		if loan.Schedule[i].PaidAt.IsZero() {
+			return &loan.Schedule[i]
+		}
+	}
+	return nil
+}
+
+// RunLoanInstallments debits every installment that has fallen due from
+// the linked accounts, oldest first. An installment that cannot be
+// collected is marked missed and counts as arrears until a later run
+// collects it. It returns the collections attempted.
+func (fm *FinancialManager) RunLoanInstallments() []InstallmentRun {
+	now := fm.clock.Now()
+	runs := make([]InstallmentRun, 0)
+
+	for _, loan := range fm.loans {
+		if loan.Status != LOAN_ACTIVE {
+			continue
+		}
+		user, err := fm.LocateUser(loan.ProfileID)
+		if err != nil {
+			continue
+		}
+
+		for installment := loan.nextInstallment(); installment != nil && !installment.DueDate.After(now); installment = loan.nextInstallment() {
+			run := InstallmentRun{LoanID: loan.ID, Number: installment.Number, DueDate: installment.DueDate}
+			err := fm.checkStatus(user, true)
+			if err == nil {
+				_, err = fm.debitAccount(user, installment.Amount, LOAN_EMI_TYPE)
+			}
+
+			if err != nil {
+				run.Error = err.Error()
+				runs = append(runs, run)
+				if !installment.Missed {
+					installment.Missed = true
+					fm.logEvent(user, LOAN_EVENT_TYPE, fmt.Sprintf("installment %d of loan %d missed: %v",
+						installment.Number, loan.ID, err), now)
+				}
+				break
+			}
+
+			run.Succeeded = true
+			runs = append(runs, run)
+			installment.PaidAt = now
+			loan.Outstanding = roundAmount(loan.Outstanding - installment.Principal)
+			if loan.nextInstallment() == nil {
+				loan.Status = LOAN_CLOSED
+				fm.logEvent(user, LOAN_EVENT_TYPE, fmt.Sprintf("loan %d repaid in full", loan.ID), now)
+			}
+		}
+	}
+	return runs
+}
+
+// PrepayLoan pays down a loan's principal early from the linked account.
+// The remaining schedule is recalculated either with a lower EMI over the
+// same number of months or with the same EMI over fewer months. Paying
+// the whole outstanding principal closes the loan. Only the borrower can
+// prepay; another profile's loan is reported as not found.
+func (fm *FinancialManager) PrepayLoan(profileID, loanID int, amount float64, mode string) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	mode = strings.ToUpper(mode)
+	if mode != PREPAY_REDUCE_EMI && mode != PREPAY_REDUCE_TENURE {
+		return fmt.Errorf("invalid prepayment mode: %s", mode)
+	}
+
+	loan, user, err := fm.locateLoan(profileID, loanID)
+	if err != nil {
+		return err
+	}
+	if loan.Status != LOAN_ACTIVE {
+		return fmt.Errorf("loan %d is already closed", loanID)
+	}
+	if arrears := loan.Arrears(); arrears > 0 {
+		return fmt.Errorf("arrears of %s must be cleared before prepaying", user.money(arrears))
+	}
+	if next := loan.nextInstallment(); next != nil && !next.DueDate.After(fm.clock.Now()) {
+		return fmt.Errorf("installment %d is due and must be collected before prepaying", next.Number)
+	}
+	if err := fm.checkStatus(user, true); err != nil {
+		return err
+	}
+
+	if amount > loan.Outstanding {
+		amount = loan.Outstanding
+	}
+	if _, err := fm.debitAccount(user, amount, LOAN_PREPAYMENT_TYPE); err != nil {
+		return err
+	}
+
+	now := fm.clock.Now()
+	loan.Outstanding = roundAmount(loan.Outstanding - amount)
+	loan.Prepayments = append(loan.Prepayments, LoanPrepayment{PaidAt: now, Amount: amount, Mode: mode})
+
+	// Keep the installments already paid and lay out the rest again
+	paid := make([]Installment, 0, len(loan.Schedule))
+	remaining := 0
+	from := loan.DisbursedAt
+	for _, installment := range loan.Schedule {
+		if installment.PaidAt.IsZero() {
+			remaining++
+			continue
+		}
+		paid = append(paid, installment)
+		from = installment.DueDate
+	}
+
+	if loan.Outstanding <= 0 {
+		loan.Schedule = paid
+		loan.Status = LOAN_CLOSED
+		fm.logEvent(user, LOAN_EVENT_TYPE, fmt.Sprintf("loan %d settled early with %s", loan.ID, user.money(amount)), now)
+		return nil
+	}
+
+	if mode == PREPAY_REDUCE_EMI {
+		loan.EMI = calculateEMI(loan.Outstanding, loan.AnnualRate, remaining)
+	} else {
+		remaining = tenureFor(loan.Outstanding, loan.AnnualRate, loan.EMI)
+	}
+	loan.Schedule = append(paid, buildSchedule(loan.Outstanding, loan.AnnualRate, loan.EMI, remaining, from, len(paid)+1)...)
+
+	fm.logEvent(user, LOAN_EVENT_TYPE, fmt.Sprintf("loan %d prepaid by %s: %d installment(s) of %s remain",
+		loan.ID, user.money(amount), len(loan.Schedule)-len(paid), user.money(loan.EMI)), now)
+	return nil
+}
+
+// locateLoan finds one of a profile's loans and the account it is linked
+// to. A loan of another profile is not found, so its ID reveals nothing.
+func (fm *FinancialManager) locateLoan(profileID, loanID int) (*Loan, *UserAccount, error) {
+	for _, loan := range fm.loans {
+		if loan.ID != loanID || loan.ProfileID != profileID {
+			continue
+		}
+		user, err := fm.LocateUser(loan.ProfileID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return loan, user, nil
+	}
+	return nil, nil, fmt.Errorf("%w (ID %d)", ErrLoanNotFound, loanID)
+}
+
+// LoansFor returns the loans linked to a profile
+func (fm *FinancialManager) LoansFor(profileID int) []*Loan {
+	loans := make([]*Loan, 0)
+	for _, loan := range fm.loans {
+		if loan.ProfileID == profileID {
+			loans = append(loans, loan)
+		}
+	}
+	return loans
+}
+
+// ShowLoans displays a user's loans and their repayment schedules
+func (fm *FinancialManager) ShowLoans(profileID int) {
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	loans := fm.LoansFor(profileID)
+	if len(loans) == 0 {
+		fmt.Println("No loans found.")
+		return
+	}
+
+	for _, loan := range loans {
+		fmt.Printf("\nLoan #%d [%s]: %s at %.2f%% for %d months\n",
+			loan.ID, loan.Status, user.money(loan.Principal), loan.AnnualRate, loan.TenureMonths)
+		fmt.Printf("EMI: %s  Outstanding: %s  Arrears: %s\n",
+			user.money(loan.EMI), user.money(loan.Outstanding), user.money(loan.Arrears()))
+		fmt.Println("----------------------------------------")
+		for _, installment := range loan.Schedule {
+			status := "DUE"
+			switch {
+			case !installment.PaidAt.IsZero():
+				status = "PAID"
+			case installment.Missed:
+				status = "MISSED"
+			}
+			fmt.Printf("%3d  %s  %12.2f  principal %10.2f  interest %9.2f  balance %12.2f  %s\n",
+				installment.Number, installment.DueDate.Format(DATE_FORMAT), installment.Amount,
+				installment.Principal, installment.Interest, installment.Balance, status)
+		}
+	}
+}
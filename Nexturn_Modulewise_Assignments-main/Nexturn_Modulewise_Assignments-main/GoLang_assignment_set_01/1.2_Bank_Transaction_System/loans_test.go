@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newLoanTest opens a loan on a current account, which earns no interest,
+// so balances only move with the loan
+func newLoanTest(t *testing.T, principal, annualRate float64, months int) (*FinancialManager, *manualClock, *UserAccount, *Loan) {
+	t.Helper()
+	clock := &manualClock{now: time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)}
+	manager := InitializeManager()
+	manager.SetClock(clock)
+	user, err := manager.RegisterCustomer(1, "Borrower", CURRENT_ACCOUNT, "1234")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := manager.SetLoanRate(annualRate); err != nil {
+		t.Fatalf("set loan rate: %v", err)
+	}
+	loan, err := manager.OpenLoan(1, principal, months)
+	if err != nil {
+		t.Fatalf("open loan: %v", err)
+	}
+	return manager, clock, user, loan
+}
+
+// checkSchedule verifies that a schedule repays exactly principal and ends
+// with nothing outstanding
+func checkSchedule(t *testing.T, schedule []Installment, principal float64) {
+	t.Helper()
+	repaid := 0.0
+	for _, installment := range schedule {
+		if installment.Amount != roundAmount(installment.Principal+installment.Interest) {
+			t.Errorf("installment %d: amount %.2f is not principal %.2f plus interest %.2f",
+				installment.Number, installment.Amount, installment.Principal, installment.Interest)
+		}
+		repaid += installment.Principal
+	}
+	if roundAmount(repaid) != principal {
+		t.Errorf("schedule repays %.2f of principal; want %.2f", repaid, principal)
+	}
+	if last := schedule[len(schedule)-1]; last.Balance != 0 {
+		t.Errorf("last installment leaves %.2f outstanding", last.Balance)
+	}
+}
+
+func TestCalculateEMI(t *testing.T) {
+	cases := []struct {
+		principal  float64
+		annualRate float64
+		months     int
+		want       float64
+	}{
+		{principal: 100000, annualRate: 12, months: 12, want: 8884.88},
+		{principal: 500000, annualRate: 9, months: 60, want: 10379.18},
+		{principal: 250000, annualRate: 10.5, months: 36, want: 8125.61},
+		{principal: 1200, annualRate: 0, months: 12, want: 100},
+	}
+
+	for _, tc := range cases {
+		if got := calculateEMI(tc.principal, tc.annualRate, tc.months); got != tc.want {
+			t.Errorf("calculateEMI(%.2f, %.2f, %d) = %.2f; want %.2f", tc.principal, tc.annualRate, tc.months, got, tc.want)
+		}
+	}
+}
+
+func TestLoanSchedule(t *testing.T) {
+	cases := []struct {
+		name       string
+		principal  float64
+		annualRate float64
+		months     int
+		first      Installment
+		lastAmount float64
+	}{
+		{
+			name: "with interest", principal: 100000, annualRate: 12, months: 12,
+			first:      Installment{Amount: 8884.88, Principal: 7884.88, Interest: 1000, Balance: 92115.12},
+			lastAmount: 8884.85,
+		},
+		{
+			name: "interest free", principal: 1000, annualRate: 0, months: 3,
+			first:      Installment{Amount: 333.33, Principal: 333.33, Interest: 0, Balance: 666.67},
+			lastAmount: 333.34,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, _, loan := newLoanTest(t, tc.principal, tc.annualRate, tc.months)
+			if len(loan.Schedule) != tc.months {
+				t.Fatalf("%d installments; want %d", len(loan.Schedule), tc.months)
+			}
+			first := loan.Schedule[0]
+			if first.Amount != tc.first.Amount || first.Principal != tc.first.Principal ||
+				first.Interest != tc.first.Interest || first.Balance != tc.first.Balance {
+				t.Errorf("first installment %+v; want %+v", first, tc.first)
+			}
+			if want := time.Date(2024, 2, 15, 10, 0, 0, 0, time.UTC); !first.DueDate.Equal(want) {
+				t.Errorf("first installment due %v; want %v", first.DueDate, want)
+			}
+			if last := loan.Schedule[len(loan.Schedule)-1]; last.Amount != tc.lastAmount {
+				t.Errorf("last installment %.2f; want %.2f", last.Amount, tc.lastAmount)
+			}
+			checkSchedule(t, loan.Schedule, tc.principal)
+		})
+	}
+}
+
+func TestLoanArrears(t *testing.T) {
+	manager, clock, user, loan := newLoanTest(t, 1200, 0, 12)
+	if err := manager.RemoveFunds(1, 1200); err != nil {
+		t.Fatalf("spend the loan: %v", err)
+	}
+
+	clock.Advance(31 * 24 * time.Hour) // past the first due date
+	runs := manager.RunLoanInstallments()
+	if len(runs) != 1 || runs[0].Succeeded {
+		t.Fatalf("runs %+v; want one failed collection", runs)
+	}
+	if arrears := loan.Arrears(); arrears != 100 {
+		t.Errorf("arrears %.2f; want 100", arrears)
+	}
+	if err := manager.PrepayLoan(1, loan.ID, 50, PREPAY_REDUCE_EMI); err == nil {
+		t.Error("prepaid a loan in arrears")
+	}
+
+	// A later run collects the missed installment along with the next one
+	if err := manager.AddFunds(1, 300); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	clock.Advance(29 * 24 * time.Hour) // past the second due date
+	runs = manager.RunLoanInstallments()
+	if len(runs) != 2 || !runs[0].Succeeded || !runs[1].Succeeded {
+		t.Fatalf("runs %+v; want two collections", runs)
+	}
+	if arrears := loan.Arrears(); arrears != 0 {
+		t.Errorf("arrears %.2f after catching up; want 0", arrears)
+	}
+	if loan.Outstanding != 1000 || user.CurrentFunds != 100 {
+		t.Errorf("outstanding %.2f, balance %.2f; want 1000 and 100", loan.Outstanding, user.CurrentFunds)
+	}
+}
+
+func TestLoanPrepayment(t *testing.T) {
+	cases := []struct {
+		mode         string
+		installments int     // left after the prepayment
+		emi          float64 // after the prepayment
+		lastAmount   float64
+	}{
+		{mode: PREPAY_REDUCE_EMI, installments: 11, emi: 6955.80},
+		{mode: PREPAY_REDUCE_TENURE, installments: 9, emi: 8884.88, lastAmount: 4517.88},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.mode, func(t *testing.T) {
+			manager, clock, _, loan := newLoanTest(t, 100000, 12, 12)
+			clock.Advance(31 * 24 * time.Hour)
+			manager.RunLoanInstallments()
+			if loan.Outstanding != 92115.12 {
+				t.Fatalf("outstanding %.2f after the first installment; want 92115.12", loan.Outstanding)
+			}
+
+			if err := manager.PrepayLoan(1, loan.ID, 20000, tc.mode); err != nil {
+				t.Fatalf("prepay: %v", err)
+			}
+			if loan.Outstanding != 72115.12 || loan.EMI != tc.emi {
+				t.Errorf("outstanding %.2f, EMI %.2f; want 72115.12 and %.2f", loan.Outstanding, loan.EMI, tc.emi)
+			}
+
+			remaining := loan.Schedule[1:]
+			if len(remaining) != tc.installments {
+				t.Fatalf("%d installments left; want %d", len(remaining), tc.installments)
+			}
+			if remaining[0].Number != 2 || !remaining[0].DueDate.Equal(time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)) {
+				t.Errorf("next installment %+v; want number 2 due 2024-03-15", remaining[0])
+			}
+			if tc.lastAmount != 0 && remaining[len(remaining)-1].Amount != tc.lastAmount {
+				t.Errorf("last installment %.2f; want %.2f", remaining[len(remaining)-1].Amount, tc.lastAmount)
+			}
+			checkSchedule(t, remaining, 72115.12)
+		})
+	}
+}
+
+func TestLoanSettledByPrepayment(t *testing.T) {
+	manager, _, user, loan := newLoanTest(t, 1200, 0, 12)
+
+	if err := manager.PrepayLoan(1, loan.ID, 5000, PREPAY_REDUCE_TENURE); err != nil {
+		t.Fatalf("prepay: %v", err)
+	}
+	if loan.Status != LOAN_CLOSED || loan.Outstanding != 0 || len(loan.Schedule) != 0 {
+		t.Errorf("loan %+v was not settled", loan)
+	}
+	// Only the outstanding principal is taken
+	if user.CurrentFunds != 0 {
+		t.Errorf("balance %.2f; want 0", user.CurrentFunds)
+	}
+}
+
+func TestLoanRateIsSetByTheBank(t *testing.T) {
+	manager, _, _, loan := newLoanTest(t, 1200, 6, 12)
+	if loan.AnnualRate != 6 {
+		t.Fatalf("loan opened at %.2f%%; want the 6%% on offer", loan.AnnualRate)
+	}
+
+	for _, rate := range []float64{-1, 100.5} {
+		if err := manager.SetLoanRate(rate); err == nil {
+			t.Errorf("rate %.2f%% accepted", rate)
+		}
+	}
+	if err := manager.SetLoanRate(9); err != nil {
+		t.Fatalf("set loan rate: %v", err)
+	}
+	if loan.AnnualRate != 6 {
+		t.Errorf("existing loan moved to %.2f%%; want it kept at 6%%", loan.AnnualRate)
+	}
+	next, err := manager.OpenLoan(1, 1200, 12)
+	if err != nil || next.AnnualRate != 9 {
+		t.Fatalf("OpenLoan() = %+v, %v; want a loan at 9%%", next, err)
+	}
+
+	// The rate is saved with the account data
+	t.Setenv(LEDGER_KEY_ENV, "")
+	path := filepath.Join(t.TempDir(), DATA_FILE)
+	if err := manager.EnableStorage(path); err != nil {
+		t.Fatalf("enable storage: %v", err)
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	reloaded := InitializeManager()
+	if err := reloaded.EnableStorage(path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if rate := reloaded.LoanRate(); rate != 9 {
+		t.Errorf("reloaded loan rate %.2f%%; want 9%%", rate)
+	}
+}
+
+func TestLoanPrepaidOnlyByBorrower(t *testing.T) {
+	manager, _, borrower, loan := newLoanTest(t, 1200, 0, 12)
+	other, err := manager.RegisterCustomer(2, "Other", CURRENT_ACCOUNT, "1234")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := manager.AddFunds(2, 5000); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+
+	if err := manager.PrepayLoan(2, loan.ID, 5000, PREPAY_REDUCE_TENURE); !errors.Is(err, ErrLoanNotFound) {
+		t.Fatalf("prepaying another profile's loan: %v; want ErrLoanNotFound", err)
+	}
+	if loan.Status != LOAN_ACTIVE || loan.Outstanding != 1200 {
+		t.Errorf("loan %+v changed by another profile", loan)
+	}
+	if other.CurrentFunds != 5000 || borrower.CurrentFunds != 1200 {
+		t.Errorf("balances %.2f and %.2f; want 5000 and 1200 untouched", other.CurrentFunds, borrower.CurrentFunds)
+	}
+}
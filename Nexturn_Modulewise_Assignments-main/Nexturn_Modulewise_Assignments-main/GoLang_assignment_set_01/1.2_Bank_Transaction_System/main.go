@@ -3,40 +3,164 @@ package main
 import (
 	"bufio"
 	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Welcome menu constants
+const (
+	REGISTER_PROFILE = 1
+	LOGIN_PROFILE    = 2
+	EXIT_SYSTEM      = 3
+)
+
 // Action constants
 const (
-	ADD_FUNDS     = 1
-	REMOVE_FUNDS  = 2
-	CHECK_FUNDS   = 3
-	VIEW_LOGS     = 4
-	QUIT_SYSTEM   = 5
+	ADD_FUNDS      = 1
+	REMOVE_FUNDS   = 2
+	TRANSFER_FUNDS = 3
+	CHECK_FUNDS    = 4
+	VIEW_LOGS      = 5
+	GET_STATEMENT  = 6
+	VIEW_BLOCKED   = 7
+	SCHEDULE_MENU  = 8
+	DISPUTES_MENU  = 9
+	ACCOUNT_STATUS = 10
+	LOANS_MENU     = 11
+	ALERTS_MENU    = 12
+	SWITCH_ACCOUNT = 13
+	LOGOUT_SESSION = 14
+	QUIT_SYSTEM    = 15
+)
+
+// Scheduled payment menu constants
+const (
+	LIST_PAYMENTS   = 1
+	CREATE_PAYMENT  = 2
+	CANCEL_PAYMENT  = 3
+	BACK_TO_ACCOUNT = 4
+)
+
+// Dispute menu constants
+const (
+	LIST_DISPUTES    = 1
+	OPEN_DISPUTE     = 2
+	BACK_TO_SERVICES = 3
+)
+
+// Loan menu constants
+const (
+	LIST_LOANS      = 1
+	APPLY_LOAN      = 2
+	PREPAY_LOAN     = 3
+	BACK_FROM_LOANS = 4
+)
+
+// Alert menu constants
+const (
+	LIST_ALERTS      = 1
+	ADD_ALERT        = 2
+	REMOVE_ALERT     = 3
+	BACK_FROM_ALERTS = 4
+)
+
+// Account status menu constants
+const (
+	REACTIVATE_ACCOUNT = 1
+	CLOSE_ACCOUNT      = 2
+	BACK_FROM_STATUS   = 3
 )
 
+// STATEMENT_DIR is where the menu writes generated statements
+const STATEMENT_DIR = "statements"
+
 // Record types
 const (
 	ADD_FUNDS_TYPE   = "ADD_FUNDS"
 	REMOVE_FUNDS_TYPE = "REMOVE_FUNDS"
+	TRANSFER_IN_TYPE  = "TRANSFER_IN"
+	TRANSFER_OUT_TYPE = "TRANSFER_OUT"
+)
+
+// Errors callers can check for with errors.Is
+var (
+	ErrProfileNotFound   = errors.New("profile not found")
+	ErrProfileExists     = errors.New("profile already exists")
+	ErrInvalidAmount     = errors.New("amount must be greater than zero")
+	ErrInsufficientFunds = errors.New("insufficient funds")
 )
 
+// TIMESTAMP_FORMAT is used for every activity log entry
+const TIMESTAMP_FORMAT = "2006-01-02 15:04:05"
+
+// Transaction is a structured record of a single posting.
+// Debits carry a negative Amount; Balance is the funds after posting.
+// LinkedID points back to the earlier transaction an entry belongs to:
+// the outgoing leg of a transfer, the entry a reversal corrects or the
+// debit a fee or dispute credit relates to. Entries are never changed
+// once posted.
+type Transaction struct {
+	ID        int
+	Type      string
+	Amount    float64
+	Balance   float64
+	Timestamp time.Time
+	LinkedID  int
+	PrevHash  string
+	Hash      string
+}
+
 // UserAccount represents a user's bank account
 type UserAccount struct {
 	ProfileID      int
 	FullName       string
+	AccountType    string
+	Currency       string
+	Status         string
+	LastActivity   time.Time
 	CurrentFunds   float64
+	InterestRate   float64
+	AccruedInterest float64
+	LastAccrual    time.Time
+	OverdraftLimit float64
 	ActivityLog    []string
+	Transactions   []Transaction
+	BlockedAttempts []BlockedAttempt
+	PINHash        string
+	FailedLogins   int
+	LockedUntil    time.Time
 }
 
 // FinancialManager handles bank operations
 type FinancialManager struct {
 	users          []*UserAccount
 	inputReader    *bufio.Scanner
+	session        *Session
+	clock          Clock
+	lastTransactionID int
+	withdrawalRules []WithdrawalRule
+	idempotencyKeys map[string]*OperationResult
+	idempotencyWindow time.Duration
+	dataFile       string
+	scheduledPayments []*ScheduledPayment
+	lastPaymentID  int
+	rates          *ExchangeRates
+	disputes       []*Dispute
+	lastDisputeID  int
+	loans          []*Loan
+	lastLoanID     int
+	loanRate       float64
+	alertRules     []*AlertRule
+	lastAlertRuleID int
+	alerts         *AlertDispatcher
+	allowInternalWebhooks bool
+	ledgerKey      []byte
+	mu             sync.Mutex
 }
 
 // InitializeManager creates a new instance of FinancialManager
@@ -44,6 +168,13 @@ func InitializeManager() *FinancialManager {
 	return &FinancialManager{
 		users:       make([]*UserAccount, 0),
 		inputReader: bufio.NewScanner(os.Stdin),
+		clock:       systemClock{},
+		withdrawalRules: DefaultWithdrawalRules(),
+		idempotencyKeys: make(map[string]*OperationResult),
+		idempotencyWindow: DEFAULT_IDEMPOTENCY_WINDOW,
+		rates:       defaultExchangeRates(),
+		loanRate:    DEFAULT_LOAN_RATE,
+		ledgerKey:   newLedgerKey(),
 	}
 }
 
@@ -51,21 +182,38 @@ func InitializeManager() *FinancialManager {
 func (fm *FinancialManager) RegisterUser(profileID int, fullName string) (*UserAccount, error) {
 	for _, user := range fm.users {
 		if user.ProfileID == profileID {
-			return nil, fmt.Errorf("profile with ID %d already exists", profileID)
+			return nil, fmt.Errorf("%w (ID %d)", ErrProfileExists, profileID)
 		}
 	}
 
 	newUser := &UserAccount{
 		ProfileID:    profileID,
 		FullName:     fullName,
+		AccountType:  SAVINGS_ACCOUNT,
+		Currency:     fm.rates.Base,
+		Status:       STATUS_ACTIVE,
+		LastActivity: fm.clock.Now(),
 		CurrentFunds: 0,
+		InterestRate: DEFAULT_SAVINGS_RATE,
+		LastAccrual:  startOfDay(fm.clock.Now()),
 		ActivityLog:  make([]string, 0),
+		Transactions: make([]Transaction, 0),
 	}
 
 	fm.users = append(fm.users, newUser)
 	return newUser, nil
 }
 
+// removeUser deletes a user account by ProfileID
+func (fm *FinancialManager) removeUser(profileID int) {
+	for i, user := range fm.users {
+		if user.ProfileID == profileID {
+			fm.users = append(fm.users[:i], fm.users[i+1:]...)
+			return
+		}
+	}
+}
+
 // LocateUser retrieves a user account by ProfileID
 func (fm *FinancialManager) LocateUser(profileID int) (*UserAccount, error) {
 	for _, user := range fm.users {
@@ -73,48 +221,196 @@ func (fm *FinancialManager) LocateUser(profileID int) (*UserAccount, error) {
 			return user, nil
 		}
 	}
-	return nil, fmt.Errorf("profile with ID %d not found", profileID)
+	return nil, fmt.Errorf("%w (ID %d)", ErrProfileNotFound, profileID)
 }
 
 // AddFunds adds money to a user account
 func (fm *FinancialManager) AddFunds(profileID int, amount float64) error {
 	if amount <= 0 {
-		return errors.New("amount must be greater than zero")
+		return ErrInvalidAmount
 	}
 
 	user, err := fm.LocateUser(profileID)
 	if err != nil {
 		return err
 	}
+	if err := fm.checkStatus(user, false); err != nil {
+		return err
+	}
 
-	user.CurrentFunds += amount
-	logEntry := fmt.Sprintf("%s: +Rs.%.2f (Funds: Rs.%.2f) - %s",
-		ADD_FUNDS_TYPE, amount, user.CurrentFunds, time.Now().Format("2006-01-02 15:04:05"))
-	user.ActivityLog = append(user.ActivityLog, logEntry)
-
+	fm.creditAccount(user, amount, ADD_FUNDS_TYPE, 0)
+	fm.touch(user)
 	return nil
 }
 
 // RemoveFunds withdraws money from a user account
 func (fm *FinancialManager) RemoveFunds(profileID int, amount float64) error {
 	if amount <= 0 {
-		return errors.New("amount must be greater than zero")
+		return ErrInvalidAmount
 	}
 
 	user, err := fm.LocateUser(profileID)
 	if err != nil {
 		return err
 	}
+	if err := fm.checkStatus(user, true); err != nil {
+		return err
+	}
+
+	if _, err := fm.debitAccount(user, amount, REMOVE_FUNDS_TYPE); err != nil {
+		return err
+	}
+	fm.touch(user)
+	return nil
+}
+
+// TransferFunds moves money from one user account to another
+func (fm *FinancialManager) TransferFunds(fromProfileID, toProfileID int, amount float64) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if fromProfileID == toProfileID {
+		return errors.New("cannot transfer to the same profile")
+	}
 
-	if user.CurrentFunds < amount {
-		return fmt.Errorf("insufficient funds. Available funds: Rs.%.2f", user.CurrentFunds)
+	sender, err := fm.LocateUser(fromProfileID)
+	if err != nil {
+		return err
+	}
+	receiver, err := fm.LocateUser(toProfileID)
+	if err != nil {
+		return err
+	}
+	if err := fm.checkStatus(sender, true); err != nil {
+		return err
+	}
+	if err := fm.checkStatus(receiver, false); err != nil {
+		return err
+	}
+
+	// Work out any currency conversion before money moves
+	var converted, fee float64
+	if sender.Currency != receiver.Currency {
+		converted, fee, err = fm.conversion(amount, sender.Currency, receiver.Currency)
+		if err != nil {
+			return err
+		}
+	}
+
+	outID, err := fm.debitAccount(sender, amount, TRANSFER_OUT_TYPE)
+	if err != nil {
+		return err
+	}
+
+	// The incoming leg links back to the outgoing one, so either side can
+	// be traced or reversed
+	if sender.Currency != receiver.Currency {
+		fm.creditConverted(receiver, amount, sender.Currency, converted, fee, TRANSFER_IN_TYPE, outID)
+	} else {
+		fm.creditAccount(receiver, amount, TRANSFER_IN_TYPE, outID)
+	}
+	// Only the sender acted: money arriving does not wake a dormant account
+	fm.touch(sender)
+	return nil
+}
+
+// creditAccount posts a credit of the given record type, linked to an
+// earlier transaction if linkedID is set, and returns its ID
+func (fm *FinancialManager) creditAccount(user *UserAccount, amount float64, recordType string, linkedID int) int {
+	now := fm.clock.Now()
+	fm.accrueInterest(user, startOfDay(now))
+
+	user.CurrentFunds += amount
+	return fm.recordLinkedActivity(user, recordType, amount, now, linkedID, "")
+}
+
+// debitAccount checks available funds, and the withdrawal rules for
+// customer withdrawals, then posts
+// a debit of the given record type along with any overdraft fee.
+// It returns the ID of the debit.
+func (fm *FinancialManager) debitAccount(user *UserAccount, amount float64, recordType string) (int, error) {
+	now := fm.clock.Now()
+	fm.accrueInterest(user, startOfDay(now))
+
+	if isWithdrawalType(recordType) {
+		if err := fm.checkWithdrawalRules(user, amount, now); err != nil {
+			return 0, err
+		}
+	}
+
+	fee := user.overdraftFee(amount)
+	if user.AvailableFunds() < amount+fee {
+		if user.AccountType == CURRENT_ACCOUNT {
+			return 0, fmt.Errorf("%w: overdraft limit exceeded. Available funds: %s (withdrawal fee: %s)",
+				ErrInsufficientFunds, user.money(user.AvailableFunds()), user.money(fee))
+		}
+		return 0, fmt.Errorf("%w. Available funds: %s", ErrInsufficientFunds, user.money(user.CurrentFunds))
 	}
 
 	user.CurrentFunds -= amount
-	logEntry := fmt.Sprintf("%s: -Rs.%.2f (Funds: Rs.%.2f) - %s",
-		REMOVE_FUNDS_TYPE, amount, user.CurrentFunds, time.Now().Format("2006-01-02 15:04:05"))
+	id := fm.recordActivity(user, recordType, -amount, now)
+
+	if fee > 0 {
+		user.CurrentFunds -= fee
+		fm.recordLinkedActivity(user, OVERDRAFT_FEE_TYPE, -fee, now, id, "")
+	}
+
+	return id, nil
+}
+
+// recordActivity appends a transaction and a formatted entry to the user's
+// activity log and returns the transaction ID. Debits are passed as
+// negative amounts.
+func (fm *FinancialManager) recordActivity(user *UserAccount, recordType string, amount float64, at time.Time) int {
+	return fm.recordLinkedActivity(user, recordType, amount, at, 0, "")
+}
+
+// recordLinkedActivity records a transaction tied to an earlier one, with
+// an optional note appended to the activity log entry
+func (fm *FinancialManager) recordLinkedActivity(user *UserAccount, recordType string, amount float64,
+	at time.Time, linkedID int, note string) int {
+	fm.lastTransactionID++
+	txn := Transaction{
+		ID:        fm.lastTransactionID,
+		Type:      recordType,
+		Amount:    amount,
+		Balance:   user.CurrentFunds,
+		Timestamp: at,
+		LinkedID:  linkedID,
+		PrevHash:  user.lastHash(),
+	}
+	txn.Hash = fm.transactionHash(user.ProfileID, txn, txn.PrevHash)
+	user.Transactions = append(user.Transactions, txn)
+	fm.evaluateAlerts(user, txn)
+
+	sign := "+"
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	logEntry := fmt.Sprintf("%s: %s%s (Funds: %s) - %s",
+		recordType, sign, user.money(amount), user.money(user.CurrentFunds), at.Format(TIMESTAMP_FORMAT))
+	if note != "" {
+		logEntry += " - " + note
+	}
+	user.ActivityLog = append(user.ActivityLog, logEntry)
+	return fm.lastTransactionID
+}
+
+// logEvent appends a non-monetary entry to the user's activity log
+func (fm *FinancialManager) logEvent(user *UserAccount, eventType string, message string, at time.Time) {
+	logEntry := fmt.Sprintf("%s: %s - %s", eventType, message, at.Format(TIMESTAMP_FORMAT))
 	user.ActivityLog = append(user.ActivityLog, logEntry)
+}
 
+// findTransaction returns the user's transaction with the given ID, or nil
+func (user *UserAccount) findTransaction(id int) *Transaction {
+	for i := range user.Transactions {
+		if user.Transactions[i].ID == id {
+			return &user.Transactions[i]
+		}
+	}
 	return nil
 }
 
@@ -144,22 +440,563 @@ func (fm *FinancialManager) readInputLine() string {
 	return strings.TrimSpace(fm.inputReader.Text())
 }
 
+// promptRegistration asks for new customer details and registers the profile
+func (fm *FinancialManager) promptRegistration() {
+	fmt.Print("Enter new Profile ID: ")
+	profileID, err := strconv.Atoi(fm.readInputLine())
+	if err != nil {
+		fmt.Println("Invalid Profile ID.")
+		return
+	}
+
+	fmt.Print("Enter full name: ")
+	fullName := fm.readInputLine()
+
+	fmt.Printf("Currency (%s) or leave blank for %s: ", strings.Join(fm.rates.Currencies(), ", "), fm.rates.Base)
+	currency := strings.ToUpper(fm.readInputLine())
+	if currency != "" && !fm.rates.Supports(currency) {
+		fmt.Printf("Unsupported currency: %s\n", currency)
+		return
+	}
+
+	fmt.Print("Account type (1. Savings, 2. Current): ")
+	accountType := SAVINGS_ACCOUNT
+	switch fm.readInputLine() {
+	case "1":
+	case "2":
+		accountType = CURRENT_ACCOUNT
+	default:
+		fmt.Println("Invalid account type.")
+		return
+	}
+
+	fmt.Printf("Choose a PIN (%d-%d digits): ", MIN_PIN_LENGTH, MAX_PIN_LENGTH)
+	pin := fm.readInputLine()
+
+	user, err := fm.RegisterCustomer(profileID, fullName, accountType, pin)
+	if err != nil {
+		fmt.Printf("Error registering user: %v\n", err)
+		return
+	}
+
+	if currency != "" {
+		if err := fm.SetCurrency(profileID, currency); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+
+	if accountType == CURRENT_ACCOUNT {
+		fmt.Printf("Enter agreed overdraft limit: %s", currencySymbol(user.Currency))
+		limit, err := strconv.ParseFloat(fm.readInputLine(), 64)
+		if err != nil {
+			limit = 0
+			fmt.Println("Invalid amount. No overdraft has been set.")
+		}
+		if err := fm.SetOverdraftLimit(profileID, limit); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+	fmt.Printf("Registered %s %s account: %s (Profile ID: %d)\n", user.Currency, user.AccountType, user.FullName, user.ProfileID)
+}
+
+// promptStatement asks for a date range and writes the statement files
+func (fm *FinancialManager) promptStatement(profileID int) {
+	fmt.Printf("Enter start date (%s): ", DATE_FORMAT)
+	from, err := time.ParseInLocation(DATE_FORMAT, fm.readInputLine(), time.Local)
+	if err != nil {
+		fmt.Println("Invalid date.")
+		return
+	}
+
+	fmt.Printf("Enter end date (%s): ", DATE_FORMAT)
+	to, err := time.ParseInLocation(DATE_FORMAT, fm.readInputLine(), time.Local)
+	if err != nil {
+		fmt.Println("Invalid date.")
+		return
+	}
+
+	statement, err := fm.GenerateStatement(profileID, from, to)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	if err := statement.RenderText(os.Stdout); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	paths, err := statement.WriteStatementFiles(STATEMENT_DIR)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	for _, path := range paths {
+		fmt.Printf("Statement saved to %s\n", path)
+	}
+}
+
+// runPaymentsMenu lets the user manage standing instructions
+func (fm *FinancialManager) runPaymentsMenu(profileID int) {
+	for {
+		fmt.Println("\nScheduled Payments:")
+		fmt.Printf("%d. List Payments\n", LIST_PAYMENTS)
+		fmt.Printf("%d. Create Payment\n", CREATE_PAYMENT)
+		fmt.Printf("%d. Cancel Payment\n", CANCEL_PAYMENT)
+		fmt.Printf("%d. Back\n", BACK_TO_ACCOUNT)
+
+		choice, err := strconv.Atoi(fm.readInputLine())
+		if err != nil {
+			fmt.Println("Invalid input. Please enter a number.")
+			continue
+		}
+
+		switch choice {
+		case LIST_PAYMENTS:
+			fm.ShowScheduledPayments(profileID)
+
+		case CREATE_PAYMENT:
+			fm.promptSchedulePayment(profileID)
+
+		case CANCEL_PAYMENT:
+			fmt.Print("Enter payment ID to cancel: ")
+			paymentID, err := strconv.Atoi(fm.readInputLine())
+			if err != nil {
+				fmt.Println("Invalid payment ID.")
+				continue
+			}
+			if err := fm.CancelPayment(profileID, paymentID); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			} else {
+				fmt.Printf("Payment %d cancelled.\n", paymentID)
+			}
+
+		case BACK_TO_ACCOUNT:
+			return
+
+		default:
+			fmt.Println("Invalid choice. Please try again.")
+		}
+	}
+}
+
+// promptSchedulePayment asks for the details of a new standing instruction
+func (fm *FinancialManager) promptSchedulePayment(profileID int) {
+	fmt.Print("Payment type (1. Credit, 2. Debit): ")
+	operation := OP_ADD_FUNDS
+	switch fm.readInputLine() {
+	case "1":
+	case "2":
+		operation = OP_REMOVE_FUNDS
+	default:
+		fmt.Println("Invalid payment type.")
+		return
+	}
+
+	fmt.Print("Enter amount: ")
+	amount, err := strconv.ParseFloat(fm.readInputLine(), 64)
+	if err != nil {
+		fmt.Println("Invalid amount.")
+		return
+	}
+
+	fmt.Print("Frequency (1. Once, 2. Daily, 3. Weekly, 4. Monthly): ")
+	frequencies := map[string]string{
+		"1": FREQUENCY_ONCE,
+		"2": FREQUENCY_DAILY,
+		"3": FREQUENCY_WEEKLY,
+		"4": FREQUENCY_MONTHLY,
+	}
+	frequency, ok := frequencies[fm.readInputLine()]
+	if !ok {
+		fmt.Println("Invalid frequency.")
+		return
+	}
+
+	fmt.Printf("Enter first payment date (%s): ", DATE_FORMAT)
+	startDate, err := time.ParseInLocation(DATE_FORMAT, fm.readInputLine(), time.Local)
+	if err != nil {
+		fmt.Println("Invalid date.")
+		return
+	}
+
+	var endDate time.Time
+	if frequency != FREQUENCY_ONCE {
+		fmt.Printf("Enter end date (%s) or leave blank for none: ", DATE_FORMAT)
+		if input := fm.readInputLine(); input != "" {
+			endDate, err = time.ParseInLocation(DATE_FORMAT, input, time.Local)
+			if err != nil {
+				fmt.Println("Invalid date.")
+				return
+			}
+		}
+	}
+
+	payment, err := fm.SchedulePayment(profileID, operation, amount, frequency, startDate, endDate)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Scheduled payment #%d created.\n", payment.ID)
+}
+
+// runDisputesMenu lets the user raise and follow disputes
+func (fm *FinancialManager) runDisputesMenu(profileID int) {
+	for {
+		fmt.Println("\nDisputes:")
+		fmt.Printf("%d. List Disputes\n", LIST_DISPUTES)
+		fmt.Printf("%d. Dispute a Transaction\n", OPEN_DISPUTE)
+		fmt.Printf("%d. Back\n", BACK_TO_SERVICES)
+
+		choice, err := strconv.Atoi(fm.readInputLine())
+		if err != nil {
+			fmt.Println("Invalid input. Please enter a number.")
+			continue
+		}
+
+		switch choice {
+		case LIST_DISPUTES:
+			fm.ShowDisputes(profileID)
+
+		case OPEN_DISPUTE:
+			fmt.Print("Enter transaction ID to dispute: ")
+			transactionID, err := strconv.Atoi(fm.readInputLine())
+			if err != nil {
+				fmt.Println("Invalid transaction ID.")
+				continue
+			}
+
+			fmt.Print("Describe the problem: ")
+			dispute, err := fm.OpenDispute(profileID, transactionID, fm.readInputLine())
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+			} else {
+				user, _ := fm.LocateUser(profileID)
+				fmt.Printf("Dispute #%d opened. Provisional credit of %s posted.\n", dispute.ID, user.money(dispute.Amount))
+			}
+
+		case BACK_TO_SERVICES:
+			return
+
+		default:
+			fmt.Println("Invalid choice. Please try again.")
+		}
+	}
+}
+
+// promptLogin asks for a Profile ID and PIN and starts a session
+func (fm *FinancialManager) promptLogin() bool {
+	fmt.Print("Enter Profile ID: ")
+	profileID, err := strconv.Atoi(fm.readInputLine())
+	if err != nil {
+		fmt.Println("Invalid Profile ID.")
+		return false
+	}
+
+	fmt.Print("Enter PIN: ")
+	user, err := fm.Authenticate(profileID, fm.readInputLine())
+	if err != nil {
+		fmt.Printf("Login failed: %v\n", err)
+		return false
+	}
+
+	fmt.Printf("Welcome, %s (Profile ID: %d)\n", user.FullName, user.ProfileID)
+	if len(user.BlockedAttempts) > 0 {
+		fmt.Printf("Notice: %d withdrawal attempt(s) on this account have been blocked.\n", len(user.BlockedAttempts))
+	}
+	return true
+}
+
+// persist saves the account data and reports any failure
+func (fm *FinancialManager) persist() {
+	if err := fm.Save(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
 // LaunchMenu starts the interactive menu system
 func (fm *FinancialManager) LaunchMenu() {
 	fmt.Println("Welcome to the Financial Management System!")
-	user, err := fm.RegisterUser(101, "Rahul Sharma")
+
+	for {
+		fm.persist()
+		fmt.Println("\nSelect an option:")
+		fmt.Printf("%d. Register\n", REGISTER_PROFILE)
+		fmt.Printf("%d. Login\n", LOGIN_PROFILE)
+		fmt.Printf("%d. Exit\n", EXIT_SYSTEM)
+
+		choice, err := strconv.Atoi(fm.readInputLine())
+		if err != nil {
+			fmt.Println("Invalid input. Please enter a number.")
+			continue
+		}
+
+		switch choice {
+		case REGISTER_PROFILE:
+			fm.promptRegistration()
+
+		case LOGIN_PROFILE:
+			if fm.promptLogin() && !fm.runSessionMenu() {
+				fm.persist()
+				fmt.Println("Thank you for using the Financial Management System!")
+				return
+			}
+
+		case EXIT_SYSTEM:
+			fmt.Println("Thank you for using the Financial Management System!")
+			return
+
+		default:
+			fmt.Println("Invalid choice. Please try again.")
+		}
+	}
+}
+
+// runLoansMenu lets the user take out and prepay loans
+func (fm *FinancialManager) runLoansMenu(profileID int) {
+	for {
+		fmt.Println("\nLoans:")
+		fmt.Printf("%d. List Loans and Schedules\n", LIST_LOANS)
+		fmt.Printf("%d. Apply for a Loan\n", APPLY_LOAN)
+		fmt.Printf("%d. Prepay a Loan\n", PREPAY_LOAN)
+		fmt.Printf("%d. Back\n", BACK_FROM_LOANS)
+
+		choice, err := strconv.Atoi(fm.readInputLine())
+		if err != nil {
+			fmt.Println("Invalid input. Please enter a number.")
+			continue
+		}
+
+		switch choice {
+		case LIST_LOANS:
+			fm.ShowLoans(profileID)
+
+		case APPLY_LOAN:
+			fm.promptLoan(profileID)
+
+		case PREPAY_LOAN:
+			fmt.Print("Enter loan ID: ")
+			loanID, err := strconv.Atoi(fm.readInputLine())
+			if err != nil {
+				fmt.Println("Invalid loan ID.")
+				continue
+			}
+
+			fmt.Print("Enter amount to prepay: ")
+			amount, err := strconv.ParseFloat(fm.readInputLine(), 64)
+			if err != nil {
+				fmt.Println("Invalid amount.")
+				continue
+			}
+
+			fmt.Print("Apply to (1. Lower EMI, 2. Shorter tenure): ")
+			mode := PREPAY_REDUCE_EMI
+			if fm.readInputLine() == "2" {
+				mode = PREPAY_REDUCE_TENURE
+			}
+
+			if err := fm.PrepayLoan(profileID, loanID, amount, mode); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			} else {
+				fmt.Println("Prepayment applied and the schedule recalculated.")
+			}
+
+		case BACK_FROM_LOANS:
+			return
+
+		default:
+			fmt.Println("Invalid choice. Please try again.")
+		}
+	}
+}
+
+// promptLoan asks for the amount and tenure of a loan at the rate on offer
+// and disburses it
+func (fm *FinancialManager) promptLoan(profileID int) {
+	fmt.Printf("Loans are offered at %.2f%% a year.\n", fm.LoanRate())
+	fmt.Print("Enter loan amount: ")
+	principal, err := strconv.ParseFloat(fm.readInputLine(), 64)
 	if err != nil {
-		fmt.Printf("Error registering user: %v\n", err)
+		fmt.Println("Invalid amount.")
+		return
+	}
+
+	fmt.Print("Enter tenure in months: ")
+	tenure, err := strconv.Atoi(fm.readInputLine())
+	if err != nil {
+		fmt.Println("Invalid tenure.")
+		return
+	}
+
+	loan, err := fm.OpenLoan(profileID, principal, tenure)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
 		return
 	}
-	fmt.Printf("Registered user: %s (Profile ID: %d)\n\n", user.FullName, user.ProfileID)
+	user, _ := fm.LocateUser(profileID)
+	fmt.Printf("Loan #%d disbursed. EMI of %s is due monthly from %s.\n",
+		loan.ID, user.money(loan.EMI), loan.Schedule[0].DueDate.Format(DATE_FORMAT))
+}
 
+// runAlertsMenu lets the user manage webhook alerts on their account
+func (fm *FinancialManager) runAlertsMenu(profileID int) {
 	for {
-		fmt.Println("\nSelect an option:")
+		fmt.Println("\nBalance Alerts:")
+		fmt.Printf("%d. List Alerts\n", LIST_ALERTS)
+		fmt.Printf("%d. Add Alert\n", ADD_ALERT)
+		fmt.Printf("%d. Remove Alert\n", REMOVE_ALERT)
+		fmt.Printf("%d. Back\n", BACK_FROM_ALERTS)
+
+		choice, err := strconv.Atoi(fm.readInputLine())
+		if err != nil {
+			fmt.Println("Invalid input. Please enter a number.")
+			continue
+		}
+
+		switch choice {
+		case LIST_ALERTS:
+			fm.ShowAlertRules(profileID)
+
+		case ADD_ALERT:
+			fmt.Print("Alert when (1. Balance drops below, 2. A debit reaches): ")
+			kind := ALERT_LOW_BALANCE
+			if fm.readInputLine() == "2" {
+				kind = ALERT_LARGE_DEBIT
+			}
+
+			fmt.Print("Enter threshold amount: ")
+			threshold, err := strconv.ParseFloat(fm.readInputLine(), 64)
+			if err != nil {
+				fmt.Println("Invalid amount.")
+				continue
+			}
+
+			fmt.Print("Enter webhook URL: ")
+			endpoint := fm.readInputLine()
+
+			rule, err := fm.AddAlertRule(profileID, kind, threshold, endpoint, "")
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+			} else {
+				fmt.Printf("Alert #%d added. Webhooks are signed with secret %s\n", rule.ID, rule.Secret)
+				fmt.Println("Store the secret now; it will not be shown again.")
+			}
+
+		case REMOVE_ALERT:
+			fmt.Print("Enter alert ID to remove: ")
+			ruleID, err := strconv.Atoi(fm.readInputLine())
+			if err != nil {
+				fmt.Println("Invalid alert ID.")
+				continue
+			}
+
+			if err := fm.RemoveAlertRule(profileID, ruleID); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			} else {
+				fmt.Printf("Alert #%d removed.\n", ruleID)
+			}
+
+		case BACK_FROM_ALERTS:
+			return
+
+		default:
+			fmt.Println("Invalid choice. Please try again.")
+		}
+	}
+}
+
+// runStatusMenu lets the user reactivate a dormant account or close it.
+// Freezing is left to the bank.
+func (fm *FinancialManager) runStatusMenu(profileID int) {
+	for {
+		user, err := fm.LocateUser(profileID)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
+		fmt.Printf("\nAccount status: %s\n", user.Status)
+		fmt.Printf("%d. Reactivate Account\n", REACTIVATE_ACCOUNT)
+		fmt.Printf("%d. Close Account\n", CLOSE_ACCOUNT)
+		fmt.Printf("%d. Back\n", BACK_FROM_STATUS)
+
+		choice, err := strconv.Atoi(fm.readInputLine())
+		if err != nil {
+			fmt.Println("Invalid input. Please enter a number.")
+			continue
+		}
+
+		switch choice {
+		case REACTIVATE_ACCOUNT:
+			if err := fm.ReactivateAccount(profileID, "reactivated by customer"); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			} else {
+				fmt.Println("Account reactivated.")
+			}
+
+		case CLOSE_ACCOUNT:
+			fmt.Print("Profile ID to receive the remaining balance (leave blank for cash): ")
+			payoutProfileID := 0
+			if value := fm.readInputLine(); value != "" {
+				if payoutProfileID, err = strconv.Atoi(value); err != nil {
+					fmt.Println("Invalid Profile ID.")
+					continue
+				}
+			}
+
+			payout, err := fm.CloseAccount(profileID, payoutProfileID)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+			} else {
+				fmt.Printf("Account closed. %s paid out.\n", user.money(payout))
+			}
+
+		case BACK_FROM_STATUS:
+			return
+
+		default:
+			fmt.Println("Invalid choice. Please try again.")
+		}
+	}
+}
+
+// runSessionMenu serves the logged-in user until logout or exit.
+// It returns false when the user chose to exit the system.
+func (fm *FinancialManager) runSessionMenu() bool {
+	for {
+		fm.persist()
+		user, err := fm.CurrentUser()
+		if err != nil {
+			return true
+		}
+		profileID := user.ProfileID
+		fm.ProcessAccruals()
+		fm.ProcessDormancy()
+		for _, run := range fm.RunDuePayments() {
+			if !run.Succeeded {
+				fmt.Printf("Scheduled payment due %s failed: %s\n", run.ScheduledFor.Format(DATE_FORMAT), run.Error)
+			}
+		}
+		for _, run := range fm.RunLoanInstallments() {
+			if !run.Succeeded {
+				fmt.Printf("Loan %d installment %d due %s was not collected: %s\n",
+					run.LoanID, run.Number, run.DueDate.Format(DATE_FORMAT), run.Error)
+			}
+		}
+
+		fmt.Printf("\nLogged in as %s (Profile ID: %d)\n", user.FullName, profileID)
+		fmt.Println("Select an option:")
 		fmt.Printf("%d. Add Funds\n", ADD_FUNDS)
 		fmt.Printf("%d. Withdraw Funds\n", REMOVE_FUNDS)
+		fmt.Printf("%d. Transfer Funds\n", TRANSFER_FUNDS)
 		fmt.Printf("%d. Check Funds\n", CHECK_FUNDS)
 		fmt.Printf("%d. View Logs\n", VIEW_LOGS)
+		fmt.Printf("%d. Generate Statement\n", GET_STATEMENT)
+		fmt.Printf("%d. View Blocked Withdrawals\n", VIEW_BLOCKED)
+		fmt.Printf("%d. Scheduled Payments\n", SCHEDULE_MENU)
+		fmt.Printf("%d. Disputes\n", DISPUTES_MENU)
+		fmt.Printf("%d. Account Status\n", ACCOUNT_STATUS)
+		fmt.Printf("%d. Loans\n", LOANS_MENU)
+		fmt.Printf("%d. Balance Alerts\n", ALERTS_MENU)
+		fmt.Printf("%d. Switch Account\n", SWITCH_ACCOUNT)
+		fmt.Printf("%d. Logout\n", LOGOUT_SESSION)
 		fmt.Printf("%d. Exit\n", QUIT_SYSTEM)
 
 		choice, err := strconv.Atoi(fm.readInputLine())
@@ -170,49 +1007,113 @@ func (fm *FinancialManager) LaunchMenu() {
 
 		switch choice {
 		case ADD_FUNDS:
-			fmt.Print("Enter amount to add: Rs.")
+			fmt.Printf("Currency of the deposit or leave blank for %s: ", user.Currency)
+			currency := strings.ToUpper(fm.readInputLine())
+			if currency == "" {
+				currency = user.Currency
+			}
+
+			fmt.Printf("Enter amount to add: %s", currencySymbol(currency))
 			amount, err := strconv.ParseFloat(fm.readInputLine(), 64)
 			if err != nil {
 				fmt.Println("Invalid amount.")
 				continue
 			}
 
-			if err := fm.AddFunds(101, amount); err != nil {
+			if credited, err := fm.DepositForeign(profileID, amount, currency); err != nil {
 				fmt.Printf("Error: %v\n", err)
 			} else {
-				fmt.Printf("Successfully added Rs.%.2f\n", amount)
+				fmt.Printf("Successfully added %s\n", user.money(credited))
 			}
 
 		case REMOVE_FUNDS:
-			fmt.Print("Enter amount to withdraw: Rs.")
+			fmt.Printf("Enter amount to withdraw: %s", currencySymbol(user.Currency))
 			amount, err := strconv.ParseFloat(fm.readInputLine(), 64)
 			if err != nil {
 				fmt.Println("Invalid amount.")
 				continue
 			}
 
-			if err := fm.RemoveFunds(101, amount); err != nil {
+			if err := fm.RemoveFunds(profileID, amount); err != nil {
 				fmt.Printf("Error: %v\n", err)
 			} else {
-				fmt.Printf("Successfully withdrew Rs.%.2f\n", amount)
+				fmt.Printf("Successfully withdrew %s\n", user.money(amount))
 			}
 
-		case CHECK_FUNDS:
-			user, err := fm.LocateUser(101)
+		case TRANSFER_FUNDS:
+			fmt.Print("Enter recipient Profile ID: ")
+			toProfileID, err := strconv.Atoi(fm.readInputLine())
 			if err != nil {
+				fmt.Println("Invalid Profile ID.")
+				continue
+			}
+
+			fmt.Printf("Enter amount to transfer: %s", currencySymbol(user.Currency))
+			amount, err := strconv.ParseFloat(fm.readInputLine(), 64)
+			if err != nil {
+				fmt.Println("Invalid amount.")
+				continue
+			}
+
+			if err := fm.TransferFunds(profileID, toProfileID, amount); err != nil {
 				fmt.Printf("Error: %v\n", err)
 			} else {
-				fmt.Printf("Available funds: Rs.%.2f\n", user.CurrentFunds)
+				fmt.Printf("Successfully transferred %s to Profile %d\n", user.money(amount), toProfileID)
+			}
+
+		case CHECK_FUNDS:
+			fmt.Printf("Account type: %s (%s), status: %s\n", user.AccountType, user.Currency, user.Status)
+			fmt.Printf("Current funds: %s\n", user.money(user.CurrentFunds))
+			if user.AccountType == CURRENT_ACCOUNT {
+				fmt.Printf("Overdraft limit: %s\n", user.money(user.OverdraftLimit))
+			} else {
+				fmt.Printf("Interest rate: %.2f%% p.a. (accrued: %s)\n", user.InterestRate, user.money(user.AccruedInterest))
 			}
+			fmt.Printf("Available funds: %s\n", user.money(user.AvailableFunds()))
 
 		case VIEW_LOGS:
-			if err := fm.ShowActivityLog(101); err != nil {
+			if err := fm.ShowActivityLog(profileID); err != nil {
 				fmt.Printf("Error: %v\n", err)
 			}
 
+		case GET_STATEMENT:
+			fm.promptStatement(profileID)
+
+		case VIEW_BLOCKED:
+			if err := fm.ShowBlockedAttempts(profileID); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+
+		case SCHEDULE_MENU:
+			fm.runPaymentsMenu(profileID)
+
+		case DISPUTES_MENU:
+			fm.runDisputesMenu(profileID)
+
+		case ACCOUNT_STATUS:
+			fm.runStatusMenu(profileID)
+
+		case LOANS_MENU:
+			fm.runLoansMenu(profileID)
+
+		case ALERTS_MENU:
+			fm.runAlertsMenu(profileID)
+
+		case SWITCH_ACCOUNT:
+			fm.Logout()
+			if !fm.promptLogin() {
+				fmt.Println("Returning to the main menu.")
+				return true
+			}
+
+		case LOGOUT_SESSION:
+			fm.Logout()
+			fmt.Println("You have been logged out.")
+			return true
+
 		case QUIT_SYSTEM:
-			fmt.Println("Thank you for using the Financial Management System!")
-			return
+			fm.Logout()
+			return false
 
 		default:
 			fmt.Println("Invalid choice. Please try again.")
@@ -220,7 +1121,96 @@ func (fm *FinancialManager) LaunchMenu() {
 	}
 }
 
+// runBatchFile runs a batch script against a fresh in-memory manager and
+// returns the process exit code
+func runBatchFile(path, format string) int {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	defer file.Close()
+
+	if format == "" {
+		format = BATCH_FORMAT_LINES
+		if strings.HasSuffix(strings.ToLower(path), ".csv") {
+			format = BATCH_FORMAT_CSV
+		}
+	}
+
+	manager := InitializeManager()
+	if err := manager.loadDefaultRates(); err != nil {
+		fmt.Printf("Error loading exchange rates: %v\n", err)
+		return 2
+	}
+
+	manager.StartAlerts(ALERT_DEAD_LETTER_FILE)
+	defer manager.StopAlerts()
+
+	report, err := manager.RunBatch(file, format, os.Stdout)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
 func main() {
+	serveAddr := flag.String("serve", "", "run the JSON HTTP API on this address (e.g. :8080) instead of the menu")
+	batchFile := flag.String("batch", "", "run the operations in this script file instead of the menu")
+	batchFormat := flag.String("format", "", "batch script format: lines or csv (default: from the file extension)")
+	reconcile := flag.Bool("reconcile", false, "verify the stored ledger and balances, then exit")
+	loanRate := flag.Float64("loan-rate", -1, "set the annual percent new loans are offered at and save it (negative keeps the saved rate)")
+	flag.Parse()
+
+	if *batchFile != "" {
+		os.Exit(runBatchFile(*batchFile, *batchFormat))
+	}
+
 	manager := InitializeManager()
+	if err := manager.loadDefaultRates(); err != nil {
+		fmt.Printf("Error loading exchange rates: %v\n", err)
+		os.Exit(1)
+	}
+	if err := manager.EnableStorage(DATA_FILE); err != nil {
+		fmt.Printf("Error loading account data: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *loanRate >= 0 {
+		if err := manager.SetLoanRate(*loanRate); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := manager.Save(); err != nil {
+			fmt.Printf("Error saving account data: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *reconcile {
+		if WriteReconciliation(os.Stdout, manager.Reconcile()) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	manager.StartAlerts(ALERT_DEAD_LETTER_FILE)
+	defer manager.StopAlerts()
+
+	if *serveAddr != "" {
+		stop := make(chan struct{})
+		defer close(stop)
+		go manager.runScheduler(SCHEDULER_INTERVAL, stop)
+
+		if err := NewAPIServer(manager, os.Getenv(OPERATOR_KEY_ENV)).ListenAndServe(*serveAddr); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 	manager.LaunchMenu()
 }
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Default withdrawal limits. Amounts are in the base currency and are
+// converted for accounts held in other currencies.
+const (
+	MAX_WITHDRAWAL_PER_TXN  = 50000.0
+	MAX_WITHDRAWAL_PER_DAY  = 100000.0
+	MAX_DEBITS_PER_HOUR     = 5
+	UNUSUAL_AMOUNT_FACTOR   = 5.0
+	UNUSUAL_AMOUNT_MIN_HIST = 5
+)
+
+// BLOCKED_DEBIT_TYPE marks a withdrawal stopped by a rule in the activity log
+const BLOCKED_DEBIT_TYPE = "BLOCKED_DEBIT"
+
+// ErrDebitBlocked is returned when a withdrawal rule rejects a debit
+var ErrDebitBlocked = errors.New("withdrawal blocked")
+
+// DebitRequest describes a pending withdrawal for the rules to evaluate.
+// Amount is in the account's currency; Rates converts limits set in the
+// base currency.
+type DebitRequest struct {
+	User   *UserAccount
+	Amount float64
+	At     time.Time
+	Rates  *ExchangeRates
+}
+
+// limit converts a limit from the base currency to the account's
+// currency. Without a rate for the account's currency the limit is
+// applied unconverted.
+func (request DebitRequest) limit(amount float64) float64 {
+	if request.Rates == nil {
+		return amount
+	}
+	converted, err := request.Rates.Convert(amount, request.Rates.Base, request.User.Currency)
+	if err != nil {
+		return amount
+	}
+	return roundAmount(converted)
+}
+
+// withdrawals returns the account's withdrawals that still stand, leaving
+// out those that were reversed
+func (request DebitRequest) withdrawals() []Transaction {
+	var withdrawals []Transaction
+	for _, txn := range request.User.Transactions {
+		if isWithdrawal(txn) && request.User.reversalOf(txn.ID) == nil {
+			withdrawals = append(withdrawals, txn)
+		}
+	}
+	return withdrawals
+}
+
+// WithdrawalRule decides whether a debit may go ahead.
+// Evaluate returns a reason when the debit must be blocked.
+type WithdrawalRule interface {
+	Name() string
+	Evaluate(request DebitRequest) (string, bool)
+}
+
+// BlockedAttempt records a withdrawal that a rule refused
+type BlockedAttempt struct {
+	Amount    float64
+	Rule      string
+	Reason    string
+	Timestamp time.Time
+}
+
+// PerTransactionLimit caps the size of a single withdrawal. Max is in the
+// base currency.
+type PerTransactionLimit struct {
+	Max float64
+}
+
+// Name identifies the rule
+func (r PerTransactionLimit) Name() string {
+	return "PER_TRANSACTION_LIMIT"
+}
+
+// Evaluate blocks withdrawals above the cap
+func (r PerTransactionLimit) Evaluate(request DebitRequest) (string, bool) {
+	limit := request.limit(r.Max)
+	if request.Amount > limit {
+		return fmt.Sprintf("amount exceeds the per-transaction limit of %s", request.User.money(limit)), true
+	}
+	return "", false
+}
+
+// DailyLimit caps the total withdrawn in a calendar day. Max is in the
+// base currency.
+type DailyLimit struct {
+	Max float64
+}
+
+// Name identifies the rule
+func (r DailyLimit) Name() string {
+	return "DAILY_LIMIT"
+}
+
+// Evaluate blocks withdrawals that would take the day's total above the cap
+func (r DailyLimit) Evaluate(request DebitRequest) (string, bool) {
+	dayStart := startOfDay(request.At)
+	withdrawn := 0.0
+	for _, txn := range request.withdrawals() {
+		if !txn.Timestamp.Before(dayStart) {
+			withdrawn += -txn.Amount
+		}
+	}
+
+	limit := request.limit(r.Max)
+	if withdrawn+request.Amount > limit {
+		return fmt.Sprintf("daily withdrawal limit of %s reached (already withdrawn %s today)",
+			request.User.money(limit), request.User.money(withdrawn)), true
+	}
+	return "", false
+}
+
+// VelocityLimit caps the number of withdrawals within a sliding window
+type VelocityLimit struct {
+	MaxDebits int
+	Window    time.Duration
+}
+
+// Name identifies the rule
+func (r VelocityLimit) Name() string {
+	return "VELOCITY_LIMIT"
+}
+
+// Evaluate blocks a withdrawal once the window already holds MaxDebits
+func (r VelocityLimit) Evaluate(request DebitRequest) (string, bool) {
+	windowStart := request.At.Add(-r.Window)
+	count := 0
+	for _, txn := range request.withdrawals() {
+		if txn.Timestamp.After(windowStart) {
+			count++
+		}
+	}
+
+	if count >= r.MaxDebits {
+		return fmt.Sprintf("maximum of %d withdrawals within %v reached", r.MaxDebits, r.Window), true
+	}
+	return "", false
+}
+
+// UnusualAmount flags withdrawals far larger than the account's usual ones
+type UnusualAmount struct {
+	Factor     float64
+	MinHistory int
+}
+
+// Name identifies the rule
+func (r UnusualAmount) Name() string {
+	return "UNUSUAL_AMOUNT"
+}
+
+// Evaluate blocks withdrawals above Factor times the historical average
+func (r UnusualAmount) Evaluate(request DebitRequest) (string, bool) {
+	total := 0.0
+	count := 0
+	for _, txn := range request.withdrawals() {
+		total += -txn.Amount
+		count++
+	}
+
+	if count < r.MinHistory {
+		return "", false
+	}
+
+	average := total / float64(count)
+	if request.Amount > average*r.Factor {
+		return fmt.Sprintf("amount is more than %.1f times the average withdrawal of %s",
+			r.Factor, request.User.money(average)), true
+	}
+	return "", false
+}
+
+// DefaultWithdrawalRules returns the rules applied to new managers
+func DefaultWithdrawalRules() []WithdrawalRule {
+	return []WithdrawalRule{
+		PerTransactionLimit{Max: MAX_WITHDRAWAL_PER_TXN},
+		DailyLimit{Max: MAX_WITHDRAWAL_PER_DAY},
+		VelocityLimit{MaxDebits: MAX_DEBITS_PER_HOUR, Window: time.Hour},
+		UnusualAmount{Factor: UNUSUAL_AMOUNT_FACTOR, MinHistory: UNUSUAL_AMOUNT_MIN_HIST},
+	}
+}
+
+// SetWithdrawalRules replaces the rules evaluated before each withdrawal
+func (fm *FinancialManager) SetWithdrawalRules(rules ...WithdrawalRule) {
+	fm.withdrawalRules = rules
+}
+
+// isWithdrawal reports whether a transaction is a customer-initiated debit
+func isWithdrawal(txn Transaction) bool {
+	return isWithdrawalType(txn.Type)
+}
+
+// isWithdrawalType reports whether a record type is a customer-initiated debit
+func isWithdrawalType(recordType string) bool {
+	return recordType == REMOVE_FUNDS_TYPE || recordType == TRANSFER_OUT_TYPE
+}
+
+// checkWithdrawalRules runs every rule against a debit and records the
+// first one that blocks it
+func (fm *FinancialManager) checkWithdrawalRules(user *UserAccount, amount float64, at time.Time) error {
+	request := DebitRequest{User: user, Amount: amount, At: at, Rates: fm.rates}
+	for _, rule := range fm.withdrawalRules {
+		reason, blocked := rule.Evaluate(request)
+		if !blocked {
+			continue
+		}
+
+		user.BlockedAttempts = append(user.BlockedAttempts, BlockedAttempt{
+			Amount:    amount,
+			Rule:      rule.Name(),
+			Reason:    reason,
+			Timestamp: at,
+		})
+		fm.logEvent(user, BLOCKED_DEBIT_TYPE,
+			fmt.Sprintf("%s blocked by %s (%s)", user.money(amount), rule.Name(), reason), at)
+
+		return fmt.Errorf("%w by %s: %s", ErrDebitBlocked, rule.Name(), reason)
+	}
+	return nil
+}
+
+// ShowBlockedAttempts displays the withdrawals refused for a user
+func (fm *FinancialManager) ShowBlockedAttempts(profileID int) error {
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return err
+	}
+
+	if len(user.BlockedAttempts) == 0 {
+		fmt.Println("No blocked withdrawals found.")
+		return nil
+	}
+
+	fmt.Printf("\nBlocked Withdrawals for Profile %d (%s):\n", user.ProfileID, user.FullName)
+	fmt.Println("----------------------------------------")
+	for _, attempt := range user.BlockedAttempts {
+		fmt.Printf("%s: %s - %s (%s)\n",
+			attempt.Timestamp.Format(TIMESTAMP_FORMAT), user.money(attempt.Amount), attempt.Rule, attempt.Reason)
+	}
+	return nil
+}
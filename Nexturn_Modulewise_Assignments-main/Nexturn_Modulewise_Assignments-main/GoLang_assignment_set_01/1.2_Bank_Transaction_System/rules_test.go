@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// ruleTestNow is the time of the debits evaluated in the rule tests
+var ruleTestNow = time.Date(2024, 6, 10, 15, 0, 0, 0, time.UTC)
+
+// ruleTestAccount returns a rupee account holding the given postings,
+// numbered from 1
+func ruleTestAccount(postings ...Transaction) *UserAccount {
+	user := &UserAccount{ProfileID: 1, Currency: BASE_CURRENCY}
+	for i, txn := range postings {
+		txn.ID = i + 1
+		if txn.Type == "" {
+			txn.Type = REMOVE_FUNDS_TYPE
+		}
+		user.Transactions = append(user.Transactions, txn)
+	}
+	return user
+}
+
+// withdrawal is a customer debit made the given time before ruleTestNow
+func withdrawal(amount float64, ago time.Duration) Transaction {
+	return Transaction{Type: REMOVE_FUNDS_TYPE, Amount: -amount, Timestamp: ruleTestNow.Add(-ago)}
+}
+
+func TestPerTransactionLimit(t *testing.T) {
+	rule := PerTransactionLimit{Max: 1000}
+	cases := []struct {
+		name    string
+		amount  float64
+		blocked bool
+	}{
+		{name: "below the cap", amount: 999.99},
+		{name: "at the cap", amount: 1000},
+		{name: "above the cap", amount: 1000.01, blocked: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reason, blocked := rule.Evaluate(DebitRequest{User: ruleTestAccount(), Amount: tc.amount, At: ruleTestNow})
+			if blocked != tc.blocked {
+				t.Errorf("Evaluate(%.2f) blocked = %v (%s); want %v", tc.amount, blocked, reason, tc.blocked)
+			}
+		})
+	}
+}
+
+func TestDailyLimit(t *testing.T) {
+	rule := DailyLimit{Max: 1000}
+	cases := []struct {
+		name     string
+		postings []Transaction
+		amount   float64
+		blocked  bool
+	}{
+		{name: "first withdrawal of the day", amount: 1000},
+		{name: "first withdrawal above the cap", amount: 1000.01, blocked: true},
+		{
+			name:     "takes the day to the cap",
+			postings: []Transaction{withdrawal(400, time.Hour), withdrawal(300, 2*time.Hour)},
+			amount:   300,
+		},
+		{
+			name:     "takes the day past the cap",
+			postings: []Transaction{withdrawal(400, time.Hour), withdrawal(300, 2*time.Hour)},
+			amount:   300.01,
+			blocked:  true,
+		},
+		{
+			name:     "yesterday does not count",
+			postings: []Transaction{withdrawal(900, 16*time.Hour)},
+			amount:   1000,
+		},
+		{
+			name:     "from midnight",
+			postings: []Transaction{withdrawal(900, 15*time.Hour)},
+			amount:   100.01,
+			blocked:  true,
+		},
+		{
+			name: "deposits and fees do not count",
+			postings: []Transaction{
+				{Type: ADD_FUNDS_TYPE, Amount: 5000, Timestamp: ruleTestNow.Add(-time.Hour)},
+				{Type: OVERDRAFT_FEE_TYPE, Amount: -500, Timestamp: ruleTestNow.Add(-time.Hour)},
+			},
+			amount: 1000,
+		},
+		{
+			name: "transfers out count",
+			postings: []Transaction{
+				{Type: TRANSFER_OUT_TYPE, Amount: -600, Timestamp: ruleTestNow.Add(-time.Hour)},
+			},
+			amount:  500,
+			blocked: true,
+		},
+		{
+			name: "reversed withdrawals do not count",
+			postings: []Transaction{
+				withdrawal(900, 2*time.Hour),
+				{Type: REVERSAL_TYPE, Amount: 900, Timestamp: ruleTestNow.Add(-time.Hour), LinkedID: 1},
+			},
+			amount: 1000,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := DebitRequest{User: ruleTestAccount(tc.postings...), Amount: tc.amount, At: ruleTestNow}
+			reason, blocked := rule.Evaluate(request)
+			if blocked != tc.blocked {
+				t.Errorf("Evaluate(%.2f) blocked = %v (%s); want %v", tc.amount, blocked, reason, tc.blocked)
+			}
+		})
+	}
+}
+
+func TestVelocityLimit(t *testing.T) {
+	rule := VelocityLimit{MaxDebits: 3, Window: time.Hour}
+	cases := []struct {
+		name     string
+		postings []Transaction
+		blocked  bool
+	}{
+		{name: "no earlier withdrawals"},
+		{
+			name:     "below the count",
+			postings: []Transaction{withdrawal(10, time.Minute), withdrawal(10, 2*time.Minute)},
+		},
+		{
+			name:     "at the count",
+			postings: []Transaction{withdrawal(10, time.Minute), withdrawal(10, 2*time.Minute), withdrawal(10, 3*time.Minute)},
+			blocked:  true,
+		},
+		{
+			name:     "one left the window",
+			postings: []Transaction{withdrawal(10, time.Minute), withdrawal(10, 2*time.Minute), withdrawal(10, time.Hour)},
+		},
+		{
+			name: "reversed withdrawals do not count",
+			postings: []Transaction{
+				withdrawal(10, 3*time.Minute),
+				withdrawal(10, 2*time.Minute),
+				withdrawal(10, time.Minute),
+				{Type: REVERSAL_TYPE, Amount: 10, Timestamp: ruleTestNow, LinkedID: 2},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := DebitRequest{User: ruleTestAccount(tc.postings...), Amount: 10, At: ruleTestNow}
+			reason, blocked := rule.Evaluate(request)
+			if blocked != tc.blocked {
+				t.Errorf("Evaluate() blocked = %v (%s); want %v", blocked, reason, tc.blocked)
+			}
+		})
+	}
+}
+
+func TestUnusualAmount(t *testing.T) {
+	rule := UnusualAmount{Factor: 5, MinHistory: 3}
+	history := []Transaction{withdrawal(100, 72*time.Hour), withdrawal(200, 48*time.Hour), withdrawal(300, 24*time.Hour)}
+	cases := []struct {
+		name     string
+		postings []Transaction
+		amount   float64
+		blocked  bool
+	}{
+		{name: "too little history", postings: history[:2], amount: 100000},
+		{name: "at the factor", postings: history, amount: 1000},
+		{name: "above the factor", postings: history, amount: 1000.01, blocked: true},
+		{
+			name: "reversed withdrawals leave the average",
+			postings: append(append([]Transaction(nil), history...),
+				withdrawal(5000, 12*time.Hour),
+				Transaction{Type: REVERSAL_TYPE, Amount: 5000, Timestamp: ruleTestNow.Add(-time.Hour), LinkedID: 4}),
+			amount:  1000.01,
+			blocked: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := DebitRequest{User: ruleTestAccount(tc.postings...), Amount: tc.amount, At: ruleTestNow}
+			reason, blocked := rule.Evaluate(request)
+			if blocked != tc.blocked {
+				t.Errorf("Evaluate(%.2f) blocked = %v (%s); want %v", tc.amount, blocked, reason, tc.blocked)
+			}
+		})
+	}
+}
+
+func TestLimitsFollowAccountCurrency(t *testing.T) {
+	rates := &ExchangeRates{Base: BASE_CURRENCY, Rates: map[string]float64{"USD": 80}}
+	dollars := ruleTestAccount(withdrawal(10, time.Hour))
+	dollars.Currency = "USD"
+
+	// 8000 rupees is 100 dollars
+	perTransaction := PerTransactionLimit{Max: 8000}
+	if _, blocked := perTransaction.Evaluate(DebitRequest{User: dollars, Amount: 100, At: ruleTestNow, Rates: rates}); blocked {
+		t.Error("100 dollars blocked by a per-transaction limit worth 100 dollars")
+	}
+	reason, blocked := perTransaction.Evaluate(DebitRequest{User: dollars, Amount: 100.01, At: ruleTestNow, Rates: rates})
+	if !blocked || reason != "amount exceeds the per-transaction limit of $100.00" {
+		t.Errorf("Evaluate(100.01 dollars) = %q, %v; want the limit stated as $100.00", reason, blocked)
+	}
+
+	daily := DailyLimit{Max: 8000}
+	if _, blocked := daily.Evaluate(DebitRequest{User: dollars, Amount: 90, At: ruleTestNow, Rates: rates}); blocked {
+		t.Error("day total of 100 dollars blocked by a daily limit worth 100 dollars")
+	}
+	if _, blocked := daily.Evaluate(DebitRequest{User: dollars, Amount: 90.01, At: ruleTestNow, Rates: rates}); !blocked {
+		t.Error("day total above 100 dollars allowed by a daily limit worth 100 dollars")
+	}
+}
+
+func TestReversedWithdrawalFreesDailyLimit(t *testing.T) {
+	manager, _, _ := newCurrencyTest(t)
+	manager.SetWithdrawalRules(DailyLimit{Max: 1000})
+	if err := manager.AddFunds(1, 5000); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	if err := manager.RemoveFunds(1, 800); err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	if err := manager.RemoveFunds(1, 300); !errors.Is(err, ErrDebitBlocked) {
+		t.Fatalf("withdrawal past the daily limit = %v; want it blocked", err)
+	}
+
+	if err := manager.ReverseTransaction(1, 2, "posted twice"); err != nil {
+		t.Fatalf("reverse: %v", err)
+	}
+	if err := manager.RemoveFunds(1, 300); err != nil {
+		t.Errorf("withdrawal after the reversal = %v; want it allowed", err)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Payment frequencies
+const (
+	FREQUENCY_ONCE    = "ONCE"
+	FREQUENCY_DAILY   = "DAILY"
+	FREQUENCY_WEEKLY  = "WEEKLY"
+	FREQUENCY_MONTHLY = "MONTHLY"
+)
+
+// Scheduled payment statuses
+const (
+	PAYMENT_ACTIVE    = "ACTIVE"
+	PAYMENT_COMPLETED = "COMPLETED"
+	PAYMENT_FAILED    = "FAILED"
+	PAYMENT_CANCELLED = "CANCELLED"
+)
+
+// Retry settings for payments that cannot be posted
+const (
+	MAX_PAYMENT_RETRIES    = 3
+	PAYMENT_RETRY_INTERVAL = 4 * time.Hour
+	SCHEDULER_INTERVAL     = time.Minute
+)
+
+// PaymentRun records one attempt at a scheduled payment
+type PaymentRun struct {
+	Occurrence   int
+	ScheduledFor time.Time
+	AttemptedAt  time.Time
+	Succeeded    bool
+	Error        string
+}
+
+// ScheduledPayment is a standing instruction to credit or debit an account
+type ScheduledPayment struct {
+	ID          int
+	ProfileID   int
+	Operation   string
+	Amount      float64
+	Frequency   string
+	StartDate   time.Time
+	EndDate     time.Time
+	Occurrence  int
+	Retries     int
+	NextAttempt time.Time
+	Status      string
+	LastError   string
+	Runs        []PaymentRun
+}
+
+// SchedulePayment registers a one-off or recurring credit or debit.
+// A zero endDate means the payment repeats until cancelled.
+func (fm *FinancialManager) SchedulePayment(profileID int, operation string, amount float64,
+	frequency string, startDate, endDate time.Time) (*ScheduledPayment, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if _, err := fm.LocateUser(profileID); err != nil {
+		return nil, err
+	}
+
+	operation = strings.ToUpper(operation)
+	if operation != OP_ADD_FUNDS && operation != OP_REMOVE_FUNDS {
+		return nil, fmt.Errorf("invalid payment operation: %s", operation)
+	}
+
+	frequency = strings.ToUpper(frequency)
+	switch frequency {
+	case FREQUENCY_ONCE, FREQUENCY_DAILY, FREQUENCY_WEEKLY, FREQUENCY_MONTHLY:
+	default:
+		return nil, fmt.Errorf("invalid payment frequency: %s", frequency)
+	}
+
+	if !endDate.IsZero() && endDate.Before(startDate) {
+		return nil, errors.New("payment end date is before its start date")
+	}
+
+	fm.lastPaymentID++
+	payment := &ScheduledPayment{
+		ID:          fm.lastPaymentID,
+		ProfileID:   profileID,
+		Operation:   operation,
+		Amount:      amount,
+		Frequency:   frequency,
+		StartDate:   startDate,
+		EndDate:     endDate,
+		NextAttempt: startDate,
+		Status:      PAYMENT_ACTIVE,
+		Runs:        make([]PaymentRun, 0),
+	}
+	fm.scheduledPayments = append(fm.scheduledPayments, payment)
+	return payment, nil
+}
+
+// CancelPayment stops a scheduled payment owned by the given profile
+func (fm *FinancialManager) CancelPayment(profileID, paymentID int) error {
+	for _, payment := range fm.scheduledPayments {
+		if payment.ID != paymentID || payment.ProfileID != profileID {
+			continue
+		}
+		if payment.Status != PAYMENT_ACTIVE {
+			return fmt.Errorf("payment %d is already %s", paymentID, strings.ToLower(payment.Status))
+		}
+		payment.Status = PAYMENT_CANCELLED
+		return nil
+	}
+	return fmt.Errorf("scheduled payment %d not found", paymentID)
+}
+
+// PaymentsFor returns the scheduled payments of a profile
+func (fm *FinancialManager) PaymentsFor(profileID int) []*ScheduledPayment {
+	payments := make([]*ScheduledPayment, 0)
+	for _, payment := range fm.scheduledPayments {
+		if payment.ProfileID == profileID {
+			payments = append(payments, payment)
+		}
+	}
+	return payments
+}
+
+// occurrenceDate returns when the n-th occurrence (from zero) is due
+func (p *ScheduledPayment) occurrenceDate(n int) time.Time {
+	switch p.Frequency {
+	case FREQUENCY_DAILY:
+		return p.StartDate.AddDate(0, 0, n)
+	case FREQUENCY_WEEKLY:
+		return p.StartDate.AddDate(0, 0, 7*n)
+	case FREQUENCY_MONTHLY:
+		return addMonths(p.StartDate, n)
+	}
+	return p.StartDate
+}
+
+// addMonths moves a date on by n months, keeping its day of the month
+// where possible and falling back to the month's last day
+func addMonths(t time.Time, n int) time.Time {
+	year, month, day := t.Date()
+	firstOfMonth := time.Date(year, month+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return firstOfMonth.AddDate(0, 0, day-1)
+}
+
+// advance moves a payment on to its next occurrence, completing it when
+// there are no more
+func (p *ScheduledPayment) advance() {
+	p.Occurrence++
+	p.Retries = 0
+	if p.Frequency == FREQUENCY_ONCE {
+		p.Status = PAYMENT_COMPLETED
+		return
+	}
+
+	next := p.occurrenceDate(p.Occurrence)
+	if !p.EndDate.IsZero() && next.After(p.EndDate) {
+		p.Status = PAYMENT_COMPLETED
+		return
+	}
+	p.NextAttempt = next
+}
+
+// isRetryable reports whether a failed payment may succeed later
+func isRetryable(err error) bool {
+	return errors.Is(err, ErrInsufficientFunds) || errors.Is(err, ErrDebitBlocked)
+}
+
+// isPermanent reports whether a failure means no later occurrence of a
+// payment can succeed either
+func isPermanent(err error) bool {
+	return errors.Is(err, ErrAccountClosed) || errors.Is(err, ErrProfileNotFound)
+}
+
+// RunDuePayments posts every scheduled payment that is due by the clock's
+// current time, retrying failures and catching up on missed occurrences.
+// It returns the runs attempted.
+func (fm *FinancialManager) RunDuePayments() []PaymentRun {
+	now := fm.clock.Now()
+	runs := make([]PaymentRun, 0)
+
+	for _, payment := range fm.scheduledPayments {
+		for payment.Status == PAYMENT_ACTIVE && !payment.NextAttempt.After(now) {
+			run := fm.attemptPayment(payment, now)
+			runs = append(runs, run)
+		}
+	}
+	return runs
+}
+
+// attemptPayment tries to post the current occurrence of a payment
+func (fm *FinancialManager) attemptPayment(payment *ScheduledPayment, now time.Time) PaymentRun {
+	run := PaymentRun{
+		Occurrence:   payment.Occurrence,
+		ScheduledFor: payment.occurrenceDate(payment.Occurrence),
+		AttemptedAt:  now,
+	}
+
+	// Keying each occurrence guards against posting it twice
+	key := internalKey("scheduled-%d-%d", payment.ID, payment.Occurrence)
+	_, err := fm.runOnce(key, payment.Operation, payment.ProfileID, 0, payment.Amount, func() error {
+		if payment.Operation == OP_ADD_FUNDS {
+			return fm.AddFunds(payment.ProfileID, payment.Amount)
+		}
+		return fm.RemoveFunds(payment.ProfileID, payment.Amount)
+	})
+
+	if err == nil {
+		run.Succeeded = true
+		payment.LastError = ""
+		payment.Runs = append(payment.Runs, run)
+		payment.advance()
+		return run
+	}
+
+	run.Error = err.Error()
+	payment.LastError = err.Error()
+	payment.Runs = append(payment.Runs, run)
+
+	// Retry from now rather than from the missed slot, so a scheduler that
+	// runs late does not burn every retry in one pass
+	if isRetryable(err) && payment.Retries < MAX_PAYMENT_RETRIES {
+		payment.Retries++
+		payment.NextAttempt = now.Add(PAYMENT_RETRY_INTERVAL)
+		return run
+	}
+
+	if payment.Frequency == FREQUENCY_ONCE || isPermanent(err) {
+		payment.Status = PAYMENT_FAILED
+		return run
+	}
+	// Give up on this occurrence but keep the standing instruction, so a
+	// frozen or dormant account picks up again from the next period
+	payment.advance()
+	return run
+}
+
+// runScheduler periodically posts due payments until stop is closed
+func (fm *FinancialManager) runScheduler(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fm.mu.Lock()
+			runs := fm.RunDuePayments()
+			if installments := fm.RunLoanInstallments(); len(runs) > 0 || len(installments) > 0 {
+				if err := fm.Save(); err != nil {
+					fmt.Printf("Warning: %v\n", err)
+				}
+			}
+			fm.mu.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// ShowScheduledPayments displays a user's standing instructions
+func (fm *FinancialManager) ShowScheduledPayments(profileID int) {
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	payments := fm.PaymentsFor(profileID)
+	if len(payments) == 0 {
+		fmt.Println("No scheduled payments found.")
+		return
+	}
+
+	fmt.Printf("\nScheduled Payments for Profile %d:\n", profileID)
+	fmt.Println("----------------------------------------")
+	for _, payment := range payments {
+		fmt.Printf("#%d %s %s %s from %s", payment.ID, payment.Operation, user.money(payment.Amount),
+			payment.Frequency, payment.StartDate.Format(DATE_FORMAT))
+		if !payment.EndDate.IsZero() {
+			fmt.Printf(" until %s", payment.EndDate.Format(DATE_FORMAT))
+		}
+		fmt.Printf(" [%s]", payment.Status)
+		if payment.Status == PAYMENT_ACTIVE {
+			fmt.Printf(" next: %s", payment.NextAttempt.Format(TIMESTAMP_FORMAT))
+		}
+		if payment.LastError != "" {
+			fmt.Printf(" last error: %s", payment.LastError)
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newSchedulerTest creates a manager with one current account holding
+// balance, so no interest muddies the amounts
+func newSchedulerTest(t *testing.T, start time.Time, balance float64) (*FinancialManager, *manualClock) {
+	t.Helper()
+	clock := &manualClock{now: start}
+	manager := InitializeManager()
+	manager.SetClock(clock)
+	if _, err := manager.RegisterCustomer(1, "Payer", CURRENT_ACCOUNT, "1234"); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if balance > 0 {
+		if err := manager.AddFunds(1, balance); err != nil {
+			t.Fatalf("deposit: %v", err)
+		}
+	}
+	return manager, clock
+}
+
+func TestScheduledPaymentsCatchUpAtMonthEnd(t *testing.T) {
+	start := time.Date(2024, 1, 31, 9, 0, 0, 0, time.Local)
+	manager, clock := newSchedulerTest(t, start, 1000)
+	payment, err := manager.SchedulePayment(1, OP_REMOVE_FUNDS, 100, FREQUENCY_MONTHLY, start, time.Time{})
+	if err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+
+	// The scheduler was down until April; every missed month is posted once
+	clock.now = time.Date(2024, 4, 1, 9, 0, 0, 0, time.Local)
+	runs := manager.RunDuePayments()
+	want := []string{"2024-01-31", "2024-02-29", "2024-03-31"}
+	if len(runs) != len(want) {
+		t.Fatalf("got %d runs, want %d: %+v", len(runs), len(want), runs)
+	}
+	for i, run := range runs {
+		if !run.Succeeded || run.ScheduledFor.Format(DATE_FORMAT) != want[i] {
+			t.Errorf("run %d: %+v; want a successful run for %s", i, run, want[i])
+		}
+	}
+	if next := payment.NextAttempt.Format(DATE_FORMAT); next != "2024-04-30" {
+		t.Errorf("next attempt %s; want 2024-04-30", next)
+	}
+	if runs := manager.RunDuePayments(); len(runs) != 0 {
+		t.Errorf("a second pass posted %d more runs", len(runs))
+	}
+
+	user, _ := manager.LocateUser(1)
+	if user.CurrentFunds != 700 {
+		t.Errorf("balance %.2f; want 700", user.CurrentFunds)
+	}
+}
+
+func TestScheduledPaymentRetriesFromNow(t *testing.T) {
+	start := time.Date(2024, 6, 10, 9, 0, 0, 0, time.Local)
+	manager, clock := newSchedulerTest(t, start, 50)
+	payment, err := manager.SchedulePayment(1, OP_REMOVE_FUNDS, 100, FREQUENCY_ONCE, start, time.Time{})
+	if err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+
+	// Running two days late makes one attempt, not every retry at once
+	clock.Advance(48 * time.Hour)
+	if runs := manager.RunDuePayments(); len(runs) != 1 || runs[0].Succeeded {
+		t.Fatalf("late run: %+v; want one failed attempt", runs)
+	}
+	if payment.Retries != 1 || !payment.NextAttempt.Equal(clock.now.Add(PAYMENT_RETRY_INTERVAL)) {
+		t.Fatalf("retry %d at %v; want retry 1 at %v", payment.Retries, payment.NextAttempt, clock.now.Add(PAYMENT_RETRY_INTERVAL))
+	}
+	if runs := manager.RunDuePayments(); len(runs) != 0 {
+		t.Fatalf("retried %d times before the retry interval passed", len(runs))
+	}
+
+	clock.Advance(PAYMENT_RETRY_INTERVAL)
+	if runs := manager.RunDuePayments(); len(runs) != 1 || runs[0].Succeeded {
+		t.Fatalf("second attempt: %+v; want one failed attempt", runs)
+	}
+
+	if err := manager.AddFunds(1, 100); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	clock.Advance(PAYMENT_RETRY_INTERVAL)
+	if runs := manager.RunDuePayments(); len(runs) != 1 || !runs[0].Succeeded {
+		t.Fatalf("third attempt: %+v; want it to succeed", runs)
+	}
+	if payment.Status != PAYMENT_COMPLETED {
+		t.Errorf("status %s; want %s", payment.Status, PAYMENT_COMPLETED)
+	}
+}
+
+func TestScheduledPaymentSkipsOccurrenceOnFrozenAccount(t *testing.T) {
+	start := time.Date(2024, 6, 10, 9, 0, 0, 0, time.Local)
+	manager, clock := newSchedulerTest(t, start, 1000)
+	payment, err := manager.SchedulePayment(1, OP_REMOVE_FUNDS, 100, FREQUENCY_MONTHLY, start, time.Time{})
+	if err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	if err := manager.SetAccountStatus(1, STATUS_FROZEN, "investigation"); err != nil {
+		t.Fatalf("freeze: %v", err)
+	}
+
+	if runs := manager.RunDuePayments(); len(runs) != 1 || runs[0].Succeeded {
+		t.Fatalf("frozen run: %+v; want one failed attempt", runs)
+	}
+	if payment.Status != PAYMENT_ACTIVE || payment.NextAttempt.Format(DATE_FORMAT) != "2024-07-10" {
+		t.Fatalf("payment %s, next %s; want it kept for 2024-07-10", payment.Status, payment.NextAttempt.Format(DATE_FORMAT))
+	}
+
+	if err := manager.SetAccountStatus(1, STATUS_ACTIVE, "cleared"); err != nil {
+		t.Fatalf("unfreeze: %v", err)
+	}
+	clock.now = time.Date(2024, 7, 10, 9, 0, 0, 0, time.Local)
+	if runs := manager.RunDuePayments(); len(runs) != 1 || !runs[0].Succeeded || runs[0].Occurrence != 1 {
+		t.Errorf("next month: %+v; want occurrence 1 posted", runs)
+	}
+}
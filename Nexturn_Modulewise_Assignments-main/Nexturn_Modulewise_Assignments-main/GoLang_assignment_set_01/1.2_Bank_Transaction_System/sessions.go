@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// API session settings
+const (
+	API_TOKEN_BYTES = 32
+	API_SESSION_TTL = 30 * time.Minute
+)
+
+// Operator credentials. Back-office routes take the key configured in the
+// environment variable, sent in the header; without a key configured they
+// are refused.
+const (
+	OPERATOR_KEY_ENV    = "BANK_OPERATOR_KEY"
+	OPERATOR_KEY_HEADER = "X-Operator-Key"
+)
+
+// Errors returned for requests without valid credentials
+var (
+	ErrLoginFailed     = errors.New("incorrect profile ID or PIN")
+	ErrUnauthenticated = errors.New("a valid session token is required")
+	ErrForbidden       = errors.New("the session does not allow access to this resource")
+)
+
+// apiSession is what a bearer token grants: access to one profile until
+// it expires
+type apiSession struct {
+	ProfileID int
+	ExpiresAt time.Time
+}
+
+// sessionStore keeps the API sessions issued since the server started.
+// Tokens are only held in memory, so a restart signs every client out.
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]apiSession
+}
+
+// newSessionStore creates an empty session store
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]apiSession)}
+}
+
+// issue creates a token for a profile
+func (s *sessionStore) issue(profileID int, now time.Time) (string, apiSession, error) {
+	raw := make([]byte, API_TOKEN_BYTES)
+	if _, err := rand.Read(raw); err != nil {
+		return "", apiSession{}, fmt.Errorf("failed to generate session token: %v", err)
+	}
+	token := hex.EncodeToString(raw)
+	session := apiSession{ProfileID: profileID, ExpiresAt: now.Add(API_SESSION_TTL)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, existing := range s.sessions {
+		if !now.Before(existing.ExpiresAt) {
+			delete(s.sessions, key)
+		}
+	}
+	s.sessions[token] = session
+	return token, session, nil
+}
+
+// lookup returns the session of a token that has not expired
+func (s *sessionStore) lookup(token string, now time.Time) (apiSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[token]
+	if !ok {
+		return apiSession{}, false
+	}
+	if !now.Before(session.ExpiresAt) {
+		delete(s.sessions, token)
+		return apiSession{}, false
+	}
+	return session, true
+}
+
+// revoke ends a session
+func (s *sessionStore) revoke(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, token)
+}
+
+// loginRequest is the body of POST /sessions
+type loginRequest struct {
+	ProfileID int    `json:"profile_id"`
+	PIN       string `json:"pin"`
+}
+
+// sessionView is the JSON response to a successful login
+type sessionView struct {
+	Token     string `json:"token"`
+	ProfileID int    `json:"profile_id"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// sessionKey is the request context key holding the caller's session
+type sessionKey struct{}
+
+// bearerToken reads the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// requireCustomer wraps a handler so it only runs for a request carrying a
+// live session token. When the route has an {id} segment it must be the
+// profile the session was issued for.
+func (s *APIServer) requireCustomer(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := s.sessions.lookup(bearerToken(r), s.manager.clock.Now())
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="bank"`)
+			writeError(w, ErrUnauthenticated)
+			return
+		}
+		if value := r.PathValue("id"); value != "" && value != strconv.Itoa(session.ProfileID) {
+			writeError(w, fmt.Errorf("%w (profile %s)", ErrForbidden, value))
+			return
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), sessionKey{}, session)))
+	}
+}
+
+// requireOperator wraps a back-office handler so it only runs for a
+// request carrying the operator key. Customer session tokens are not
+// accepted.
+func (s *APIServer) requireOperator(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(OPERATOR_KEY_HEADER)
+		if key == "" {
+			writeError(w, ErrUnauthenticated)
+			return
+		}
+		if s.operatorKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(s.operatorKey)) != 1 {
+			writeError(w, fmt.Errorf("%w: operator key required", ErrForbidden))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// sessionProfile returns the profile the request was authenticated as
+func sessionProfile(r *http.Request) int {
+	session, _ := r.Context().Value(sessionKey{}).(apiSession)
+	return session.ProfileID
+}
+
+// handleLogin checks a PIN and issues a session token. Every failure is
+// reported the same way so the response does not reveal which profiles
+// exist.
+func (s *APIServer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+
+	user, err := s.manager.VerifyPIN(req.ProfileID, req.PIN)
+	if err != nil {
+		// Failed attempts count towards the lockout, so keep them
+		if !errors.Is(err, ErrProfileNotFound) {
+			s.persist()
+		}
+		writeError(w, ErrLoginFailed)
+		return
+	}
+	s.persist()
+
+	token, session, err := s.sessions.issue(user.ProfileID, s.manager.clock.Now())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusCreated, sessionView{
+		Token:     token,
+		ProfileID: session.ProfileID,
+		ExpiresAt: session.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+// handleLogout revokes the session token of the request
+func (s *APIServer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	s.sessions.revoke(bearerToken(r))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DATE_FORMAT is used for statement periods and file names
+const DATE_FORMAT = "2006-01-02"
+
+// StatementLine is a single transaction shown on a statement
+type StatementLine struct {
+	TransactionID int
+	Timestamp     time.Time
+	Type          string
+	Credit        float64
+	Debit         float64
+	Balance       float64
+}
+
+// Statement summarises an account's activity over a period
+type Statement struct {
+	ProfileID      int
+	FullName       string
+	AccountType    string
+	Currency       string
+	From           time.Time
+	To             time.Time
+	OpeningBalance float64
+	Lines          []StatementLine
+	TotalCredits   float64
+	TotalDebits    float64
+	ClosingBalance float64
+}
+
+// GenerateStatement builds a statement for the transactions dated from
+// the start of the from day up to the end of the to day. Lines are in date
+// order, which is not always the order postings were stored in: a
+// back-dated or scheduled posting can carry an earlier date than the entry
+// stored before it.
+func (fm *FinancialManager) GenerateStatement(profileID int, from, to time.Time) (*Statement, error) {
+	from = startOfDay(from)
+	to = startOfDay(to)
+	if to.Before(from) {
+		return nil, errors.New("statement end date is before its start date")
+	}
+
+	user, err := fm.LocateUser(profileID)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &Statement{
+		ProfileID:   user.ProfileID,
+		FullName:    user.FullName,
+		AccountType: user.AccountType,
+		Currency:    user.Currency,
+		From:        from,
+		To:          to,
+		Lines:       make([]StatementLine, 0),
+	}
+
+	transactions := append([]Transaction(nil), user.Transactions...)
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Timestamp.Before(transactions[j].Timestamp)
+	})
+
+	end := to.AddDate(0, 0, 1)
+	balance := 0.0
+	for _, txn := range transactions {
+		if !txn.Timestamp.Before(end) {
+			break
+		}
+		balance = roundAmount(balance + txn.Amount)
+		if txn.Timestamp.Before(from) {
+			statement.OpeningBalance = balance
+			continue
+		}
+
+		line := StatementLine{
+			TransactionID: txn.ID,
+			Timestamp:     txn.Timestamp,
+			Type:          txn.Type,
+			Balance:       balance,
+		}
+		if txn.Amount >= 0 {
+			line.Credit = txn.Amount
+			statement.TotalCredits += txn.Amount
+		} else {
+			line.Debit = -txn.Amount
+			statement.TotalDebits += -txn.Amount
+		}
+		statement.Lines = append(statement.Lines, line)
+	}
+	statement.TotalCredits = roundAmount(statement.TotalCredits)
+	statement.TotalDebits = roundAmount(statement.TotalDebits)
+	statement.ClosingBalance = balance
+
+	return statement, nil
+}
+
+// RenderText writes the statement as a plain text report
+func (s *Statement) RenderText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Account Statement for Profile %d (%s)\n", s.ProfileID, s.FullName)
+	fmt.Fprintf(&b, "Account type: %s (%s)\n", s.AccountType, s.Currency)
+	fmt.Fprintf(&b, "Period: %s to %s\n", s.From.Format(DATE_FORMAT), s.To.Format(DATE_FORMAT))
+	fmt.Fprintln(&b, strings.Repeat("-", 84))
+	fmt.Fprintf(&b, "%-19s  %-18s  %12s  %12s  %14s\n", "Date", "Type", "Credit", "Debit", "Balance")
+	fmt.Fprintln(&b, strings.Repeat("-", 84))
+	fmt.Fprintf(&b, "%-19s  %-18s  %12s  %12s  %14.2f\n", s.From.Format(DATE_FORMAT), "OPENING_BALANCE", "", "", s.OpeningBalance)
+	for _, line := range s.Lines {
+		fmt.Fprintf(&b, "%-19s  %-18s  %12s  %12s  %14.2f\n",
+			line.Timestamp.Format(TIMESTAMP_FORMAT), line.Type,
+			formatStatementAmount(line.Credit), formatStatementAmount(line.Debit), line.Balance)
+	}
+	fmt.Fprintln(&b, strings.Repeat("-", 84))
+	fmt.Fprintf(&b, "Total credits:   %s\n", formatMoney(s.Currency, s.TotalCredits))
+	fmt.Fprintf(&b, "Total debits:    %s\n", formatMoney(s.Currency, s.TotalDebits))
+	fmt.Fprintf(&b, "Closing balance: %s\n", formatMoney(s.Currency, s.ClosingBalance))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// RenderCSV writes the statement as CSV with summary rows at either end
+func (s *Statement) RenderCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	records := [][]string{
+		{"Date", "Transaction ID", "Type", "Credit (" + s.Currency + ")", "Debit (" + s.Currency + ")", "Balance (" + s.Currency + ")"},
+		{s.From.Format(DATE_FORMAT), "", "OPENING_BALANCE", "", "", fmt.Sprintf("%.2f", s.OpeningBalance)},
+	}
+	for _, line := range s.Lines {
+		records = append(records, []string{
+			line.Timestamp.Format(TIMESTAMP_FORMAT),
+			fmt.Sprintf("%d", line.TransactionID),
+			line.Type,
+			formatStatementAmount(line.Credit),
+			formatStatementAmount(line.Debit),
+			fmt.Sprintf("%.2f", line.Balance),
+		})
+	}
+	records = append(records, []string{
+		s.To.Format(DATE_FORMAT), "", "CLOSING_BALANCE",
+		fmt.Sprintf("%.2f", s.TotalCredits), fmt.Sprintf("%.2f", s.TotalDebits), fmt.Sprintf("%.2f", s.ClosingBalance),
+	})
+
+	if err := writer.WriteAll(records); err != nil {
+		return fmt.Errorf("failed to write CSV statement: %v", err)
+	}
+	return nil
+}
+
+// statementHTML is the page layout for HTML statements
+var statementHTML = template.Must(template.New("statement").Funcs(template.FuncMap{
+	"amount":   formatStatementAmount,
+	"money":    formatMoney,
+	"date":     func(t time.Time) string { return t.Format(DATE_FORMAT) },
+	"datetime": func(t time.Time) string { return t.Format(TIMESTAMP_FORMAT) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Statement {{.ProfileID}} {{date .From}} - {{date .To}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #999; padding: 4px 8px; }
+td.num { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Account Statement</h1>
+<p>Profile {{.ProfileID}} ({{.FullName}}) &mdash; {{.AccountType}} account in {{.Currency}}</p>
+<p>Period: {{date .From}} to {{date .To}}</p>
+<table>
+<tr><th>Date</th><th>Type</th><th>Credit</th><th>Debit</th><th>Balance</th></tr>
+<tr><td>{{date .From}}</td><td>OPENING_BALANCE</td><td></td><td></td><td class="num">{{printf "%.2f" .OpeningBalance}}</td></tr>
+{{range .Lines}}<tr><td>{{datetime .Timestamp}}</td><td>{{.Type}}</td><td class="num">{{amount .Credit}}</td><td class="num">{{amount .Debit}}</td><td class="num">{{printf "%.2f" .Balance}}</td></tr>
+{{end}}</table>
+<p>Total credits: {{money .Currency .TotalCredits}}</p>
+<p>Total debits: {{money .Currency .TotalDebits}}</p>
+<p>Closing balance: {{money .Currency .ClosingBalance}}</p>
+</body>
+</html>
+`))
+
+// RenderHTML writes the statement as a standalone HTML page
+func (s *Statement) RenderHTML(w io.Writer) error {
+	if err := statementHTML.Execute(w, s); err != nil {
+		return fmt.Errorf("failed to render HTML statement: %v", err)
+	}
+	return nil
+}
+
+// formatStatementAmount prints an amount, leaving zero columns blank
+func formatStatementAmount(amount float64) string {
+	if amount == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", amount)
+}
+
+// WriteStatementFiles saves the statement as text, CSV and HTML files in dir
+// and returns the paths written
+func (s *Statement) WriteStatementFiles(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create statement directory: %v", err)
+	}
+
+	base := fmt.Sprintf("statement_%d_%s_%s", s.ProfileID, s.From.Format(DATE_FORMAT), s.To.Format(DATE_FORMAT))
+	renderers := []struct {
+		extension string
+		render    func(io.Writer) error
+	}{
+		{".txt", s.RenderText},
+		{".csv", s.RenderCSV},
+		{".html", s.RenderHTML},
+	}
+
+	paths := make([]string, 0, len(renderers))
+	for _, r := range renderers {
+		path := filepath.Join(dir, base+r.extension)
+		file, err := os.Create(path)
+		if err != nil {
+			return paths, fmt.Errorf("failed to create %s: %v", path, err)
+		}
+
+		err = r.render(file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statementDay returns a local time on a day of 2024
+func statementDay(month time.Month, day, hour, minute int) time.Time {
+	return time.Date(2024, month, day, hour, minute, 0, 0, time.Local)
+}
+
+// newStatementTest posts a history that crosses month ends, with one
+// back-dated deposit stored after postings dated later than it
+func newStatementTest(t *testing.T) *FinancialManager {
+	t.Helper()
+	clock := &manualClock{}
+	manager := InitializeManager()
+	manager.SetClock(clock)
+
+	postings := []struct {
+		at     time.Time
+		amount float64
+	}{
+		{statementDay(time.January, 10, 9, 0), 1000},
+		{statementDay(time.February, 1, 9, 0), -200},
+		{statementDay(time.February, 29, 23, 59), 50},
+		{statementDay(time.March, 1, 0, 0), -100},
+		{statementDay(time.January, 31, 12, 0), 300},
+	}
+	for i, posting := range postings {
+		clock.now = posting.at
+		if i == 0 {
+			if _, err := manager.RegisterCustomer(1, "Ann <& Co>", CURRENT_ACCOUNT, "1234"); err != nil {
+				t.Fatalf("register: %v", err)
+			}
+		}
+		var err error
+		if posting.amount > 0 {
+			err = manager.AddFunds(1, posting.amount)
+		} else {
+			err = manager.RemoveFunds(1, -posting.amount)
+		}
+		if err != nil {
+			t.Fatalf("posting %d: %v", i+1, err)
+		}
+	}
+	return manager
+}
+
+// statementIDs lists the transaction IDs on a statement
+func statementIDs(statement *Statement) []int {
+	ids := make([]int, 0, len(statement.Lines))
+	for _, line := range statement.Lines {
+		ids = append(ids, line.TransactionID)
+	}
+	return ids
+}
+
+func TestStatementPeriods(t *testing.T) {
+	manager := newStatementTest(t)
+	cases := []struct {
+		name             string
+		from, to         time.Time
+		opening, closing float64
+		credits, debits  float64
+		ids              []int
+		balances         []float64
+	}{
+		{
+			name: "january with a back-dated deposit", from: statementDay(time.January, 1, 0, 0), to: statementDay(time.January, 31, 0, 0),
+			opening: 0, closing: 1300, credits: 1300, debits: 0, ids: []int{1, 5}, balances: []float64{1000, 1300},
+		},
+		{
+			name: "february up to its last minute", from: statementDay(time.February, 1, 0, 0), to: statementDay(time.February, 29, 0, 0),
+			opening: 1300, closing: 1150, credits: 50, debits: 200, ids: []int{2, 3}, balances: []float64{1100, 1150},
+		},
+		{
+			name: "a single day from midnight", from: statementDay(time.March, 1, 15, 0), to: statementDay(time.March, 1, 8, 0),
+			opening: 1150, closing: 1050, credits: 0, debits: 100, ids: []int{4}, balances: []float64{1050},
+		},
+		{
+			name: "after the last posting", from: statementDay(time.March, 2, 0, 0), to: statementDay(time.March, 31, 0, 0),
+			opening: 1050, closing: 1050, ids: []int{}, balances: []float64{},
+		},
+		{
+			name: "before the first posting", from: statementDay(time.January, 1, 0, 0), to: statementDay(time.January, 9, 0, 0),
+			opening: 0, closing: 0, ids: []int{}, balances: []float64{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			statement, err := manager.GenerateStatement(1, tc.from, tc.to)
+			if err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+			if statement.OpeningBalance != tc.opening || statement.ClosingBalance != tc.closing {
+				t.Errorf("opening %.2f, closing %.2f; want %.2f and %.2f",
+					statement.OpeningBalance, statement.ClosingBalance, tc.opening, tc.closing)
+			}
+			if statement.TotalCredits != tc.credits || statement.TotalDebits != tc.debits {
+				t.Errorf("credits %.2f, debits %.2f; want %.2f and %.2f",
+					statement.TotalCredits, statement.TotalDebits, tc.credits, tc.debits)
+			}
+			if ids := statementIDs(statement); !reflect.DeepEqual(ids, tc.ids) {
+				t.Errorf("lines %v; want %v", ids, tc.ids)
+			}
+			balances := make([]float64, 0, len(statement.Lines))
+			for _, line := range statement.Lines {
+				balances = append(balances, line.Balance)
+			}
+			if !reflect.DeepEqual(balances, tc.balances) {
+				t.Errorf("running balances %v; want %v", balances, tc.balances)
+			}
+		})
+	}
+
+	if _, err := manager.GenerateStatement(1, statementDay(time.March, 2, 0, 0), statementDay(time.March, 1, 0, 0)); err == nil {
+		t.Error("statement ending before it starts was generated")
+	}
+	if _, err := manager.GenerateStatement(9, statementDay(time.March, 1, 0, 0), statementDay(time.March, 1, 0, 0)); err == nil {
+		t.Error("statement generated for an unknown profile")
+	}
+}
+
+func TestStatementRenderers(t *testing.T) {
+	manager := newStatementTest(t)
+	statement, err := manager.GenerateStatement(1, statementDay(time.February, 1, 0, 0), statementDay(time.February, 29, 0, 0))
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	t.Run("text", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := statement.RenderText(&out); err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		for _, want := range []string{
+			"Account Statement for Profile 1 (Ann <& Co>)",
+			"Period: 2024-02-01 to 2024-02-29",
+			"OPENING_BALANCE", "1300.00",
+			"2024-02-29 23:59:00  ADD_FUNDS",
+			"Total credits:   Rs.50.00",
+			"Total debits:    Rs.200.00",
+			"Closing balance: Rs.1150.00",
+		} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("text statement does not contain %q:\n%s", want, out.String())
+			}
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := statement.RenderCSV(&out); err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		records, err := csv.NewReader(&out).ReadAll()
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		want := [][]string{
+			{"Date", "Transaction ID", "Type", "Credit (INR)", "Debit (INR)", "Balance (INR)"},
+			{"2024-02-01", "", "OPENING_BALANCE", "", "", "1300.00"},
+			{"2024-02-01 09:00:00", "2", "REMOVE_FUNDS", "", "200.00", "1100.00"},
+			{"2024-02-29 23:59:00", "3", "ADD_FUNDS", "50.00", "", "1150.00"},
+			{"2024-02-29", "", "CLOSING_BALANCE", "50.00", "200.00", "1150.00"},
+		}
+		if !reflect.DeepEqual(records, want) {
+			t.Errorf("CSV records\n%q\nwant\n%q", records, want)
+		}
+	})
+
+	t.Run("html", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := statement.RenderHTML(&out); err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		page := out.String()
+		for _, want := range []string{
+			"Profile 1 (Ann &lt;&amp; Co&gt;)",
+			`<td class="num">1300.00</td>`,
+			`<td>2024-02-01 09:00:00</td><td>REMOVE_FUNDS</td><td class="num"></td><td class="num">200.00</td><td class="num">1100.00</td>`,
+			"Closing balance: Rs.1150.00",
+		} {
+			if !strings.Contains(page, want) {
+				t.Errorf("HTML statement does not contain %q:\n%s", want, page)
+			}
+		}
+		if strings.Contains(page, "<& Co>") {
+			t.Error("account name was not escaped")
+		}
+	})
+
+	t.Run("files", func(t *testing.T) {
+		paths, err := statement.WriteStatementFiles(t.TempDir())
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if len(paths) != 3 {
+			t.Fatalf("wrote %v; want text, CSV and HTML files", paths)
+		}
+		for _, path := range paths {
+			if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+				t.Errorf("%s: %v", path, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DATA_FILE is where the menu keeps account data between runs
+const DATA_FILE = "bank_data.json"
+
+// CURRENT_SCHEMA_VERSION is written to every data file. A file with any
+// other version is refused rather than migrated, since re-chaining a
+// history nobody can verify would sign whatever the file says.
+const CURRENT_SCHEMA_VERSION = 1
+
+// snapshot is the on-disk form of the manager's state
+type snapshot struct {
+	SchemaVersion     int
+	Users             []*UserAccount
+	LastTransactionID int
+	IdempotencyKeys   map[string]*OperationResult
+	ScheduledPayments []*ScheduledPayment
+	LastPaymentID     int
+	Disputes          []*Dispute
+	LastDisputeID     int
+	Loans             []*Loan
+	LastLoanID        int
+	LoanRate          *float64
+	AlertRules        []*AlertRule
+	LastAlertRuleID   int
+}
+
+// EnableStorage loads existing account data from path, if present, and
+// makes Save write back to it
+func (fm *FinancialManager) EnableStorage(path string) error {
+	fm.dataFile = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fm.ledgerKey, err = loadLedgerKey(path, true)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read account data: %v", err)
+	}
+
+	var state snapshot
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse account data: %v", err)
+	}
+	if state.SchemaVersion != CURRENT_SCHEMA_VERSION {
+		return fmt.Errorf("account data has schema version %d; this build reads version %d",
+			state.SchemaVersion, CURRENT_SCHEMA_VERSION)
+	}
+
+	// The key is only ever created alongside a new data file; an existing
+	// file whose key is missing cannot be verified
+	if fm.ledgerKey, err = loadLedgerKey(path, false); err != nil {
+		return err
+	}
+
+	fm.users = state.Users
+	if fm.users == nil {
+		fm.users = make([]*UserAccount, 0)
+	}
+	fm.lastTransactionID = state.LastTransactionID
+	fm.idempotencyKeys = state.IdempotencyKeys
+	if fm.idempotencyKeys == nil {
+		fm.idempotencyKeys = make(map[string]*OperationResult)
+	}
+	fm.purgeIdempotencyKeys(fm.clock.Now())
+	fm.scheduledPayments = state.ScheduledPayments
+	fm.lastPaymentID = state.LastPaymentID
+	fm.disputes = state.Disputes
+	fm.lastDisputeID = state.LastDisputeID
+	fm.loans = state.Loans
+	fm.lastLoanID = state.LastLoanID
+	if state.LoanRate != nil {
+		fm.loanRate = *state.LoanRate
+	}
+	fm.alertRules = state.AlertRules
+	fm.lastAlertRuleID = state.LastAlertRuleID
+	return nil
+}
+
+// Save writes the account data to the storage file, if one is enabled
+func (fm *FinancialManager) Save() error {
+	if fm.dataFile == "" {
+		return nil
+	}
+
+	fm.purgeIdempotencyKeys(fm.clock.Now())
+	state := snapshot{
+		SchemaVersion:     CURRENT_SCHEMA_VERSION,
+		Users:             fm.users,
+		LastTransactionID: fm.lastTransactionID,
+		IdempotencyKeys:   fm.idempotencyKeys,
+		ScheduledPayments: fm.scheduledPayments,
+		LastPaymentID:     fm.lastPaymentID,
+		Disputes:          fm.disputes,
+		LastDisputeID:     fm.lastDisputeID,
+		Loans:             fm.loans,
+		LastLoanID:        fm.lastLoanID,
+		LoanRate:          &fm.loanRate,
+		AlertRules:        fm.alertRules,
+		LastAlertRuleID:   fm.lastAlertRuleID,
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode account data: %v", err)
+	}
+
+	// Write to a temporary file first so a crash cannot leave a partial file
+	tmpFile := filepath.Join(filepath.Dir(fm.dataFile), "."+filepath.Base(fm.dataFile)+".tmp")
+	if err := os.WriteFile(tmpFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to write account data: %v", err)
+	}
+	if err := os.Rename(tmpFile, fm.dataFile); err != nil {
+		return fmt.Errorf("failed to write account data: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+    "fmt"
+    "math"
+)
+
+// Adaptive testing settings. Abilities and difficulties share the logit
+// scale of the Rasch model, where 0 is an average candidate or question.
+const (
+    DEFAULT_TARGET_SE      = 0.4
+    ADAPTIVE_MIN_QUESTIONS = 3
+    MAX_DIFFICULTY         = 4.0
+    ABILITY_GRID_MIN       = -4.0
+    ABILITY_GRID_MAX       = 4.0
+    ABILITY_GRID_STEP      = 0.05
+)
+
+// AbilityEstimate is a candidate's estimated ability and its standard error
+type AbilityEstimate struct {
+    Theta         float64 `json:"theta"`
+    StandardError float64 `json:"standard_error"`
+}
+
+// itemResponse is the credit earned on a question of known difficulty
+type itemResponse struct {
+    difficulty float64
+    credit     float64
+}
+
+// AdaptiveTest picks each question to match the current ability estimate
+// and stops once the estimate is precise enough
+type AdaptiveTest struct {
+    pool         []Problem
+    used         []bool
+    asked        []int
+    responses    []itemResponse
+    estimate     AbilityEstimate
+    TargetSE     float64
+    MaxQuestions int
+}
+
+// NewAdaptiveTest draws questions from pool. maxQuestions of zero or more
+// than the pool allows every question to be used.
+func NewAdaptiveTest(pool []Problem, targetSE float64, maxQuestions int) *AdaptiveTest {
+    if targetSE <= 0 {
+        targetSE = DEFAULT_TARGET_SE
+    }
+    if maxQuestions <= 0 || maxQuestions > len(pool) {
+        maxQuestions = len(pool)
+    }
+    return &AdaptiveTest{
+        pool:         pool,
+        used:         make([]bool, len(pool)),
+        responses:    make([]itemResponse, 0, maxQuestions),
+        estimate:     estimateAbility(nil),
+        TargetSE:     targetSE,
+        MaxQuestions: maxQuestions,
+    }
+}
+
+// Estimate returns the current ability estimate
+func (a *AdaptiveTest) Estimate() AbilityEstimate {
+    return a.estimate
+}
+
+// Done reports whether the test should stop asking questions. Every
+// question shown counts towards MaxQuestions, including one a resumed
+// attempt left unanswered; only answers count towards the estimate.
+func (a *AdaptiveTest) Done() bool {
+    if len(a.asked) >= a.MaxQuestions {
+        return true
+    }
+    return len(a.responses) >= ADAPTIVE_MIN_QUESTIONS && a.estimate.StandardError <= a.TargetSE
+}
+
+// Next returns the unused question that is most informative at the current
+// ability estimate, which under the Rasch model is the one whose difficulty
+// is closest to it. It returns false once the test is done.
+func (a *AdaptiveTest) Next() (Problem, bool) {
+    if a.Done() {
+        return Problem{}, false
+    }
+
+    best, bestInformation := -1, -1.0
+    for i, problem := range a.pool {
+        if a.used[i] {
+            continue
+        }
+        information := itemInformation(a.estimate.Theta, problem.Difficulty)
+        if information > bestInformation {
+            best, bestInformation = i, information
+        }
+    }
+    if best < 0 {
+        return Problem{}, false
+    }
+    a.used[best] = true
+    a.asked = append(a.asked, best)
+    return a.pool[best], true
+}
+
+// Record adds the credit earned on a question and updates the estimate
+func (a *AdaptiveTest) Record(problem Problem, credit float64) {
+    a.responses = append(a.responses, itemResponse{difficulty: problem.Difficulty, credit: credit})
+    a.estimate = estimateAbility(a.responses)
+}
+
+// restore replays the questions asked before a checkpoint, given by their
+// place in the pool, and the answers they got
+func (a *AdaptiveTest) restore(asked []int, answers []AnswerRecord) {
+    for i, index := range asked {
+        if index < 0 || index >= len(a.pool) || i >= len(answers) {
+            break
+        }
+        a.used[index] = true
+        a.asked = append(a.asked, index)
+        outcome := answers[i].Outcome
+        if outcome == OUTCOME_ANSWERED || outcome == OUTCOME_TIMED_OUT {
+            a.Record(a.pool[index], answers[i].Credit)
+        }
+    }
+}
+
+// correctProbability is the Rasch model's chance that a candidate of
+// ability theta answers a question of the given difficulty correctly
+func correctProbability(theta, difficulty float64) float64 {
+    return 1 / (1 + math.Exp(difficulty-theta))
+}
+
+// itemInformation is how much a question tells us about ability near theta
+func itemInformation(theta, difficulty float64) float64 {
+    p := correctProbability(theta, difficulty)
+    return p * (1 - p)
+}
+
+// estimateAbility computes the expected a posteriori ability under a
+// standard normal prior. Partial credit counts as a fractional success.
+// The prior keeps the estimate finite when every answer is right or wrong.
+func estimateAbility(responses []itemResponse) AbilityEstimate {
+    points := make([]float64, 0)
+    logWeights := make([]float64, 0)
+    maxLog := math.Inf(-1)
+    for theta := ABILITY_GRID_MIN; theta <= ABILITY_GRID_MAX+1e-9; theta += ABILITY_GRID_STEP {
+        logWeight := -theta * theta / 2
+        for _, response := range responses {
+            p := correctProbability(theta, response.difficulty)
+            logWeight += response.credit*math.Log(p) + (1-response.credit)*math.Log(1-p)
+        }
+        points = append(points, theta)
+        logWeights = append(logWeights, logWeight)
+        maxLog = math.Max(maxLog, logWeight)
+    }
+
+    var total, mean float64
+    weights := make([]float64, len(points))
+    for i, logWeight := range logWeights {
+        weights[i] = math.Exp(logWeight - maxLog)
+        total += weights[i]
+        mean += weights[i] * points[i]
+    }
+    mean /= total
+
+    var variance float64
+    for i, theta := range points {
+        variance += weights[i] * (theta - mean) * (theta - mean)
+    }
+    variance /= total
+
+    return AbilityEstimate{Theta: mean, StandardError: math.Sqrt(variance)}
+}
+
+// String describes the estimate for the results screen
+func (a AbilityEstimate) String() string {
+    return fmt.Sprintf("%.2f (standard error %.2f)", a.Theta, a.StandardError)
+}
+
+// nextProblem returns the question to ask as the index-th of the attempt,
+// or false when the exam has no more questions
+func (e *Examination) nextProblem(index int) (Problem, bool) {
+    if e.Adaptive != nil {
+        return e.Adaptive.Next()
+    }
+    if index >= len(e.Problems) {
+        return Problem{}, false
+    }
+    return e.Problems[index], true
+}
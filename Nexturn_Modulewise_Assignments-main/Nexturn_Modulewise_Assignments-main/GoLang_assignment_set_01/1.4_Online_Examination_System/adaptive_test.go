@@ -0,0 +1,78 @@
+package main
+
+import (
+    "math"
+    "testing"
+)
+
+func TestEstimateAbilityFollowsAnswers(t *testing.T) {
+    prior := estimateAbility(nil)
+    if math.Abs(prior.Theta) > 1e-6 || math.Abs(prior.StandardError-1) > 0.01 {
+        t.Fatalf("prior estimate = %+v; want theta 0, standard error 1", prior)
+    }
+
+    right := estimateAbility([]itemResponse{{0, 1}, {0.5, 1}, {1, 1}})
+    wrong := estimateAbility([]itemResponse{{0, 0}, {-0.5, 0}, {-1, 0}})
+    if right.Theta <= 0 || wrong.Theta >= 0 {
+        t.Errorf("right answers gave %.2f, wrong answers %.2f; want positive and negative", right.Theta, wrong.Theta)
+    }
+    if right.StandardError >= prior.StandardError {
+        t.Errorf("standard error did not shrink: %.2f", right.StandardError)
+    }
+
+    partial := estimateAbility([]itemResponse{{0, 0.5}})
+    if math.Abs(partial.Theta) > 1e-6 {
+        t.Errorf("half credit on an average question gave %.2f; want 0", partial.Theta)
+    }
+}
+
+func TestAdaptiveTestPicksMatchingDifficulty(t *testing.T) {
+    pool := []Problem{
+        {Statement: "hard", Difficulty: 2},
+        {Statement: "average", Difficulty: 0.1},
+        {Statement: "harder", Difficulty: 3},
+        {Statement: "easy", Difficulty: -2},
+    }
+    test := NewAdaptiveTest(pool, 0.01, 3)
+
+    first, _ := test.Next()
+    if first.Statement != "average" {
+        t.Fatalf("first question = %q; want the one nearest ability 0", first.Statement)
+    }
+    test.Record(first, 1)
+
+    second, _ := test.Next()
+    if second.Statement != "hard" {
+        t.Errorf("after a right answer got %q; want a harder question", second.Statement)
+    }
+    test.Record(second, 0)
+
+    test.Next()
+    test.Record(Problem{}, 0)
+    if _, ok := test.Next(); ok {
+        t.Error("test kept going past MaxQuestions")
+    }
+}
+
+func TestResumedUnansweredQuestionCountsTowardsMax(t *testing.T) {
+    pool := []Problem{
+        {Statement: "hard", Difficulty: 2},
+        {Statement: "average", Difficulty: 0.1},
+        {Statement: "harder", Difficulty: 3},
+        {Statement: "easy", Difficulty: -2},
+    }
+    test := NewAdaptiveTest(pool, 0.01, 3)
+
+    // The attempt was interrupted while the third question was on screen
+    test.restore([]int{1, 0, 2}, []AnswerRecord{
+        {Statement: "average", Outcome: OUTCOME_ANSWERED, Credit: 1},
+        {Statement: "hard", Outcome: OUTCOME_ANSWERED, Credit: 0},
+        {Statement: "harder", Outcome: OUTCOME_UNANSWERED},
+    })
+    if !test.Done() {
+        t.Error("resumed test is not done after showing MaxQuestions questions")
+    }
+    if problem, ok := test.Next(); ok {
+        t.Errorf("resumed test asked %q past MaxQuestions", problem.Statement)
+    }
+}
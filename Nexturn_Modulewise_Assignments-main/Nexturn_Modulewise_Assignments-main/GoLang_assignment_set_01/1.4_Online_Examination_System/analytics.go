@@ -0,0 +1,288 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "math"
+    "os"
+    "sort"
+    "strings"
+)
+
+// Item analysis settings. A question is flagged for review when it is
+// answered correctly by too few or too many candidates, when it does not
+// separate strong candidates from weak ones, or when a distractor does not
+// work.
+const (
+    MIN_ITEM_RESPONSES   = 5
+    DISCRIMINATION_GROUP = 0.27
+    TOO_HARD_PERCENT     = 20.0
+    TOO_EASY_PERCENT     = 95.0
+    LOW_DISCRIMINATION   = 0.2
+    MIN_DISTRACTOR_SHARE = 0.05
+)
+
+// OptionStats is how often one option of a question was picked
+type OptionStats struct {
+    Text   string
+    Right  bool
+    Picked int
+}
+
+// ItemStats describes how a question performed across attempts.
+// Discrimination is the difference in average credit between the top and
+// bottom scoring groups of candidates, and is nil when there are too few
+// attempts to form the groups.
+type ItemStats struct {
+    Number         int
+    Statement      string
+    Type           string
+    Responses      int
+    Answered       int
+    TimedOut       int
+    Unanswered     int
+    Difficulty     float64
+    Discrimination *float64
+    AverageSeconds float64
+    Options        []OptionStats
+    Flags          []string
+}
+
+// AttemptsAt returns every recorded attempt at a bank
+func (s *ResultStore) AttemptsAt(bank string) ([]AttemptRecord, error) {
+    records, err := s.Load()
+    if err != nil {
+        return nil, err
+    }
+
+    attempts := make([]AttemptRecord, 0)
+    for _, record := range records {
+        if strings.EqualFold(record.Bank, bank) {
+            attempts = append(attempts, record)
+        }
+    }
+    return attempts, nil
+}
+
+// itemResult is one answer to a question and the attempt it came from
+type itemResult struct {
+    answer  AnswerRecord
+    attempt int
+}
+
+// AnalyzeItems computes statistics for each of the bank's questions from
+// the recorded attempts. Answers are matched to questions by statement,
+// which validation keeps unique within a bank, so the analysis holds however
+// the questions and choices were shuffled.
+func AnalyzeItems(bank *QuestionBank, attempts []AttemptRecord) []ItemStats {
+    results := make(map[string][]itemResult)
+    for i, attempt := range attempts {
+        for _, answer := range attempt.Answers {
+            if answer.Outcome == OUTCOME_NOT_REACHED {
+                continue
+            }
+            key := strings.TrimSpace(answer.Statement)
+            results[key] = append(results[key], itemResult{answer: answer, attempt: i})
+        }
+    }
+    upper, lower := discriminationGroups(attempts)
+
+    stats := make([]ItemStats, len(bank.Problems))
+    for i, problem := range bank.Problems {
+        stats[i] = analyzeItem(problem, results[strings.TrimSpace(problem.Statement)], upper, lower)
+        stats[i].Number = i + 1
+    }
+    return stats
+}
+
+// discriminationGroups splits the attempts into the top and bottom scoring
+// groups. Adaptive attempts are left out as their percentages come from
+// different questions.
+func discriminationGroups(attempts []AttemptRecord) (map[int]bool, map[int]bool) {
+    ranked := make([]int, 0, len(attempts))
+    for i, attempt := range attempts {
+        if attempt.Ability == nil {
+            ranked = append(ranked, i)
+        }
+    }
+    size := int(math.Round(float64(len(ranked)) * DISCRIMINATION_GROUP))
+    if len(ranked) < MIN_ITEM_RESPONSES || size == 0 {
+        return nil, nil
+    }
+    sort.SliceStable(ranked, func(i, j int) bool {
+        return attempts[ranked[i]].Percentage > attempts[ranked[j]].Percentage
+    })
+
+    upper := make(map[int]bool, size)
+    lower := make(map[int]bool, size)
+    for i := 0; i < size; i++ {
+        upper[ranked[i]] = true
+        lower[ranked[len(ranked)-1-i]] = true
+    }
+    return upper, lower
+}
+
+// analyzeItem computes the statistics of one question from its answers
+func analyzeItem(problem Problem, results []itemResult, upper, lower map[int]bool) ItemStats {
+    stats := ItemStats{
+        Statement: problem.Statement,
+        Type:      problem.kind(),
+        Responses: len(results),
+    }
+
+    texts, right := problem.options()
+    picks := make(map[string]int, len(texts))
+    var credit, seconds, upperCredit, lowerCredit float64
+    var upperCount, lowerCount int
+    for _, result := range results {
+        answer := result.answer
+        credit += answer.Credit
+        switch answer.Outcome {
+        case OUTCOME_ANSWERED:
+            stats.Answered++
+            seconds += answer.Seconds
+            for _, selected := range answer.Selected {
+                picks[selected]++
+            }
+        case OUTCOME_TIMED_OUT:
+            stats.TimedOut++
+        default:
+            stats.Unanswered++
+        }
+        if upper[result.attempt] {
+            upperCredit += answer.Credit
+            upperCount++
+        }
+        if lower[result.attempt] {
+            lowerCredit += answer.Credit
+            lowerCount++
+        }
+    }
+
+    if stats.Responses > 0 {
+        stats.Difficulty = credit / float64(stats.Responses) * 100
+    }
+    if stats.Answered > 0 {
+        stats.AverageSeconds = seconds / float64(stats.Answered)
+    }
+    if upperCount > 0 && lowerCount > 0 {
+        discrimination := upperCredit/float64(upperCount) - lowerCredit/float64(lowerCount)
+        stats.Discrimination = &discrimination
+    }
+    for i, text := range texts {
+        stats.Options = append(stats.Options, OptionStats{Text: text, Right: right[i], Picked: picks[text]})
+    }
+
+    stats.Flags = reviewFlags(stats)
+    return stats
+}
+
+// reviewFlags explains why a question needs review, if it does. Questions
+// with too few responses are not judged.
+func reviewFlags(stats ItemStats) []string {
+    if stats.Responses < MIN_ITEM_RESPONSES {
+        return nil
+    }
+
+    flags := make([]string, 0)
+    switch {
+    case stats.Difficulty < TOO_HARD_PERCENT:
+        flags = append(flags, fmt.Sprintf("very hard: only %.0f%% correct", stats.Difficulty))
+    case stats.Difficulty > TOO_EASY_PERCENT:
+        flags = append(flags, fmt.Sprintf("very easy: %.0f%% correct", stats.Difficulty))
+    }
+    if stats.Discrimination != nil {
+        switch {
+        case *stats.Discrimination < 0:
+            flags = append(flags, fmt.Sprintf("negative discrimination (%.2f): weaker candidates do better, check the answer key", *stats.Discrimination))
+        case *stats.Discrimination < LOW_DISCRIMINATION:
+            flags = append(flags, fmt.Sprintf("low discrimination (%.2f)", *stats.Discrimination))
+        }
+    }
+
+    mostPickedRight := 0
+    for _, option := range stats.Options {
+        if option.Right && option.Picked > mostPickedRight {
+            mostPickedRight = option.Picked
+        }
+    }
+    for _, option := range stats.Options {
+        switch {
+        case option.Right:
+        case float64(option.Picked) < MIN_DISTRACTOR_SHARE*float64(stats.Answered):
+            flags = append(flags, fmt.Sprintf("distractor %q is almost never chosen", option.Text))
+        case option.Picked > mostPickedRight:
+            flags = append(flags, fmt.Sprintf("distractor %q is chosen more than the right answer", option.Text))
+        }
+    }
+    return flags
+}
+
+// WriteItemAnalysis prints the statistics of each question and what to review
+func WriteItemAnalysis(w io.Writer, bank string, attemptCount int, stats []ItemStats) {
+    if attemptCount == 0 {
+        fmt.Fprintf(w, "No attempts recorded for %s.\n", bank)
+        return
+    }
+
+    fmt.Fprintf(w, "Item analysis: %s (%d attempts)\n", bank, attemptCount)
+    flagged := 0
+    for _, item := range stats {
+        discrimination := "n/a"
+        if item.Discrimination != nil {
+            discrimination = fmt.Sprintf("%.2f", *item.Discrimination)
+        }
+        fmt.Fprintf(w, "\n%d. %s\n", item.Number, item.Statement)
+        fmt.Fprintf(w, "   Responses: %d (answered %d, timed out %d, unanswered %d)\n",
+            item.Responses, item.Answered, item.TimedOut, item.Unanswered)
+        fmt.Fprintf(w, "   Difficulty: %.1f%% correct  Discrimination: %s  Average time: %.1fs\n",
+            item.Difficulty, discrimination, item.AverageSeconds)
+        for _, option := range item.Options {
+            marker := " "
+            if option.Right {
+                marker = "*"
+            }
+            share := 0.0
+            if item.Answered > 0 {
+                share = float64(option.Picked) / float64(item.Answered) * 100
+            }
+            fmt.Fprintf(w, "   %s %-40s %4d (%.0f%%)\n", marker, option.Text, option.Picked, share)
+        }
+        if item.Responses < MIN_ITEM_RESPONSES {
+            fmt.Fprintf(w, "   Too few responses to judge yet.\n")
+        }
+        if len(item.Flags) > 0 {
+            flagged++
+        }
+        for _, flag := range item.Flags {
+            fmt.Fprintf(w, "   Review: %s\n", flag)
+        }
+    }
+    fmt.Fprintf(w, "\n%d of %d questions flagged for review.\n", flagged, len(stats))
+}
+
+// analyzeBank prints the item analysis of the named bank, which is looked
+// up among the available banks so every question is listed
+func analyzeBank(store *ResultStore, name, bankFile, bankDir string) error {
+    banks, err := loadQuestionBanks(bankFile, bankDir)
+    if err != nil {
+        return err
+    }
+    var bank *QuestionBank
+    for _, candidate := range banks {
+        if strings.EqualFold(candidate.Name, name) {
+            bank = candidate
+            break
+        }
+    }
+    if bank == nil {
+        return fmt.Errorf("question bank %q not found", name)
+    }
+
+    attempts, err := store.AttemptsAt(bank.Name)
+    if err != nil {
+        return err
+    }
+    WriteItemAnalysis(os.Stdout, bank.Name, len(attempts), AnalyzeItems(bank, attempts))
+    return nil
+}
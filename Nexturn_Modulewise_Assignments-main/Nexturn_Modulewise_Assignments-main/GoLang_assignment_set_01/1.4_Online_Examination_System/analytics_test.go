@@ -0,0 +1,75 @@
+package main
+
+import (
+    "math"
+    "strings"
+    "testing"
+)
+
+func TestAnalyzeItems(t *testing.T) {
+    bank := &QuestionBank{
+        Name: "Analysis",
+        Problems: []Problem{
+            {Statement: "Capital of France?", Choices: []string{"Paris", "Rome", "Oslo"}, RightAnswer: 1},
+            {Statement: "Trick?", Choices: []string{"Right", "Wrong"}, RightAnswer: 1},
+        },
+    }
+
+    // Five strong candidates get the capital right, five weak ones pick
+    // Rome; the trick question is only answered right by the weak ones
+    attempts := make([]AttemptRecord, 0)
+    for i := 0; i < 10; i++ {
+        strong := i < 5
+        capital := AnswerRecord{Statement: "Capital of France?", Outcome: OUTCOME_ANSWERED, Seconds: 4, Selected: []string{"Rome"}}
+        trick := AnswerRecord{Statement: "Trick?", Outcome: OUTCOME_ANSWERED, Seconds: 8, Selected: []string{"Right"}, Credit: 1}
+        percentage := 20.0
+        if strong {
+            capital.Selected, capital.Credit = []string{"Paris"}, 1
+            trick.Selected, trick.Credit = []string{"Wrong"}, 0
+            percentage = 80
+        }
+        attempts = append(attempts, AttemptRecord{Percentage: percentage, Answers: []AnswerRecord{capital, trick}})
+    }
+
+    stats := AnalyzeItems(bank, attempts)
+    capital, trick := stats[0], stats[1]
+    if capital.Responses != 10 || capital.Difficulty != 50 || capital.AverageSeconds != 4 {
+        t.Errorf("capital: %d responses, %.1f%% correct, %.1fs; want 10, 50%%, 4s",
+            capital.Responses, capital.Difficulty, capital.AverageSeconds)
+    }
+    if capital.Discrimination == nil || math.Abs(*capital.Discrimination-1) > 1e-9 {
+        t.Errorf("capital discrimination = %v; want 1", capital.Discrimination)
+    }
+    if picks := []int{capital.Options[0].Picked, capital.Options[1].Picked, capital.Options[2].Picked}; picks[0] != 5 || picks[1] != 5 || picks[2] != 0 {
+        t.Errorf("capital picks = %v; want [5 5 0]", picks)
+    }
+    if len(capital.Flags) != 1 || !strings.Contains(capital.Flags[0], `"Oslo"`) {
+        t.Errorf("capital flags = %q; want only the unused distractor", capital.Flags)
+    }
+
+    if trick.Discrimination == nil || *trick.Discrimination >= 0 {
+        t.Fatalf("trick discrimination = %v; want negative", trick.Discrimination)
+    }
+    if len(trick.Flags) == 0 || !strings.HasPrefix(trick.Flags[0], "negative discrimination") {
+        t.Errorf("trick flags = %q; want negative discrimination flagged", trick.Flags)
+    }
+}
+
+func TestSelectedOptionsUseChoiceText(t *testing.T) {
+    correct := true
+    cases := []struct {
+        problem  Problem
+        response string
+        want     string
+    }{
+        {Problem{Choices: []string{"a", "b", "c"}, RightAnswer: 1}, "2", "b"},
+        {Problem{Type: MULTI_SELECT, Choices: []string{"a", "b", "c"}, RightAnswers: []int{1, 3}}, "3, 1", "a,c"},
+        {Problem{Type: TRUE_FALSE, Correct: &correct}, "f", "False"},
+        {Problem{Type: SHORT_ANSWER, AcceptedAnswers: []string{"x"}}, "x", ""},
+    }
+    for _, c := range cases {
+        if got := strings.Join(c.problem.selectedOptions(c.response), ","); got != c.want {
+            t.Errorf("selectedOptions(%q) = %q; want %q", c.response, got, c.want)
+        }
+    }
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/url"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+// DEFAULT_CHECKPOINT_DIR is where unfinished attempts are saved
+const DEFAULT_CHECKPOINT_DIR = "checkpoints"
+
+// Checkpoint is everything needed to carry on an unfinished attempt: the
+// questions in the order they were dealt, the answers submitted so far and
+// how much of the exam time has been used
+type Checkpoint struct {
+    CandidateID       string         `json:"candidate_id"`
+    Bank              string         `json:"bank"`
+    Options           ExamOptions    `json:"options"`
+    Scoring           ScoringRules   `json:"scoring"`
+    QuestionTimeLimit time.Duration  `json:"question_time_limit"`
+    ExamDuration      time.Duration  `json:"exam_duration"`
+    Problems          []Problem      `json:"problems"`
+    Asked             []int          `json:"asked,omitempty"`
+    Answers           []AnswerRecord `json:"answers"`
+    TotalScore        float64        `json:"total_score"`
+    CorrectCount      int            `json:"correct_count"`
+    StartedAt         time.Time      `json:"started_at"`
+    Elapsed           time.Duration  `json:"elapsed"`
+    SavedAt           time.Time      `json:"saved_at"`
+}
+
+// CheckpointStore keeps one checkpoint file per candidate in a directory
+type CheckpointStore struct {
+    dir string
+}
+
+// NewCheckpointStore returns a store saving checkpoints in dir
+func NewCheckpointStore(dir string) *CheckpointStore {
+    return &CheckpointStore{dir: dir}
+}
+
+// path returns the checkpoint file of a candidate
+func (s *CheckpointStore) path(candidateID string) string {
+    return filepath.Join(s.dir, url.PathEscape(candidateID)+".json")
+}
+
+// Save replaces the candidate's checkpoint. The file is written under a
+// temporary name and renamed so a crash never leaves half a checkpoint.
+func (s *CheckpointStore) Save(checkpoint Checkpoint) error {
+    data, err := json.MarshalIndent(checkpoint, "", "  ")
+    if err != nil {
+        return fmt.Errorf("failed to encode checkpoint: %v", err)
+    }
+    if err := os.MkdirAll(s.dir, 0755); err != nil {
+        return fmt.Errorf("failed to create checkpoint directory: %v", err)
+    }
+
+    path := s.path(checkpoint.CandidateID)
+    temp := path + ".tmp"
+    if err := os.WriteFile(temp, data, 0644); err != nil {
+        return fmt.Errorf("failed to write checkpoint: %v", err)
+    }
+    if err := os.Rename(temp, path); err != nil {
+        return fmt.Errorf("failed to write checkpoint: %v", err)
+    }
+    return nil
+}
+
+// Load returns the candidate's checkpoint, or nil if there is none
+func (s *CheckpointStore) Load(candidateID string) (*Checkpoint, error) {
+    data, err := os.ReadFile(s.path(candidateID))
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to read checkpoint: %v", err)
+    }
+
+    var checkpoint Checkpoint
+    if err := json.Unmarshal(data, &checkpoint); err != nil {
+        return nil, fmt.Errorf("failed to parse checkpoint %s: %v", s.path(candidateID), err)
+    }
+    if checkpoint.CandidateID != candidateID || len(checkpoint.Problems) == 0 {
+        return nil, fmt.Errorf("checkpoint %s does not belong to %s", s.path(candidateID), candidateID)
+    }
+    return &checkpoint, nil
+}
+
+// Remove deletes the candidate's checkpoint if there is one
+func (s *CheckpointStore) Remove(candidateID string) error {
+    err := os.Remove(s.path(candidateID))
+    if err != nil && !errors.Is(err, os.ErrNotExist) {
+        return fmt.Errorf("failed to remove checkpoint: %v", err)
+    }
+    return nil
+}
+
+// ResumeExamination rebuilds an attempt from its checkpoint. Questions that
+// were already answered stay answered; the exam carries on with the next one.
+func ResumeExamination(checkpoint *Checkpoint, input *bufio.Scanner) *Examination {
+    exam := &Examination{
+        Problems:          checkpoint.Problems,
+        TotalScore:        checkpoint.TotalScore,
+        CorrectCount:      checkpoint.CorrectCount,
+        QuestionCount:     len(checkpoint.Problems),
+        InputReader:       input,
+        QuestionTimeLimit: checkpoint.QuestionTimeLimit,
+        ExamDuration:      checkpoint.ExamDuration,
+        Clock:             realClock{},
+        Options:           checkpoint.Options,
+        Scoring:           checkpoint.Scoring,
+        Answers:           checkpoint.Answers,
+        StartedAt:         checkpoint.StartedAt,
+        elapsed:           checkpoint.Elapsed,
+    }
+    if exam.Options.Adaptive {
+        exam.Adaptive = NewAdaptiveTest(exam.Problems, exam.Options.TargetSE, exam.Options.MaxQuestions)
+        exam.Adaptive.restore(checkpoint.Asked, checkpoint.Answers)
+        exam.QuestionCount = exam.Adaptive.MaxQuestions
+    }
+    return exam
+}
+
+// EnableCheckpoints saves the attempt to store after every question so it
+// can be resumed if the exam is interrupted
+func (e *Examination) EnableCheckpoints(store *CheckpointStore, candidateID, bank string) {
+    e.checkpoints = store
+    e.candidateID = candidateID
+    e.bankName = bank
+}
+
+// Resumable reports whether the attempt ended early with its progress saved
+func (e *Examination) Resumable() bool {
+    return e.checkpoints != nil && (e.EndReason == END_INTERRUPTED || e.EndReason == END_INPUT_CLOSED)
+}
+
+// timeUsed is the exam time spent so far, across every sitting
+func (e *Examination) timeUsed() time.Duration {
+    if e.sittingStartedAt.IsZero() {
+        return e.elapsed
+    }
+    return e.elapsed + e.Clock.Now().Sub(e.sittingStartedAt)
+}
+
+// saveCheckpoint records the attempt's progress. A failure is reported but
+// does not stop the exam.
+func (e *Examination) saveCheckpoint() {
+    if e.checkpoints == nil {
+        return
+    }
+    checkpoint := Checkpoint{
+        CandidateID:       e.candidateID,
+        Bank:              e.bankName,
+        Options:           e.Options,
+        Scoring:           e.Scoring,
+        QuestionTimeLimit: e.QuestionTimeLimit,
+        ExamDuration:      e.ExamDuration,
+        Problems:          e.Problems,
+        Answers:           e.Answers,
+        TotalScore:        e.TotalScore,
+        CorrectCount:      e.CorrectCount,
+        StartedAt:         e.StartedAt,
+        Elapsed:           e.timeUsed(),
+        SavedAt:           e.Clock.Now(),
+    }
+    if e.Adaptive != nil {
+        checkpoint.Asked = e.Adaptive.asked[:len(e.Answers)]
+    }
+    if err := e.checkpoints.Save(checkpoint); err != nil {
+        fmt.Printf("Warning: progress could not be saved: %v\n", err)
+    }
+}
+
+// removeCheckpoint deletes the saved progress of a finished attempt
+func (e *Examination) removeCheckpoint() {
+    if e.checkpoints == nil {
+        return
+    }
+    if err := e.checkpoints.Remove(e.candidateID); err != nil {
+        fmt.Printf("Warning: %v\n", err)
+    }
+}
+
+// offerResume asks the candidate whether to carry on their unfinished
+// attempt. Declining records the unfinished attempt as interrupted so its
+// questions cannot simply be seen again in a fresh attempt unnoticed.
+func offerResume(checkpoints *CheckpointStore, store *ResultStore, candidateID string, input *bufio.Scanner) (*Examination, error) {
+    checkpoint, err := checkpoints.Load(candidateID)
+    if err != nil || checkpoint == nil {
+        return nil, err
+    }
+
+    exam := ResumeExamination(checkpoint, input)
+    exam.bankName = checkpoint.Bank
+    fmt.Printf("You have an unfinished attempt at %s (%d of %d questions done, %v of exam time used).\n",
+        checkpoint.Bank, len(checkpoint.Answers), exam.QuestionCount, checkpoint.Elapsed.Round(time.Second))
+    for {
+        fmt.Print("Resume it? (y/n): ")
+        if !input.Scan() {
+            return nil, errors.New("no answer to whether to resume the unfinished attempt")
+        }
+        resume, err := parseTrueFalse(input.Text())
+        if err != nil {
+            fmt.Println("Please enter y or n.")
+            continue
+        }
+        if resume {
+            return exam, nil
+        }
+        break
+    }
+
+    exam.EndReason = END_INTERRUPTED
+    exam.FinishedAt = checkpoint.SavedAt
+    if exam.Adaptive != nil {
+        exam.QuestionCount = len(exam.Answers)
+    }
+    if err := store.Append(exam.Record(candidateID, checkpoint.Bank)); err != nil {
+        return nil, err
+    }
+    if err := checkpoints.Remove(candidateID); err != nil {
+        return nil, err
+    }
+    fmt.Println("The unfinished attempt has been recorded as interrupted.")
+    return nil, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "io"
+    "testing"
+    "time"
+)
+
+func TestResumeCarriesOnFromCheckpoint(t *testing.T) {
+    store := NewCheckpointStore(t.TempDir())
+    bank := &QuestionBank{
+        Name:              "Resumable",
+        QuestionTimeLimit: 120,
+        Problems:          []Problem{
+            {Statement: "First?", Choices: []string{"a", "b"}, RightAnswer: 1},
+            {Statement: "Second?", Choices: []string{"a", "b"}, RightAnswer: 2},
+            {Statement: "Third?", Choices: []string{"a", "b"}, RightAnswer: 1},
+        },
+    }
+
+    // First sitting: answer one question, spend 10s on the second, then
+    // lose the terminal
+    pr, pw := io.Pipe()
+    clock := newFakeClock()
+    exam := NewExamination(bank, bufio.NewScanner(pr), ExamOptions{})
+    exam.Clock = clock
+    exam.ExamDuration = time.Minute
+    exam.EnableCheckpoints(store, "amy", bank.Name)
+
+    finished := make(chan struct{})
+    go func() {
+        exam.BeginExam(context.Background())
+        close(finished)
+    }()
+    writeLine(t, pw, "")
+    clock.waitForCalls(t, 2)
+    clock.Advance(20 * time.Second)
+    writeLine(t, pw, "1")
+    clock.waitForCalls(t, 3)
+    clock.Advance(10 * time.Second)
+    pw.Close()
+    <-finished
+
+    if !exam.Resumable() {
+        t.Fatalf("attempt ended with %q; want it resumable", exam.EndReason)
+    }
+    checkpoint, err := store.Load("amy")
+    if err != nil || checkpoint == nil {
+        t.Fatalf("Load() = %v, %v; want the saved checkpoint", checkpoint, err)
+    }
+    if len(checkpoint.Answers) != 2 || checkpoint.Elapsed != 30*time.Second {
+        t.Fatalf("checkpoint has %d answers and %v used; want 2 and 30s", len(checkpoint.Answers), checkpoint.Elapsed)
+    }
+    if outcome := checkpoint.Answers[1].Outcome; outcome != OUTCOME_UNANSWERED {
+        t.Fatalf("second question saved as %q; want %q", outcome, OUTCOME_UNANSWERED)
+    }
+
+    // Second sitting: the second question was already seen, so the third
+    // comes next and only 30s remain
+    pr, pw = io.Pipe()
+    clock = newFakeClock()
+    resumed := ResumeExamination(checkpoint, bufio.NewScanner(pr))
+    resumed.Clock = clock
+    resumed.EnableCheckpoints(store, "amy", checkpoint.Bank)
+
+    finished = make(chan struct{})
+    go func() {
+        resumed.BeginExam(context.Background())
+        close(finished)
+    }()
+    writeLine(t, pw, "")
+    clock.waitForCalls(t, 2)
+    clock.Advance(30 * time.Second)
+
+    select {
+    case <-finished:
+    case <-time.After(2 * time.Second):
+        t.Fatal("resumed exam did not end when the remaining time ran out")
+    }
+    pw.Close()
+
+    if resumed.EndReason != END_TIME_UP {
+        t.Errorf("EndReason = %q; want %q", resumed.EndReason, END_TIME_UP)
+    }
+    if resumed.TotalScore != 1 || len(resumed.Answers) != 3 {
+        t.Errorf("score %v over %d answers; want 1 over 3", resumed.TotalScore, len(resumed.Answers))
+    }
+    if resumed.Answers[2].Statement != "Third?" {
+        t.Errorf("resumed with %q; want the third question", resumed.Answers[2].Statement)
+    }
+    if checkpoint, _ := store.Load("amy"); checkpoint != nil {
+        t.Error("checkpoint was kept after the attempt finished")
+    }
+}
+
+func TestInterruptSavesQuestionInProgress(t *testing.T) {
+    store := NewCheckpointStore(t.TempDir())
+    bank := &QuestionBank{
+        Name:              "Interrupted",
+        QuestionTimeLimit: 120,
+        Problems:          []Problem{
+            {Statement: "First?", Choices: []string{"a", "b"}, RightAnswer: 1},
+            {Statement: "Second?", Choices: []string{"a", "b"}, RightAnswer: 2},
+            {Statement: "Third?", Choices: []string{"a", "b"}, RightAnswer: 1},
+        },
+    }
+
+    // The candidate reads the first question for 15s, then presses Ctrl+C
+    pr, pw := io.Pipe()
+    defer pw.Close()
+    clock := newFakeClock()
+    exam := NewExamination(bank, bufio.NewScanner(pr), ExamOptions{})
+    exam.Clock = clock
+    exam.ExamDuration = time.Minute
+    exam.EnableCheckpoints(store, "ben", bank.Name)
+
+    ctx, cancel := context.WithCancel(context.Background())
+    finished := make(chan struct{})
+    go func() {
+        exam.BeginExam(ctx)
+        close(finished)
+    }()
+    writeLine(t, pw, "")
+    clock.waitForCalls(t, 2)
+    clock.Advance(15 * time.Second)
+    cancel()
+
+    select {
+    case <-finished:
+    case <-time.After(2 * time.Second):
+        t.Fatal("BeginExam did not return after cancel")
+    }
+    if exam.EndReason != END_INTERRUPTED || !exam.Resumable() {
+        t.Fatalf("attempt ended with %q; want it interrupted and resumable", exam.EndReason)
+    }
+
+    checkpoint, err := store.Load("ben")
+    if err != nil || checkpoint == nil {
+        t.Fatalf("Load() = %v, %v; want the saved checkpoint", checkpoint, err)
+    }
+    if len(checkpoint.Answers) != 1 || checkpoint.Elapsed != 15*time.Second {
+        t.Fatalf("checkpoint has %d answers and %v used; want 1 and 15s", len(checkpoint.Answers), checkpoint.Elapsed)
+    }
+    if answer := checkpoint.Answers[0]; answer.Statement != "First?" || answer.Outcome != OUTCOME_UNANSWERED || answer.Seconds != 15 {
+        t.Fatalf("saved answer %+v; want the first question unanswered after 15s", answer)
+    }
+
+    // Resuming moves on to the second question with 45s of exam time left
+    pr, pw = io.Pipe()
+    defer pw.Close()
+    clock = newFakeClock()
+    resumed := ResumeExamination(checkpoint, bufio.NewScanner(pr))
+    resumed.Clock = clock
+    resumed.EnableCheckpoints(store, "ben", checkpoint.Bank)
+
+    finished = make(chan struct{})
+    go func() {
+        resumed.BeginExam(context.Background())
+        close(finished)
+    }()
+    writeLine(t, pw, "")
+    clock.waitForCalls(t, 2)
+    if want := clock.Now().Add(45 * time.Second); !resumed.examDeadline.Equal(want) {
+        t.Errorf("exam deadline %v; want %v", resumed.examDeadline, want)
+    }
+    writeLine(t, pw, "2")
+    clock.waitForCalls(t, 3)
+    writeLine(t, pw, "1")
+
+    select {
+    case <-finished:
+    case <-time.After(2 * time.Second):
+        t.Fatal("resumed exam did not finish")
+    }
+    if resumed.EndReason != END_COMPLETED || resumed.TotalScore != 2 {
+        t.Errorf("ended %q with score %v; want %q with 2", resumed.EndReason, resumed.TotalScore, END_COMPLETED)
+    }
+    if statement := resumed.Answers[1].Statement; statement != "Second?" {
+        t.Errorf("resumed with %q; want the second question", statement)
+    }
+}
@@ -1,3 +1,5 @@
 module main.go
 
 go 1.23.3
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,100 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "io"
+    "sync"
+    "sync/atomic"
+)
+
+// answerLine is one line of participant input, numbered in the order it
+// was scanned
+type answerLine struct {
+    text string
+    seq  uint64
+}
+
+// AnswerReader owns the input scanner and hands lines to the exam through a
+// single goroutine, so a question that times out never leaves a reader
+// behind to steal the next question's answer
+type AnswerReader struct {
+    lines     chan answerLine
+    done      chan struct{}
+    closeOnce sync.Once
+    err       error
+    scanned   atomic.Uint64
+    expired   bool
+}
+
+// NewAnswerReader starts the reader goroutine for a scanner. The goroutine
+// exits when the input ends, or after Close once its pending Scan returns.
+func NewAnswerReader(scanner *bufio.Scanner) *AnswerReader {
+    r := &AnswerReader{
+        lines: make(chan answerLine),
+        done:  make(chan struct{}),
+    }
+    go r.run(scanner)
+    return r
+}
+
+// run forwards scanned lines until the input ends or the reader is closed
+func (r *AnswerReader) run(scanner *bufio.Scanner) {
+    defer close(r.lines)
+    for scanner.Scan() {
+        line := answerLine{text: scanner.Text(), seq: r.scanned.Add(1)}
+        select {
+        case r.lines <- line:
+        case <-r.done:
+            return
+        }
+    }
+    r.err = scanner.Err()
+}
+
+// Position returns how many lines have been scanned so far. Taken when a
+// question is shown, it marks which lines came before the question.
+func (r *AnswerReader) Position() uint64 {
+    return r.scanned.Load()
+}
+
+// ReadLine waits for the next line of input for a question shown at
+// position since. Once an earlier ReadLine has given up, lines scanned
+// before since were meant for a question that already ended, including a
+// line that arrived right at its deadline, so they are discarded. It
+// returns the context's error on timeout or cancellation and io.EOF once
+// the input is closed.
+func (r *AnswerReader) ReadLine(ctx context.Context, since uint64) (string, error) {
+    // A context that has already ended takes no input, even if a line is
+    // waiting
+    if err := ctx.Err(); err != nil {
+        r.expired = true
+        return "", err
+    }
+
+    for {
+        select {
+        case <-ctx.Done():
+            r.expired = true
+            return "", ctx.Err()
+        case line, ok := <-r.lines:
+            if !ok {
+                if r.err != nil {
+                    return "", r.err
+                }
+                return "", io.EOF
+            }
+            if r.expired && line.seq <= since {
+                continue
+            }
+            return line.text, nil
+        }
+    }
+}
+
+// Close stops forwarding input. It is safe to call more than once.
+func (r *AnswerReader) Close() {
+    r.closeOnce.Do(func() {
+        close(r.done)
+    })
+}
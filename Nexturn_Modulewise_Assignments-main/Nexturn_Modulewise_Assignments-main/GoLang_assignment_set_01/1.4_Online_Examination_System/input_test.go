@@ -0,0 +1,265 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "errors"
+    "io"
+    "runtime"
+    "testing"
+    "time"
+)
+
+// waitForGoroutines fails the test if the goroutine count does not drop
+// back to the baseline shortly after the code under test finishes
+func waitForGoroutines(t *testing.T, baseline int) {
+    t.Helper()
+    deadline := time.Now().Add(2 * time.Second)
+    for runtime.NumGoroutine() > baseline {
+        if time.Now().After(deadline) {
+            buf := make([]byte, 1<<16)
+            n := runtime.Stack(buf, true)
+            t.Fatalf("goroutines leaked: have %d, want %d\n%s", runtime.NumGoroutine(), baseline, buf[:n])
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+}
+
+// writeLine sends one line of input through the pipe
+func writeLine(t *testing.T, w *io.PipeWriter, line string) {
+    t.Helper()
+    if _, err := io.WriteString(w, line+"\n"); err != nil {
+        t.Fatalf("write %q: %v", line, err)
+    }
+}
+
+// waitForPosition blocks until the reader has scanned n lines
+func waitForPosition(t *testing.T, reader *AnswerReader, n uint64) {
+    t.Helper()
+    deadline := time.Now().Add(2 * time.Second)
+    for reader.Position() < n {
+        if time.Now().After(deadline) {
+            t.Fatalf("reader has scanned %d lines, want %d", reader.Position(), n)
+        }
+        time.Sleep(time.Millisecond)
+    }
+}
+
+// expireRead waits for a line for a question shown at since until the
+// question's time runs out on a fake clock, and returns the read's error
+func expireRead(t *testing.T, reader *AnswerReader, since uint64) error {
+    t.Helper()
+    clock := newFakeClock()
+    ctx, cancel := withDeadline(context.Background(), clock, clock.Now().Add(time.Second), errQuestionTimeUp)
+    defer cancel()
+
+    result := make(chan error, 1)
+    go func() {
+        _, err := reader.ReadLine(ctx, since)
+        result <- err
+    }()
+    clock.waitForCalls(t, 1)
+    clock.Advance(time.Second)
+
+    err := <-result
+    if cause := context.Cause(ctx); !errors.Is(cause, errQuestionTimeUp) {
+        t.Fatalf("read ended with %v; want the question's time to run out", cause)
+    }
+    return err
+}
+
+func TestReadLineReturnsLinesInOrder(t *testing.T) {
+    baseline := runtime.NumGoroutine()
+    pr, pw := io.Pipe()
+    reader := NewAnswerReader(bufio.NewScanner(pr))
+
+    go func() {
+        io.WriteString(pw, "1\n2\n")
+        pw.Close()
+    }()
+
+    for _, want := range []string{"1", "2"} {
+        got, err := reader.ReadLine(context.Background(), 0)
+        if err != nil || got != want {
+            t.Fatalf("ReadLine() = %q, %v; want %q", got, err, want)
+        }
+    }
+    if _, err := reader.ReadLine(context.Background(), 0); err != io.EOF {
+        t.Fatalf("ReadLine() after close = %v; want io.EOF", err)
+    }
+
+    reader.Close()
+    waitForGoroutines(t, baseline)
+}
+
+func TestReadLineTimeoutKeepsNextAnswer(t *testing.T) {
+    baseline := runtime.NumGoroutine()
+    pr, pw := io.Pipe()
+    reader := NewAnswerReader(bufio.NewScanner(pr))
+
+    if err := expireRead(t, reader, reader.Position()); !errors.Is(err, context.Canceled) {
+        t.Fatalf("ReadLine() = %v; want the timed-out read to give up", err)
+    }
+
+    // The timed-out call must not have left anything behind that would
+    // swallow the answer to the next question
+    shownAt := reader.Position()
+    go io.WriteString(pw, "4\n")
+    got, err := reader.ReadLine(context.Background(), shownAt)
+    if err != nil || got != "4" {
+        t.Fatalf("ReadLine() = %q, %v; want \"4\"", got, err)
+    }
+
+    pw.Close()
+    reader.Close()
+    waitForGoroutines(t, baseline)
+}
+
+func TestReadLineDiscardsLateAnswers(t *testing.T) {
+    pr, pw := io.Pipe()
+    reader := NewAnswerReader(bufio.NewScanner(pr))
+    defer pw.Close()
+    defer reader.Close()
+
+    expireRead(t, reader, reader.Position())
+
+    // An answer typed after the first question timed out, before the
+    // second question was shown
+    writeLine(t, pw, "1")
+    waitForPosition(t, reader, 1)
+
+    shownAt := reader.Position()
+    go io.WriteString(pw, "3\n")
+    got, err := reader.ReadLine(context.Background(), shownAt)
+    if err != nil || got != "3" {
+        t.Fatalf("ReadLine() = %q, %v; want the answer given after the question was shown", got, err)
+    }
+}
+
+func TestReadLineDropsAnswerAtDeadline(t *testing.T) {
+    pr, pw := io.Pipe()
+    reader := NewAnswerReader(bufio.NewScanner(pr))
+    defer pw.Close()
+    defer reader.Close()
+
+    // The answer is scanned just as the question's time runs out, so it
+    // is waiting when the expired read gives up
+    firstShownAt := reader.Position()
+    writeLine(t, pw, "1")
+    waitForPosition(t, reader, firstShownAt+1)
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    if _, err := reader.ReadLine(ctx, firstShownAt); !errors.Is(err, context.Canceled) {
+        t.Fatalf("ReadLine() = %v; want the expired read to give up", err)
+    }
+
+    shownAt := reader.Position()
+    go io.WriteString(pw, "3\n")
+    got, err := reader.ReadLine(context.Background(), shownAt)
+    if err != nil || got != "3" {
+        t.Fatalf("ReadLine() = %q, %v; want the answer given after the next question was shown", got, err)
+    }
+}
+
+func TestReadLineKeepsTypedAheadAnswers(t *testing.T) {
+    pr, pw := io.Pipe()
+    reader := NewAnswerReader(bufio.NewScanner(pr))
+    defer reader.Close()
+
+    // Piped input arrives before the questions are shown; without a
+    // timeout in between none of it is stale
+    go func() {
+        io.WriteString(pw, "\n2\n")
+        pw.Close()
+    }()
+    if _, err := reader.ReadLine(context.Background(), 0); err != nil {
+        t.Fatalf("ReadLine() = %v", err)
+    }
+    waitForPosition(t, reader, 2)
+
+    got, err := reader.ReadLine(context.Background(), reader.Position())
+    if err != nil || got != "2" {
+        t.Fatalf("ReadLine() = %q, %v; want \"2\"", got, err)
+    }
+}
+
+func TestCloseStopsReaderWithPendingLine(t *testing.T) {
+    baseline := runtime.NumGoroutine()
+    pr, pw := io.Pipe()
+    reader := NewAnswerReader(bufio.NewScanner(pr))
+
+    // Nobody reads this line, so the reader goroutine is blocked handing it over
+    writeLine(t, pw, "2")
+    reader.Close()
+    reader.Close()
+
+    pw.Close()
+    waitForGoroutines(t, baseline)
+}
+
+func TestBeginExamTimeoutDoesNotLeak(t *testing.T) {
+    baseline := runtime.NumGoroutine()
+    pr, pw := io.Pipe()
+    bank := &QuestionBank{
+        Name: "Test",
+        Problems: []Problem{
+            {Statement: "First?", Choices: []string{"a", "b"}, RightAnswer: 1},
+            {Statement: "Second?", Choices: []string{"a", "b"}, RightAnswer: 2},
+            {Statement: "Third?", Choices: []string{"a", "b"}, RightAnswer: 1},
+        },
+    }
+    clock := newFakeClock()
+    exam := NewExamination(bank, bufio.NewScanner(pr), ExamOptions{})
+    exam.Clock = clock
+    exam.QuestionTimeLimit = 10 * time.Second
+
+    finished := make(chan struct{})
+    go func() {
+        exam.BeginExam(context.Background())
+        close(finished)
+    }()
+
+    // Start, let the first question time out, then answer the second
+    writeLine(t, pw, "")
+    clock.waitForCalls(t, 1)
+    clock.Advance(10 * time.Second)
+    clock.waitForCalls(t, 2)
+    writeLine(t, pw, "2")
+    pw.Close()
+
+    select {
+    case <-finished:
+    case <-time.After(2 * time.Second):
+        t.Fatal("BeginExam did not return")
+    }
+    if exam.TotalScore != 1 {
+        t.Errorf("TotalScore = %v; want 1", exam.TotalScore)
+    }
+    waitForGoroutines(t, baseline)
+}
+
+func TestBeginExamCancelDoesNotLeak(t *testing.T) {
+    baseline := runtime.NumGoroutine()
+    pr, pw := io.Pipe()
+    exam := NewExamination(defaultQuestionBank(), bufio.NewScanner(pr), ExamOptions{})
+
+    ctx, cancel := context.WithCancel(context.Background())
+    finished := make(chan struct{})
+    go func() {
+        exam.BeginExam(ctx)
+        close(finished)
+    }()
+
+    writeLine(t, pw, "")
+    cancel()
+
+    select {
+    case <-finished:
+    case <-time.After(2 * time.Second):
+        t.Fatal("BeginExam did not return after cancel")
+    }
+
+    // The reader goroutine can only leave once its blocked Scan returns
+    pw.Close()
+    waitForGoroutines(t, baseline)
+}
@@ -2,10 +2,15 @@ package main
 
 import (
     "bufio"
+    "context"
+    "errors"
+    "flag"
     "fmt"
+    "net/http"
     "os"
-    "strconv"
+    "os/signal"
     "strings"
+    "syscall"
     "time"
 )
 
@@ -16,7 +21,13 @@ const (
     PASS_MARKS_PERCENT  = 60.0
 )
 
-// Performance levels
+// Input errors
+var (
+    errInvalidNumber = errors.New("please enter a valid number")
+    errQuit          = errors.New("quiz terminated by the participant")
+)
+
+// Default performance levels, used by banks that set no grade bands
 const (
     OUTSTANDING = 90.0
     VERY_GOOD   = 75.0
@@ -25,197 +36,248 @@ const (
 
 // Problem represents a single quiz problem
 type Problem struct {
-    Statement      string
-    Choices        []string
-    RightAnswer    int
+    Type            string   `json:"type,omitempty" yaml:"type,omitempty"`
+    Topic           string   `json:"topic,omitempty" yaml:"topic,omitempty"`
+    Statement       string   `json:"statement" yaml:"statement"`
+    Choices         []string `json:"choices,omitempty" yaml:"choices,omitempty"`
+    RightAnswer     int      `json:"right_answer,omitempty" yaml:"right_answer,omitempty"`
+    RightAnswers    []int    `json:"right_answers,omitempty" yaml:"right_answers,omitempty"`
+    Correct         *bool    `json:"correct,omitempty" yaml:"correct,omitempty"`
+    NumericAnswer   *float64 `json:"numeric_answer,omitempty" yaml:"numeric_answer,omitempty"`
+    Tolerance       float64  `json:"tolerance,omitempty" yaml:"tolerance,omitempty"`
+    AcceptedAnswers []string `json:"accepted_answers,omitempty" yaml:"accepted_answers,omitempty"`
+    TimeLimit       int      `json:"time_limit,omitempty" yaml:"time_limit,omitempty"`
+    Difficulty      float64  `json:"difficulty,omitempty" yaml:"difficulty,omitempty"`
+    Marks           float64  `json:"marks,omitempty" yaml:"marks,omitempty"`
 }
 
 // Examination handles the quiz operations
 type Examination struct {
-    Problems        []Problem
-    TotalScore      int
-    QuestionCount   int
-    InputReader     *bufio.Scanner
+    Problems          []Problem
+    TotalScore        float64
+    CorrectCount      int
+    QuestionCount     int
+    InputReader       *bufio.Scanner
+    QuestionTimeLimit time.Duration
+    ExamDuration      time.Duration
+    Clock             Clock
+    ShowCountdown     bool
+    Options           ExamOptions
+    Scoring           ScoringRules
+    Adaptive          *AdaptiveTest
+    Answers           []AnswerRecord
+    StartedAt         time.Time
+    FinishedAt        time.Time
+    EndReason         string
+    answers           *AnswerReader
+    examDeadline      time.Time
+    elapsed           time.Duration
+    sittingStartedAt  time.Time
+    checkpoints       *CheckpointStore
+    candidateID       string
+    bankName          string
 }
 
-// NewExamination initializes a new exam session
-func NewExamination() *Examination {
-    questions := []Problem{
-        {
-            Statement: "Which city is the capital of France?",
-            Choices: []string{
-                "Berlin",
-                "Madrid",
-                "Paris",
-                "Rome",
-            },
-            RightAnswer: 3,
-        },
-        {
-            Statement: "What is the chemical symbol for water?",
-            Choices: []string{
-                "CO2",
-                "H2O",
-                "NaCl",
-                "O2",
-            },
-            RightAnswer: 2,
-        },
-        {
-            Statement: "Solve: 5 × 3 - 4",
-            Choices: []string{
-                "15",
-                "11",
-                "13",
-                "9",
-            },
-            RightAnswer: 2,
-        },
-        {
-            Statement: "Who is the author of 'Pride and Prejudice'?",
-            Choices: []string{
-                "Jane Austen",
-                "Charles Dickens",
-                "George Eliot",
-                "Charlotte Brontë",
-            },
-            RightAnswer: 1,
-        },
-        {
-            Statement: "Which continent is the Sahara Desert located in?",
-            Choices: []string{
-                "Asia",
-                "Africa",
-                "Australia",
-                "South America",
-            },
-            RightAnswer: 2,
-        },
-    }
-
-    return &Examination{
-        Problems:      questions,
-        QuestionCount: len(questions),
-        InputReader:   bufio.NewScanner(os.Stdin),
+// NewExamination initializes a new exam session from a question bank,
+// drawing and shuffling its questions as the options ask
+func NewExamination(bank *QuestionBank, input *bufio.Scanner, options ExamOptions) *Examination {
+    problems := prepareProblems(bank.Problems, options)
+    exam := &Examination{
+        Problems:          problems,
+        QuestionCount:     len(problems),
+        InputReader:       input,
+        QuestionTimeLimit: QUESTION_TIME_LIMIT,
+        ExamDuration:      time.Duration(bank.Duration) * time.Second,
+        Clock:             realClock{},
+        Options:           options,
+        Scoring:           bank.scoringRules(),
+    }
+    if bank.QuestionTimeLimit > 0 {
+        exam.QuestionTimeLimit = time.Duration(bank.QuestionTimeLimit) * time.Second
+    }
+    if options.Adaptive {
+        exam.Adaptive = NewAdaptiveTest(problems, options.TargetSE, options.MaxQuestions)
+        exam.QuestionCount = exam.Adaptive.MaxQuestions
     }
+    return exam
 }
 
-// showQuestion displays a problem and its choices
-func (e *Examination) showQuestion(index int, problem Problem) {
-    fmt.Printf("\nQuestion %d/%d:\n", index+1, e.QuestionCount)
+// showQuestion displays a problem and, for choice questions, its choices,
+// followed by the remaining time when the countdown is shown
+func (e *Examination) showQuestion(index int, problem Problem, deadline time.Time) {
+    if e.Adaptive != nil {
+        fmt.Printf("\nQuestion %d (up to %d):\n", index+1, e.QuestionCount)
+    } else {
+        fmt.Printf("\nQuestion %d/%d:\n", index+1, e.QuestionCount)
+    }
     fmt.Println(problem.Statement)
-    for i, choice := range problem.Choices {
-        fmt.Printf("%d. %s\n", i+1, choice)
+    switch problem.kind() {
+    case MULTI_SELECT:
+        fmt.Println("(Select all that apply)")
+    case TRUE_FALSE:
+        fmt.Println("True or False?")
+    }
+    if problem.hasChoices() {
+        for i, choice := range problem.Choices {
+            fmt.Printf("%d. %s\n", i+1, choice)
+        }
     }
-    fmt.Printf("\nEnter your answer (1-%d) or '%s' to exit: ", len(problem.Choices), QUIT_COMMAND)
+    switch {
+    case e.ShowCountdown:
+        fmt.Printf("%s\n", e.remainingText(deadline))
+    case problem.TimeLimit > 0:
+        fmt.Printf("(You have %v for this question)\n", e.timeLimit(problem))
+    default:
+        fmt.Println()
+    }
+    fmt.Print(problem.answerPrompt())
 }
 
-// getInput reads and validates user responses
-func (e *Examination) getInput() (int, error) {
-    e.InputReader.Scan()
-    response := strings.TrimSpace(e.InputReader.Text())
-
-    if strings.ToLower(response) == QUIT_COMMAND {
-        return -1, nil
+// getInput reads a response entered after the question was shown
+func (e *Examination) getInput(ctx context.Context, shownAt uint64) (string, error) {
+    line, err := e.answers.ReadLine(ctx, shownAt)
+    if err != nil {
+        return "", err
     }
+    response := strings.TrimSpace(line)
 
-    choice, err := strconv.Atoi(response)
-    if err != nil {
-        return 0, fmt.Errorf("please enter a valid number")
+    if strings.ToLower(response) == QUIT_COMMAND {
+        return "", errQuit
     }
 
-    return choice, nil
+    return response, nil
 }
 
-// determinePerformance evaluates the performance category based on score percentage
-func determinePerformance(percentage float64) string {
-    switch {
-    case percentage >= OUTSTANDING:
-        return "Outstanding"
-    case percentage >= VERY_GOOD:
-        return "Very Good"
-    case percentage >= ACCEPTABLE:
-        return "Acceptable"
-    default:
-        return "Needs Improvement"
+// awaitAnswer keeps asking until the response can be graded or the context ends
+func (e *Examination) awaitAnswer(ctx context.Context, shownAt uint64, problem Problem) (Grade, error) {
+    for {
+        response, err := e.getInput(ctx, shownAt)
+        if err != nil {
+            return Grade{}, err
+        }
+        grade, err := problem.Grade(response)
+        if err != nil {
+            fmt.Printf("Error: %v\n", err)
+            continue
+        }
+        grade.Response = response
+        return grade, nil
     }
 }
 
-// BeginExam starts the quiz
-func (e *Examination) BeginExam() {
+// BeginExam starts the quiz. Cancelling ctx ends the quiz early and shows
+// the results so far.
+func (e *Examination) BeginExam(ctx context.Context) {
+    e.answers = NewAnswerReader(e.InputReader)
+    defer e.answers.Close()
+
+    resumeAt := len(e.Answers)
     fmt.Println("\nWelcome to the Interactive Quiz Platform!")
-    fmt.Printf("You have %v for each question. Total questions: %d\n", QUESTION_TIME_LIMIT, e.QuestionCount)
+    fmt.Printf("You have %v for each question. Total questions: %d\n", e.QuestionTimeLimit, e.QuestionCount)
+    if e.ExamDuration > 0 {
+        fmt.Printf("The whole exam must be finished within %v.\n", e.ExamDuration)
+    }
+    if resumeAt > 0 {
+        fmt.Printf("Resuming your attempt at question %d with %v of exam time used.\n", resumeAt+1, e.elapsed.Round(time.Second))
+    }
     fmt.Println("Press Enter to begin...")
-    e.InputReader.Scan()
+    e.answers.ReadLine(ctx, 0)
+
+    // The overall timer starts once the participant is ready and only runs
+    // while they are sitting the exam
+    e.sittingStartedAt = e.Clock.Now()
+    if e.StartedAt.IsZero() {
+        e.StartedAt = e.sittingStartedAt
+    }
+    examCtx := ctx
+    if e.ExamDuration > 0 {
+        e.examDeadline = e.sittingStartedAt.Add(e.ExamDuration - e.elapsed)
+        var cancelExam context.CancelFunc
+        examCtx, cancelExam = withDeadline(ctx, e.Clock, e.examDeadline, errExamTimeUp)
+        defer cancelExam()
+    }
+    e.saveCheckpoint()
 
-    for i, problem := range e.Problems {
-        // Create timer for the question
-        questionTimer := time.NewTimer(QUESTION_TIME_LIMIT)
-        answerChannel := make(chan int)
-        timeoutChannel := make(chan bool)
+    for i := resumeAt; ; i++ {
+        problem, ok := e.nextProblem(i)
+        if !ok {
+            break
+        }
 
         // Display the question
-        e.showQuestion(i, problem)
-
-        // Goroutine to handle user response
-        go func() {
-            for {
-                answer, err := e.getInput()
-                if err != nil {
-                    fmt.Printf("Error: %v\n", err)
-                    continue
-                }
-                answerChannel <- answer
-                break
-            }
-        }()
-
-        // Goroutine to handle timeout
-        go func() {
-            <-questionTimer.C
-            timeoutChannel <- true
-        }()
+        questionDeadline := e.Clock.Now().Add(e.timeLimit(problem))
+        e.showQuestion(i, problem, questionDeadline)
+        shownAt := e.answers.Position()
+        clockShownAt := e.Clock.Now()
 
         // Await user input or timeout
-        select {
-        case response := <-answerChannel:
-            questionTimer.Stop()
-            if response == -1 {
-                fmt.Println("\nQuiz terminated by the participant.")
-                e.showResults()
-                return
-            }
-            if response < 1 || response > len(problem.Choices) {
-                fmt.Println("Invalid selection. No points scored.")
-                continue
-            }
-            if response == problem.RightAnswer {
-                fmt.Println("Correct!")
-                e.TotalScore++
-            } else {
-                fmt.Printf("Incorrect. The correct answer was: %d\n", problem.RightAnswer)
-            }
-
-        case <-timeoutChannel:
+        questionCtx, cancel := withDeadline(examCtx, e.Clock, questionDeadline, errQuestionTimeUp)
+        stopCountdown := func() {}
+        if e.ShowCountdown {
+            stopCountdown = e.startCountdown(questionCtx, questionDeadline)
+        }
+        grade, err := e.awaitAnswer(questionCtx, shownAt, problem)
+        cause := context.Cause(questionCtx)
+        stopCountdown()
+        cancel()
+
+        switch {
+        case ctx.Err() != nil:
+            e.recordAnswer(i, problem, Grade{}, OUTCOME_UNANSWERED, clockShownAt, e.Clock.Now())
+            fmt.Println("\nQuiz interrupted.")
+            e.finish(END_INTERRUPTED)
+            return
+        case err == nil:
+        case errors.Is(cause, errExamTimeUp):
+            e.recordAnswer(i, problem, Grade{}, OUTCOME_UNANSWERED, clockShownAt, e.Clock.Now())
+            fmt.Println("\nTime's up! The exam is over.")
+            e.finish(END_TIME_UP)
+            return
+        case errors.Is(cause, errQuestionTimeUp):
+            e.recordAnswer(i, problem, Grade{}, OUTCOME_TIMED_OUT, clockShownAt, e.Clock.Now())
+            e.saveCheckpoint()
             fmt.Println("\nTime's up! Proceeding to the next question...")
+            continue
+        case errors.Is(err, errQuit):
+            e.recordAnswer(i, problem, Grade{}, OUTCOME_UNANSWERED, clockShownAt, e.Clock.Now())
+            fmt.Println("\nQuiz terminated by the participant.")
+            e.finish(END_QUIT)
+            return
+        default:
+            e.recordAnswer(i, problem, Grade{}, OUTCOME_UNANSWERED, clockShownAt, e.Clock.Now())
+            fmt.Println("\nInput closed. Quiz terminated.")
+            e.finish(END_INPUT_CLOSED)
+            return
         }
+
+        grade = e.applyGrade(problem, grade)
+        e.recordAnswer(i, problem, grade, OUTCOME_ANSWERED, clockShownAt, e.Clock.Now())
+        e.saveCheckpoint()
+        fmt.Println(grade.Feedback)
     }
 
-    e.showResults()
+    e.finish(END_COMPLETED)
 }
 
 // showResults displays the overall quiz performance
 func (e *Examination) showResults() {
-    percentage := (float64(e.TotalScore) / float64(e.QuestionCount)) * 100
-    performance := determinePerformance(percentage)
+    percentage := e.percentage()
+    performance := e.Scoring.performance(percentage)
 
     fmt.Println("\n--- Final Results ---")
     fmt.Printf("Total Questions: %d\n", e.QuestionCount)
-    fmt.Printf("Correct Answers: %d\n", e.TotalScore)
+    fmt.Printf("Correct Answers: %d\n", e.CorrectCount)
+    fmt.Printf("Score: %.2f/%.2f\n", e.TotalScore, e.maxScore())
     fmt.Printf("Score Percentage: %.2f%%\n", percentage)
     fmt.Printf("Performance: %s\n", performance)
+    if e.Adaptive != nil {
+        fmt.Printf("Ability Estimate: %v\n", e.Adaptive.Estimate())
+    }
+    if e.Options.randomized() {
+        fmt.Printf("Seed: %d (use %s with the same bank to repeat this exam)\n", e.Options.Seed, e.Options.repeatFlags())
+    }
 
-    if percentage >= PASS_MARKS_PERCENT {
+    if e.Scoring.passed(percentage) {
         fmt.Println("Congratulations! You passed the quiz!")
     } else {
         fmt.Println("Keep practicing and try again. You'll improve!")
@@ -223,6 +285,144 @@ func (e *Examination) showResults() {
 }
 
 func main() {
-    exam := NewExamination()
-    exam.BeginExam()
+    bankFile := flag.String("bank", "", "question bank file (JSON or YAML) to use")
+    bankDir := flag.String("banks", DEFAULT_BANK_DIR, "directory of question banks to choose from")
+    seed := flag.Int64("seed", 0, "seed for question selection and shuffling (0 picks a new one)")
+    perTopic := flag.Int("per-topic", 0, "number of questions drawn at random from each topic (0 uses all)")
+    shuffleQuestions := flag.Bool("shuffle", true, "shuffle the order of the questions")
+    shuffleChoices := flag.Bool("shuffle-choices", true, "shuffle the order of each question's choices")
+    duration := flag.Duration("duration", 0, "time allowed for the whole exam, e.g. 10m (overrides the bank)")
+    countdown := flag.Bool("countdown", true, "show the remaining time while answering (terminals only)")
+    candidateID := flag.String("candidate", "", "candidate ID the attempt is recorded under")
+    resultsFile := flag.String("results", DEFAULT_RESULTS_FILE, "JSON-lines file attempts are recorded in")
+    attemptsOf := flag.String("attempts", "", "list the recorded attempts of a candidate and exit")
+    leaderboard := flag.String("leaderboard", "", "show the leaderboard for a question bank and exit")
+    top := flag.Int("top", 10, "number of candidates shown on the leaderboard")
+    analyze := flag.String("analyze", "", "show item analysis statistics for a question bank and exit")
+    adaptive := flag.Bool("adaptive", false, "choose each question to match the candidate's estimated ability")
+    targetSE := flag.Float64("target-se", DEFAULT_TARGET_SE, "adaptive mode stops once the ability estimate's standard error is this small")
+    maxQuestions := flag.Int("max-questions", 0, "most questions asked in adaptive mode (0 allows the whole bank)")
+    checkpointDir := flag.String("checkpoints", DEFAULT_CHECKPOINT_DIR, "directory unfinished attempts are saved in so they can be resumed (empty disables)")
+    serveAddr := flag.String("serve", "", "serve exams over HTTP on this address (e.g. :8080) instead of the terminal")
+    flag.Parse()
+
+    store := NewResultStore(*resultsFile)
+    if *attemptsOf != "" {
+        attempts, err := store.AttemptsFor(*attemptsOf)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+            os.Exit(1)
+        }
+        WriteAttempts(os.Stdout, *attemptsOf, attempts)
+        return
+    }
+    if *leaderboard != "" {
+        entries, err := store.Leaderboard(*leaderboard, *top)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+            os.Exit(1)
+        }
+        WriteLeaderboard(os.Stdout, *leaderboard, entries)
+        return
+    }
+    if *analyze != "" {
+        if err := analyzeBank(store, *analyze, *bankFile, *bankDir); err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+            os.Exit(1)
+        }
+        return
+    }
+
+    options := ExamOptions{
+        Seed:             *seed,
+        PerTopic:         *perTopic,
+        ShuffleQuestions: *shuffleQuestions,
+        ShuffleChoices:   *shuffleChoices,
+        Adaptive:         *adaptive,
+        TargetSE:         *targetSE,
+        MaxQuestions:     *maxQuestions,
+    }
+    if options.PerTopic < 0 {
+        fmt.Fprintln(os.Stderr, "Error: -per-topic cannot be negative")
+        os.Exit(1)
+    }
+    if options.Seed == 0 {
+        options.Seed = NewSeed()
+    }
+
+    if *serveAddr != "" {
+        banks, err := loadQuestionBanks(*bankFile, *bankDir)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+            os.Exit(1)
+        }
+        server := NewExamServer(banks, store, options, *duration)
+        go server.SweepSessions(context.Background())
+        fmt.Printf("Serving %d question bank(s) on %s\n", len(banks), *serveAddr)
+        if err := http.ListenAndServe(*serveAddr, server.Handler()); err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+            os.Exit(1)
+        }
+        return
+    }
+
+    input := bufio.NewScanner(os.Stdin)
+    candidate := strings.TrimSpace(*candidateID)
+    for candidate == "" {
+        fmt.Print("Enter your candidate ID: ")
+        if !input.Scan() {
+            fmt.Fprintln(os.Stderr, "Error: a candidate ID is required")
+            os.Exit(1)
+        }
+        candidate = strings.TrimSpace(input.Text())
+    }
+
+    var checkpoints *CheckpointStore
+    var exam *Examination
+    bankName := ""
+    if *checkpointDir != "" {
+        checkpoints = NewCheckpointStore(*checkpointDir)
+        resumed, err := offerResume(checkpoints, store, candidate, input)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+            os.Exit(1)
+        }
+        if resumed != nil {
+            exam, bankName = resumed, resumed.bankName
+        }
+    }
+
+    if exam == nil {
+        bank, err := selectQuestionBank(*bankFile, *bankDir, input)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+            os.Exit(1)
+        }
+        fmt.Printf("\nQuestion bank: %s (%d questions)\n", bank.Name, len(bank.Problems))
+        exam = NewExamination(bank, input, options)
+        if *duration > 0 {
+            exam.ExamDuration = *duration
+        }
+        bankName = bank.Name
+    }
+    if checkpoints != nil {
+        exam.EnableCheckpoints(checkpoints, candidate, bankName)
+    }
+
+    // Closing the terminal interrupts the exam like Ctrl+C, keeping the
+    // saved progress
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGHUP)
+    defer stop()
+
+    exam.ShowCountdown = *countdown && isTerminal(os.Stdout)
+    exam.BeginExam(ctx)
+    if exam.Resumable() {
+        return
+    }
+
+    if err := store.Append(exam.Record(candidate, bankName)); err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        os.Exit(1)
+    }
+    fmt.Printf("Attempt recorded for %s.\n", candidate)
 }
@@ -0,0 +1,430 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+)
+
+// Question bank settings
+const (
+    DEFAULT_BANK_DIR = "question_banks"
+    MIN_CHOICES      = 2
+)
+
+// QuestionBank is a named set of problems loaded from a file. Time limits
+// are in seconds; zero keeps the default.
+type QuestionBank struct {
+    Name              string        `json:"name" yaml:"name"`
+    Description       string        `json:"description,omitempty" yaml:"description,omitempty"`
+    QuestionTimeLimit int           `json:"question_time_limit,omitempty" yaml:"question_time_limit,omitempty"`
+    Duration          int           `json:"duration,omitempty" yaml:"duration,omitempty"`
+    Scoring           *ScoringRules `json:"scoring,omitempty" yaml:"scoring,omitempty"`
+    Problems          []Problem     `json:"questions" yaml:"questions"`
+    Source            string        `json:"-" yaml:"-"`
+}
+
+// QuestionError describes what is wrong with one question of a bank
+type QuestionError struct {
+    Index     int
+    Line      int
+    Statement string
+    Message   string
+}
+
+// Error describes the problem and where the question is
+func (e QuestionError) Error() string {
+    location := fmt.Sprintf("question %d", e.Index+1)
+    if e.Line > 0 {
+        location += fmt.Sprintf(" (line %d)", e.Line)
+    }
+    if e.Statement != "" {
+        location += fmt.Sprintf(" %q", shorten(e.Statement, 40))
+    }
+    return location + ": " + e.Message
+}
+
+// BankValidationError lists every invalid question in a bank file
+type BankValidationError struct {
+    Path     string
+    Problems []QuestionError
+}
+
+// Error reports all the invalid questions, one per line
+func (e *BankValidationError) Error() string {
+    lines := make([]string, 0, len(e.Problems)+1)
+    lines = append(lines, fmt.Sprintf("invalid question bank %s:", e.Path))
+    for _, problem := range e.Problems {
+        lines = append(lines, "  "+problem.Error())
+    }
+    return strings.Join(lines, "\n")
+}
+
+// shorten trims long text for error messages
+func shorten(text string, limit int) string {
+    runes := []rune(text)
+    if len(runes) <= limit {
+        return text
+    }
+    return string(runes[:limit-3]) + "..."
+}
+
+// isBankFile reports whether a file name has a supported bank extension
+func isBankFile(name string) bool {
+    switch strings.ToLower(filepath.Ext(name)) {
+    case ".json", ".yaml", ".yml":
+        return true
+    }
+    return false
+}
+
+// LoadQuestionBank reads and validates a JSON or YAML question bank
+func LoadQuestionBank(path string) (*QuestionBank, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read question bank: %v", err)
+    }
+
+    var bank QuestionBank
+    var lines []int
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".json":
+        decoder := json.NewDecoder(bytes.NewReader(data))
+        decoder.DisallowUnknownFields()
+        if err := decoder.Decode(&bank); err != nil {
+            return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+        }
+    case ".yaml", ".yml":
+        if lines, err = decodeYAMLBank(data, &bank); err != nil {
+            return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+        }
+    default:
+        return nil, fmt.Errorf("unsupported question bank format: %s", path)
+    }
+
+    bank.Source = path
+    if bank.Name == "" {
+        bank.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+    }
+    if err := validateBank(&bank, path, lines); err != nil {
+        return nil, err
+    }
+    return &bank, nil
+}
+
+// decodeYAMLBank decodes a YAML bank and returns the line each question
+// starts on, so validation errors can point at it
+func decodeYAMLBank(data []byte, bank *QuestionBank) ([]int, error) {
+    var root yaml.Node
+    if err := yaml.Unmarshal(data, &root); err != nil {
+        return nil, err
+    }
+
+    decoder := yaml.NewDecoder(bytes.NewReader(data))
+    decoder.KnownFields(true)
+    if err := decoder.Decode(bank); err != nil {
+        return nil, err
+    }
+
+    lines := make([]int, 0)
+    if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+        return lines, nil
+    }
+    mapping := root.Content[0].Content
+    for i := 0; i+1 < len(mapping); i += 2 {
+        if mapping[i].Value == "questions" && mapping[i+1].Kind == yaml.SequenceNode {
+            for _, item := range mapping[i+1].Content {
+                lines = append(lines, item.Line)
+            }
+        }
+    }
+    return lines, nil
+}
+
+// validateBank checks every question and collects all the problems found
+func validateBank(bank *QuestionBank, path string, lines []int) error {
+    if len(bank.Problems) == 0 {
+        return fmt.Errorf("invalid question bank %s: it has no questions", path)
+    }
+    if bank.QuestionTimeLimit < 0 || bank.Duration < 0 {
+        return fmt.Errorf("invalid question bank %s: time limits cannot be negative", path)
+    }
+    if bank.Scoring != nil {
+        if messages := bank.Scoring.validate(); len(messages) > 0 {
+            return fmt.Errorf("invalid question bank %s: scoring: %s", path, strings.Join(messages, "; "))
+        }
+    }
+
+    // Statements identify questions in the recorded attempts, so each must
+    // be unique within the bank
+    invalid := make([]QuestionError, 0)
+    statements := make(map[string]int)
+    for i, problem := range bank.Problems {
+        messages := problem.validate()
+        statement := strings.TrimSpace(problem.Statement)
+        if first, repeated := statements[statement]; repeated && statement != "" {
+            messages = append(messages, fmt.Sprintf("statement repeats question %d", first+1))
+        } else {
+            statements[statement] = i
+        }
+        for _, message := range messages {
+            questionErr := QuestionError{Index: i, Statement: problem.Statement, Message: message}
+            if i < len(lines) {
+                questionErr.Line = lines[i]
+            }
+            invalid = append(invalid, questionErr)
+        }
+    }
+
+    if len(invalid) > 0 {
+        return &BankValidationError{Path: path, Problems: invalid}
+    }
+    return nil
+}
+
+// validate returns a message for each thing wrong with a problem
+func (p Problem) validate() []string {
+    messages := make([]string, 0)
+    if strings.TrimSpace(p.Statement) == "" {
+        messages = append(messages, "statement is empty")
+    }
+
+    if p.TimeLimit < 0 {
+        messages = append(messages, "time_limit cannot be negative")
+    }
+    if p.Marks < 0 {
+        messages = append(messages, "marks cannot be negative")
+    }
+    if math.Abs(p.Difficulty) > MAX_DIFFICULTY {
+        messages = append(messages, fmt.Sprintf("difficulty %.2f is outside -%.0f to %.0f", p.Difficulty, MAX_DIFFICULTY, MAX_DIFFICULTY))
+    }
+
+    switch p.kind() {
+    case SINGLE_CHOICE:
+        messages = append(messages, p.validateChoices()...)
+        if p.RightAnswer < 1 || p.RightAnswer > len(p.Choices) {
+            messages = append(messages, fmt.Sprintf("right_answer %d is outside the choices 1-%d", p.RightAnswer, len(p.Choices)))
+        }
+    case MULTI_SELECT:
+        messages = append(messages, p.validateChoices()...)
+        if len(p.RightAnswers) == 0 {
+            messages = append(messages, "right_answers is empty")
+        }
+        seen := make(map[int]bool)
+        for _, answer := range p.RightAnswers {
+            if answer < 1 || answer > len(p.Choices) {
+                messages = append(messages, fmt.Sprintf("right_answers entry %d is outside the choices 1-%d", answer, len(p.Choices)))
+            } else if seen[answer] {
+                messages = append(messages, fmt.Sprintf("right_answers entry %d is repeated", answer))
+            }
+            seen[answer] = true
+        }
+    case TRUE_FALSE:
+        if p.Correct == nil {
+            messages = append(messages, "correct must be true or false")
+        }
+    case NUMERIC:
+        if p.NumericAnswer == nil {
+            messages = append(messages, "numeric_answer is missing")
+        }
+        if p.Tolerance < 0 {
+            messages = append(messages, "tolerance cannot be negative")
+        }
+    case SHORT_ANSWER:
+        if len(p.AcceptedAnswers) == 0 {
+            messages = append(messages, "accepted_answers is empty")
+        }
+        for i, answer := range p.AcceptedAnswers {
+            if normalizeAnswer(answer) == "" {
+                messages = append(messages, fmt.Sprintf("accepted answer %d is empty", i+1))
+            }
+        }
+    default:
+        messages = append(messages, fmt.Sprintf("unknown question type %q", p.Type))
+    }
+    return messages
+}
+
+// validateChoices checks the choices of a single choice or multi-select problem
+func (p Problem) validateChoices() []string {
+    messages := make([]string, 0)
+    if len(p.Choices) < MIN_CHOICES {
+        messages = append(messages, fmt.Sprintf("needs at least %d choices, has %d", MIN_CHOICES, len(p.Choices)))
+    }
+
+    seen := make(map[string]bool)
+    for i, choice := range p.Choices {
+        key := strings.ToLower(strings.TrimSpace(choice))
+        if key == "" {
+            messages = append(messages, fmt.Sprintf("choice %d is empty", i+1))
+            continue
+        }
+        if seen[key] {
+            messages = append(messages, fmt.Sprintf("choice %d %q is a duplicate", i+1, choice))
+        }
+        seen[key] = true
+    }
+    return messages
+}
+
+// ListQuestionBanks returns the bank files in a directory, sorted by name
+func ListQuestionBanks(dir string) ([]string, error) {
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read question bank directory: %v", err)
+    }
+
+    paths := make([]string, 0)
+    for _, entry := range entries {
+        if !entry.IsDir() && isBankFile(entry.Name()) {
+            paths = append(paths, filepath.Join(dir, entry.Name()))
+        }
+    }
+    sort.Strings(paths)
+    if len(paths) == 0 {
+        return nil, errors.New("no question banks found in " + dir)
+    }
+    return paths, nil
+}
+
+// defaultQuestionBank is used when no question bank files are available
+func defaultQuestionBank() *QuestionBank {
+    return &QuestionBank{
+        Name:        "General Knowledge",
+        Description: "Built-in sample questions",
+        Problems: []Problem{
+            {
+                Topic:     "Geography",
+                Statement: "Which city is the capital of France?",
+                Choices: []string{
+                    "Berlin",
+                    "Madrid",
+                    "Paris",
+                    "Rome",
+                },
+                RightAnswer: 3,
+            },
+            {
+                Topic:     "Science",
+                Statement: "What is the chemical symbol for water?",
+                Choices: []string{
+                    "CO2",
+                    "H2O",
+                    "NaCl",
+                    "O2",
+                },
+                RightAnswer: 2,
+            },
+            {
+                Topic:     "Mathematics",
+                Statement: "Solve: 5 × 3 - 4",
+                Choices: []string{
+                    "15",
+                    "11",
+                    "13",
+                    "9",
+                },
+                RightAnswer: 2,
+            },
+            {
+                Topic:     "Literature",
+                Statement: "Who is the author of 'Pride and Prejudice'?",
+                Choices: []string{
+                    "Jane Austen",
+                    "Charles Dickens",
+                    "George Eliot",
+                    "Charlotte Brontë",
+                },
+                RightAnswer: 1,
+            },
+            {
+                Topic:     "Geography",
+                Statement: "Which continent is the Sahara Desert located in?",
+                Choices: []string{
+                    "Asia",
+                    "Africa",
+                    "Australia",
+                    "South America",
+                },
+                RightAnswer: 2,
+            },
+        },
+    }
+}
+
+// loadQuestionBanks loads the bank named on the command line, or every valid
+// bank in the bank directory. Banks that fail validation are reported and
+// left out; without a bank directory the built-in questions are used.
+func loadQuestionBanks(bankFile, bankDir string) ([]*QuestionBank, error) {
+    if bankFile != "" {
+        bank, err := LoadQuestionBank(bankFile)
+        if err != nil {
+            return nil, err
+        }
+        return []*QuestionBank{bank}, nil
+    }
+
+    paths, err := ListQuestionBanks(bankDir)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "No question banks found, using the built-in questions.")
+        return []*QuestionBank{defaultQuestionBank()}, nil
+    }
+
+    banks := make([]*QuestionBank, 0, len(paths))
+    for _, path := range paths {
+        bank, err := LoadQuestionBank(path)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Skipping %v\n", err)
+            continue
+        }
+        banks = append(banks, bank)
+    }
+    if len(banks) == 0 {
+        return nil, fmt.Errorf("no valid question banks in %s", bankDir)
+    }
+    return banks, nil
+}
+
+// selectQuestionBank loads the bank named on the command line, or lets the
+// participant choose one from the bank directory
+func selectQuestionBank(bankFile, bankDir string, input *bufio.Scanner) (*QuestionBank, error) {
+    banks, err := loadQuestionBanks(bankFile, bankDir)
+    if err != nil {
+        return nil, err
+    }
+    if len(banks) == 1 {
+        return banks[0], nil
+    }
+
+    fmt.Println("\nAvailable question banks:")
+    for i, bank := range banks {
+        fmt.Printf("%d. %s (%d questions)", i+1, bank.Name, len(bank.Problems))
+        if bank.Description != "" {
+            fmt.Printf(" - %s", bank.Description)
+        }
+        fmt.Println()
+    }
+
+    for {
+        fmt.Printf("Choose a question bank (1-%d): ", len(banks))
+        if !input.Scan() {
+            return nil, errors.New("no question bank chosen")
+        }
+        choice, err := strconv.Atoi(strings.TrimSpace(input.Text()))
+        if err != nil || choice < 1 || choice > len(banks) {
+            fmt.Println("Invalid choice. Please try again.")
+            continue
+        }
+        return banks[choice-1], nil
+    }
+}
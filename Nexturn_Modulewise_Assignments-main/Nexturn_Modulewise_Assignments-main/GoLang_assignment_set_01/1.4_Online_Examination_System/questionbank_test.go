@@ -0,0 +1,149 @@
+package main
+
+import (
+    "errors"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// writeBank writes a bank file into a temporary directory
+func writeBank(t *testing.T, name, content string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), name)
+    if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+        t.Fatalf("write bank: %v", err)
+    }
+    return path
+}
+
+func TestShippedBanksLoad(t *testing.T) {
+    paths, err := ListQuestionBanks(DEFAULT_BANK_DIR)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, path := range paths {
+        if _, err := LoadQuestionBank(path); err != nil {
+            t.Errorf("%s: %v", path, err)
+        }
+    }
+}
+
+func TestRightAnswerOutsideChoicesNamesLine(t *testing.T) {
+    path := writeBank(t, "broken.yaml", `name: Broken
+questions:
+  - statement: Which planet is largest?
+    choices: [Mars, Jupiter, Venus]
+    right_answer: 2
+  - statement: Which gas do we breathe?
+    choices: [Oxygen, Helium, Argon, Neon]
+    right_answer: 5
+  - type: multi_select
+    statement: Which are primes?
+    choices: ["2", "4", "5"]
+    right_answers: [1, 4]
+`)
+
+    _, err := LoadQuestionBank(path)
+    var validationErr *BankValidationError
+    if !errors.As(err, &validationErr) {
+        t.Fatalf("error %v; want a BankValidationError", err)
+    }
+
+    want := []QuestionError{
+        {Index: 1, Line: 6, Message: "right_answer 5 is outside the choices 1-4"},
+        {Index: 2, Line: 9, Message: "right_answers entry 4 is outside the choices 1-3"},
+    }
+    if len(validationErr.Problems) != len(want) {
+        t.Fatalf("problems %+v; want %d", validationErr.Problems, len(want))
+    }
+    for i, problem := range validationErr.Problems {
+        if problem.Index != want[i].Index || problem.Line != want[i].Line || problem.Message != want[i].Message {
+            t.Errorf("problem %d = %+v; want %+v", i, problem, want[i])
+        }
+    }
+
+    message := err.Error()
+    for _, fragment := range []string{path, `question 2 (line 6) "Which gas do we breathe?"`, "question 3 (line 9)"} {
+        if !strings.Contains(message, fragment) {
+            t.Errorf("error %q does not mention %q", message, fragment)
+        }
+    }
+}
+
+func TestBankValidation(t *testing.T) {
+    cases := []struct {
+        name    string
+        file    string
+        content string
+        want    string
+    }{
+        {
+            name: "json right answer", file: "bank.json",
+            content: `{"questions": [{"statement": "Pick one", "choices": ["a", "b"], "right_answer": 0}]}`,
+            want:    `question 1 "Pick one": right_answer 0 is outside the choices 1-2`,
+        },
+        {
+            name: "duplicate choices", file: "bank.yaml",
+            content: "questions:\n  - statement: Pick one\n    choices: [Yes, yes]\n    right_answer: 1\n",
+            want:    `question 1 (line 2) "Pick one": choice 2 "yes" is a duplicate`,
+        },
+        {
+            name: "numeric without an answer", file: "bank.yaml",
+            content: "questions:\n  - type: numeric\n    statement: How many?\n",
+            want:    "numeric_answer is missing",
+        },
+        {
+            name: "unknown field", file: "bank.yaml",
+            content: "questions:\n  - statement: Pick one\n    choices: [a, b]\n    right_anwser: 1\n",
+            want:    "field right_anwser not found",
+        },
+        {
+            name: "duplicate statements", file: "bank.yaml",
+            content: "questions:\n  - statement: Pick one\n    choices: [a, b]\n    right_answer: 1\n" +
+                "  - statement: \" Pick one \"\n    choices: [c, d]\n    right_answer: 2\n",
+            want: `question 2 (line 5) " Pick one ": statement repeats question 1`,
+        },
+        {
+            name: "empty bank", file: "bank.json",
+            content: `{"name": "Empty", "questions": []}`,
+            want:    "it has no questions",
+        },
+    }
+
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            _, err := LoadQuestionBank(writeBank(t, tc.file, tc.content))
+            if err == nil || !strings.Contains(err.Error(), tc.want) {
+                t.Errorf("error %v; want it to mention %q", err, tc.want)
+            }
+        })
+    }
+}
+
+func TestLoadQuestionBanksSkipsInvalidBanks(t *testing.T) {
+    dir := filepath.Dir(writeBank(t, "good.yaml", `name: Good
+questions:
+  - statement: Which planet is largest?
+    choices: [Mars, Jupiter]
+    right_answer: 2
+`))
+    if err := os.WriteFile(filepath.Join(dir, "bad.yaml"), []byte("name: Bad\nquestions: []\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    banks, err := loadQuestionBanks("", dir)
+    if err != nil || len(banks) != 1 || banks[0].Name != "Good" {
+        t.Errorf("loadQuestionBanks() = %v, %v; want only the valid bank", banks, err)
+    }
+
+    banks, err = loadQuestionBanks("", filepath.Join(dir, "missing"))
+    if err != nil || len(banks) != 1 || banks[0].Name != defaultQuestionBank().Name {
+        t.Errorf("loadQuestionBanks() without a bank directory = %v, %v; want the built-in bank", banks, err)
+    }
+
+    if _, err := loadQuestionBanks(filepath.Join(dir, "bad.yaml"), dir); err == nil {
+        t.Error("an invalid bank named on the command line was loaded")
+    }
+}
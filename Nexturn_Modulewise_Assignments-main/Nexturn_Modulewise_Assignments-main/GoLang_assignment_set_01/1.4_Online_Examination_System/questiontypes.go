@@ -0,0 +1,278 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode"
+)
+
+// Question types
+const (
+    SINGLE_CHOICE = "single_choice"
+    MULTI_SELECT  = "multi_select"
+    TRUE_FALSE    = "true_false"
+    NUMERIC       = "numeric"
+    SHORT_ANSWER  = "short_answer"
+)
+
+// Grade is the outcome of one answered question
+type Grade struct {
+    Credit   float64
+    Marks    float64
+    Feedback string
+    Response string
+    Invalid  bool
+}
+
+// errEmptyAnswer is returned when the participant submits nothing
+var errEmptyAnswer = errors.New("please enter an answer")
+
+// kind returns the problem's type, treating an unset type as single choice
+func (p Problem) kind() string {
+    if p.Type == "" {
+        return SINGLE_CHOICE
+    }
+    return p.Type
+}
+
+// hasChoices reports whether the problem is answered by picking choices
+func (p Problem) hasChoices() bool {
+    kind := p.kind()
+    return kind == SINGLE_CHOICE || kind == MULTI_SELECT
+}
+
+// answerPrompt tells the participant how to answer the problem
+func (p Problem) answerPrompt() string {
+    switch p.kind() {
+    case MULTI_SELECT:
+        return fmt.Sprintf("Enter all correct answers separated by commas (e.g. 1,3) or '%s' to exit: ", QUIT_COMMAND)
+    case TRUE_FALSE:
+        return fmt.Sprintf("Enter true or false (t/f) or '%s' to exit: ", QUIT_COMMAND)
+    case NUMERIC:
+        return fmt.Sprintf("Enter a number or '%s' to exit: ", QUIT_COMMAND)
+    case SHORT_ANSWER:
+        return fmt.Sprintf("Type your answer or '%s' to exit: ", QUIT_COMMAND)
+    default:
+        return fmt.Sprintf("Enter your answer (1-%d) or '%s' to exit: ", len(p.Choices), QUIT_COMMAND)
+    }
+}
+
+// correctAnswer describes the right answer for feedback
+func (p Problem) correctAnswer() string {
+    switch p.kind() {
+    case MULTI_SELECT:
+        answers := make([]string, len(p.RightAnswers))
+        for i, answer := range p.RightAnswers {
+            answers[i] = strconv.Itoa(answer)
+        }
+        return strings.Join(answers, ", ")
+    case TRUE_FALSE:
+        if p.Correct != nil && *p.Correct {
+            return "True"
+        }
+        return "False"
+    case NUMERIC:
+        answer := strconv.FormatFloat(*p.NumericAnswer, 'f', -1, 64)
+        if p.Tolerance > 0 {
+            answer += " (±" + strconv.FormatFloat(p.Tolerance, 'f', -1, 64) + ")"
+        }
+        return answer
+    case SHORT_ANSWER:
+        return p.AcceptedAnswers[0]
+    default:
+        return strconv.Itoa(p.RightAnswer)
+    }
+}
+
+// options lists what a candidate picks between, with whether each one is
+// right. Only choice and true/false questions have options.
+func (p Problem) options() ([]string, []bool) {
+    switch p.kind() {
+    case SINGLE_CHOICE:
+        right := make([]bool, len(p.Choices))
+        if p.RightAnswer >= 1 && p.RightAnswer <= len(p.Choices) {
+            right[p.RightAnswer-1] = true
+        }
+        return p.Choices, right
+    case MULTI_SELECT:
+        right := make([]bool, len(p.Choices))
+        for _, answer := range p.RightAnswers {
+            if answer >= 1 && answer <= len(p.Choices) {
+                right[answer-1] = true
+            }
+        }
+        return p.Choices, right
+    case TRUE_FALSE:
+        correct := p.Correct != nil && *p.Correct
+        return []string{"True", "False"}, []bool{correct, !correct}
+    }
+    return nil, nil
+}
+
+// selectedOptions returns the options a response picked, by their text so
+// they can be compared across attempts with differently shuffled choices
+func (p Problem) selectedOptions(response string) []string {
+    options, _ := p.options()
+    if len(options) == 0 || strings.TrimSpace(response) == "" {
+        return nil
+    }
+
+    var picked []int
+    switch p.kind() {
+    case TRUE_FALSE:
+        answer, err := parseTrueFalse(response)
+        if err != nil {
+            return nil
+        }
+        picked = []int{2}
+        if answer {
+            picked = []int{1}
+        }
+    default:
+        selected, err := parseSelection(response, len(options))
+        if err != nil {
+            return nil
+        }
+        picked = selected
+    }
+
+    selected := make([]string, len(picked))
+    for i, choice := range picked {
+        selected[i] = options[choice-1]
+    }
+    return selected
+}
+
+// Grade scores a response to the problem. An error means the response could
+// not be understood and the participant should be asked again.
+func (p Problem) Grade(response string) (Grade, error) {
+    if strings.TrimSpace(response) == "" {
+        return Grade{}, errEmptyAnswer
+    }
+
+    var credit float64
+    switch p.kind() {
+    case MULTI_SELECT:
+        selected, err := parseSelection(response, len(p.Choices))
+        if err != nil {
+            return Grade{}, err
+        }
+        credit = p.multiSelectCredit(selected)
+    case TRUE_FALSE:
+        answer, err := parseTrueFalse(response)
+        if err != nil {
+            return Grade{}, err
+        }
+        if answer == *p.Correct {
+            credit = 1
+        }
+    case NUMERIC:
+        answer, err := strconv.ParseFloat(strings.TrimSpace(response), 64)
+        if err != nil {
+            return Grade{}, errInvalidNumber
+        }
+        if math.Abs(answer-*p.NumericAnswer) <= p.Tolerance {
+            credit = 1
+        }
+    case SHORT_ANSWER:
+        answer := normalizeAnswer(response)
+        for _, accepted := range p.AcceptedAnswers {
+            if answer == normalizeAnswer(accepted) {
+                credit = 1
+                break
+            }
+        }
+    default:
+        choice, err := strconv.Atoi(strings.TrimSpace(response))
+        if err != nil {
+            return Grade{}, errInvalidNumber
+        }
+        if choice < 1 || choice > len(p.Choices) {
+            return Grade{Feedback: "Invalid selection. No points scored.", Invalid: true}, nil
+        }
+        if choice == p.RightAnswer {
+            credit = 1
+        }
+    }
+
+    switch {
+    case credit == 1:
+        return Grade{Credit: 1, Feedback: "Correct!"}, nil
+    case credit > 0:
+        return Grade{Credit: credit, Feedback: fmt.Sprintf("Partially correct (%.0f%% credit). The correct answers were: %s",
+            credit*100, p.correctAnswer())}, nil
+    default:
+        return Grade{Feedback: "Incorrect. The correct answer was: " + p.correctAnswer()}, nil
+    }
+}
+
+// multiSelectCredit gives a share of the mark for each right choice picked
+// and takes one share away for each wrong one, never going below zero
+func (p Problem) multiSelectCredit(selected []int) float64 {
+    right := make(map[int]bool, len(p.RightAnswers))
+    for _, answer := range p.RightAnswers {
+        right[answer] = true
+    }
+
+    hits, misses := 0, 0
+    for _, choice := range selected {
+        if right[choice] {
+            hits++
+        } else {
+            misses++
+        }
+    }
+    return math.Max(0, float64(hits-misses)/float64(len(p.RightAnswers)))
+}
+
+// parseSelection reads a list of choice numbers separated by commas or spaces
+func parseSelection(response string, choiceCount int) ([]int, error) {
+    fields := strings.FieldsFunc(response, func(r rune) bool {
+        return r == ',' || unicode.IsSpace(r)
+    })
+
+    seen := make(map[int]bool)
+    selected := make([]int, 0, len(fields))
+    for _, field := range fields {
+        choice, err := strconv.Atoi(field)
+        if err != nil {
+            return nil, errors.New("please enter choice numbers separated by commas")
+        }
+        if choice < 1 || choice > choiceCount {
+            return nil, fmt.Errorf("choice %d is not between 1 and %d", choice, choiceCount)
+        }
+        if !seen[choice] {
+            seen[choice] = true
+            selected = append(selected, choice)
+        }
+    }
+    sort.Ints(selected)
+    return selected, nil
+}
+
+// parseTrueFalse accepts true/false, t/f and yes/no in any case
+func parseTrueFalse(response string) (bool, error) {
+    switch strings.ToLower(strings.TrimSpace(response)) {
+    case "true", "t", "yes", "y":
+        return true, nil
+    case "false", "f", "no", "n":
+        return false, nil
+    }
+    return false, errors.New("please enter true or false")
+}
+
+// normalizeAnswer lowercases text, drops punctuation and collapses spaces so
+// short answers match regardless of formatting
+func normalizeAnswer(text string) string {
+    cleaned := strings.Map(func(r rune) rune {
+        if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+            return unicode.ToLower(r)
+        }
+        return -1
+    }, text)
+    return strings.Join(strings.Fields(cleaned), " ")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+    "math"
+    "testing"
+)
+
+// floatPtr returns a pointer to a literal answer
+func floatPtr(value float64) *float64 {
+    return &value
+}
+
+// boolPtr returns a pointer to a literal answer
+func boolPtr(value bool) *bool {
+    return &value
+}
+
+func TestGradeQuestionTypes(t *testing.T) {
+    multi := Problem{Type: MULTI_SELECT, Choices: []string{"a", "b", "c", "d", "e"}, RightAnswers: []int{1, 3, 5}}
+    numeric := Problem{Type: NUMERIC, NumericAnswer: floatPtr(2.5), Tolerance: 0.25}
+    exact := Problem{Type: NUMERIC, NumericAnswer: floatPtr(42)}
+    short := Problem{Type: SHORT_ANSWER, AcceptedAnswers: []string{"New Delhi", "Delhi"}}
+    trueFalse := Problem{Type: TRUE_FALSE, Correct: boolPtr(false)}
+
+    cases := []struct {
+        name     string
+        problem  Problem
+        response string
+        credit   float64
+    }{
+        {"multi all right", multi, "1,3,5", 1},
+        {"multi any order and spacing", multi, " 5 3, 1 ", 1},
+        {"multi repeated choice counts once", multi, "1,1,3", 2.0 / 3},
+        {"multi one right", multi, "3", 1.0 / 3},
+        {"multi wrong cancels right", multi, "1,2", 0},
+        {"multi two right one wrong", multi, "1,3,4", 1.0 / 3},
+        {"multi never negative", multi, "2,4", 0},
+        {"multi everything", multi, "1,2,3,4,5", 1.0 / 3},
+        {"numeric exact", numeric, "2.5", 1},
+        {"numeric inside tolerance", numeric, "2.6", 1},
+        {"numeric at lower tolerance", numeric, "2.25", 1},
+        {"numeric at upper tolerance", numeric, "2.75", 1},
+        {"numeric outside tolerance", numeric, "2.76", 0},
+        {"numeric negative", numeric, "-2.5", 0},
+        {"numeric surrounding spaces", numeric, "  2.4 ", 1},
+        {"numeric without tolerance", exact, "42.0", 1},
+        {"numeric without tolerance misses", exact, "42.01", 0},
+        {"short exact", short, "New Delhi", 1},
+        {"short case and spacing", short, "  new   DELHI ", 1},
+        {"short punctuation joins words", short, "New-Delhi!", 0},
+        {"short punctuation dropped", short, "delhi.", 1},
+        {"short other accepted answer", short, "DELHI", 1},
+        {"short wrong", short, "Mumbai", 0},
+        {"true false letters", trueFalse, "F", 1},
+        {"true false words", trueFalse, "yes", 0},
+    }
+
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            grade, err := tc.problem.Grade(tc.response)
+            if err != nil {
+                t.Fatalf("Grade(%q) = %v", tc.response, err)
+            }
+            if math.Abs(grade.Credit-tc.credit) > 1e-9 {
+                t.Errorf("Grade(%q) credit = %v; want %v", tc.response, grade.Credit, tc.credit)
+            }
+        })
+    }
+}
+
+func TestGradeRejectsUnreadableResponses(t *testing.T) {
+    cases := []struct {
+        name     string
+        problem  Problem
+        response string
+    }{
+        {"empty", Problem{Type: SHORT_ANSWER, AcceptedAnswers: []string{"x"}}, "   "},
+        {"multi out of range", Problem{Type: MULTI_SELECT, Choices: []string{"a", "b"}, RightAnswers: []int{1}}, "1,3"},
+        {"multi not a number", Problem{Type: MULTI_SELECT, Choices: []string{"a", "b"}, RightAnswers: []int{1}}, "a,b"},
+        {"numeric text", Problem{Type: NUMERIC, NumericAnswer: floatPtr(1)}, "one"},
+        {"true false other word", Problem{Type: TRUE_FALSE, Correct: boolPtr(true)}, "maybe"},
+    }
+
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            if grade, err := tc.problem.Grade(tc.response); err == nil {
+                t.Errorf("Grade(%q) = %+v; want it asked again", tc.response, grade)
+            }
+        })
+    }
+}
+
+func TestNormalizeAnswer(t *testing.T) {
+    cases := map[string]string{
+        "  The   Moon ":  "the moon",
+        "H2O":            "h2o",
+        "rock 'n' roll!": "rock n roll",
+        "São Paulo":      "são paulo",
+        "?!.":            "",
+    }
+    for text, want := range cases {
+        if got := normalizeAnswer(text); got != want {
+            t.Errorf("normalizeAnswer(%q) = %q; want %q", text, got, want)
+        }
+    }
+}
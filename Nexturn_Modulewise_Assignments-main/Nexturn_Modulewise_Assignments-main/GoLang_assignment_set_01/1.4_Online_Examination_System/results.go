@@ -0,0 +1,329 @@
+package main
+
+import (
+    "bufio"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// DEFAULT_RESULTS_FILE is the JSON-lines file attempts are recorded in
+const DEFAULT_RESULTS_FILE = "exam_results.jsonl"
+
+// Question outcomes
+const (
+    OUTCOME_ANSWERED    = "answered"
+    OUTCOME_TIMED_OUT   = "timed_out"
+    OUTCOME_UNANSWERED  = "unanswered"
+    OUTCOME_NOT_REACHED = "not_reached"
+)
+
+// Reasons an attempt ended
+const (
+    END_COMPLETED    = "completed"
+    END_QUIT         = "quit"
+    END_TIME_UP      = "time_up"
+    END_INTERRUPTED  = "interrupted"
+    END_INPUT_CLOSED = "input_closed"
+)
+
+// AnswerRecord is how one question of an attempt went
+type AnswerRecord struct {
+    Question  int      `json:"question"`
+    Topic     string   `json:"topic,omitempty"`
+    Type      string   `json:"type"`
+    Statement string   `json:"statement"`
+    Response  string   `json:"response,omitempty"`
+    Selected  []string `json:"selected,omitempty"`
+    Credit    float64  `json:"credit"`
+    Marks     float64  `json:"marks"`
+    MaxMarks  float64  `json:"max_marks"`
+    Outcome   string   `json:"outcome"`
+    Seconds   float64  `json:"seconds"`
+}
+
+// AttemptRecord is one candidate's completed or abandoned exam
+type AttemptRecord struct {
+    ID            string           `json:"id"`
+    CandidateID   string           `json:"candidate_id"`
+    Bank          string           `json:"bank"`
+    Options       ExamOptions      `json:"options"`
+    StartedAt     time.Time        `json:"started_at"`
+    FinishedAt    time.Time        `json:"finished_at"`
+    EndReason     string           `json:"end_reason"`
+    QuestionCount int              `json:"question_count"`
+    Score         float64          `json:"score"`
+    MaxScore      float64          `json:"max_score"`
+    Percentage    float64          `json:"percentage"`
+    Performance   string           `json:"performance"`
+    Passed        bool             `json:"passed"`
+    Ability       *AbilityEstimate `json:"ability,omitempty"`
+    Answers       []AnswerRecord   `json:"answers"`
+}
+
+// Duration is how long the attempt took
+func (a AttemptRecord) Duration() time.Duration {
+    return a.FinishedAt.Sub(a.StartedAt)
+}
+
+// ResultStore appends attempts to a JSON-lines file and reads them back
+type ResultStore struct {
+    path string
+    mu   sync.Mutex
+}
+
+// NewResultStore returns a store backed by the given file
+func NewResultStore(path string) *ResultStore {
+    return &ResultStore{path: path}
+}
+
+// randomID returns a random hex identifier of the given number of bytes
+func randomID(size int) string {
+    buf := make([]byte, size)
+    if _, err := rand.Read(buf); err != nil {
+        return fmt.Sprintf("%x", time.Now().UnixNano())
+    }
+    return hex.EncodeToString(buf)
+}
+
+// Append records an attempt as one line at the end of the file
+func (s *ResultStore) Append(record AttemptRecord) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    data, err := json.Marshal(record)
+    if err != nil {
+        return fmt.Errorf("failed to encode attempt: %v", err)
+    }
+
+    file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+    if err != nil {
+        return fmt.Errorf("failed to open results file: %v", err)
+    }
+    defer file.Close()
+
+    if _, err := file.Write(append(data, '\n')); err != nil {
+        return fmt.Errorf("failed to write attempt: %v", err)
+    }
+    return nil
+}
+
+// Load reads every recorded attempt. A missing file means no attempts yet.
+func (s *ResultStore) Load() ([]AttemptRecord, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    file, err := os.Open(s.path)
+    if errors.Is(err, os.ErrNotExist) {
+        return []AttemptRecord{}, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to open results file: %v", err)
+    }
+    defer file.Close()
+
+    records := make([]AttemptRecord, 0)
+    scanner := bufio.NewScanner(file)
+    scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+    for lineNumber := 1; scanner.Scan(); lineNumber++ {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" {
+            continue
+        }
+        var record AttemptRecord
+        if err := json.Unmarshal([]byte(line), &record); err != nil {
+            return nil, fmt.Errorf("failed to parse %s line %d: %v", s.path, lineNumber, err)
+        }
+        records = append(records, record)
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read results file: %v", err)
+    }
+    return records, nil
+}
+
+// AttemptsFor returns a candidate's attempts, oldest first
+func (s *ResultStore) AttemptsFor(candidateID string) ([]AttemptRecord, error) {
+    records, err := s.Load()
+    if err != nil {
+        return nil, err
+    }
+
+    attempts := make([]AttemptRecord, 0)
+    for _, record := range records {
+        if record.CandidateID == candidateID {
+            attempts = append(attempts, record)
+        }
+    }
+    sort.SliceStable(attempts, func(i, j int) bool {
+        return attempts[i].StartedAt.Before(attempts[j].StartedAt)
+    })
+    return attempts, nil
+}
+
+// Leaderboard returns each candidate's best attempt at a bank, ranked by
+// percentage, then by the quicker attempt, then by who finished first
+func (s *ResultStore) Leaderboard(bank string, limit int) ([]AttemptRecord, error) {
+    records, err := s.Load()
+    if err != nil {
+        return nil, err
+    }
+
+    best := make(map[string]AttemptRecord)
+    for _, record := range records {
+        if !strings.EqualFold(record.Bank, bank) {
+            continue
+        }
+        current, exists := best[record.CandidateID]
+        if !exists || ranksAbove(record, current) {
+            best[record.CandidateID] = record
+        }
+    }
+
+    entries := make([]AttemptRecord, 0, len(best))
+    for _, record := range best {
+        entries = append(entries, record)
+    }
+    sort.Slice(entries, func(i, j int) bool {
+        return ranksAbove(entries[i], entries[j])
+    })
+    if limit > 0 && len(entries) > limit {
+        entries = entries[:limit]
+    }
+    return entries, nil
+}
+
+// ranksAbove reports whether attempt a places higher than attempt b
+func ranksAbove(a, b AttemptRecord) bool {
+    if a.Percentage != b.Percentage {
+        return a.Percentage > b.Percentage
+    }
+    if a.Duration() != b.Duration() {
+        return a.Duration() < b.Duration()
+    }
+    return a.FinishedAt.Before(b.FinishedAt)
+}
+
+// WriteAttempts prints a candidate's attempts
+func WriteAttempts(w io.Writer, candidateID string, attempts []AttemptRecord) {
+    if len(attempts) == 0 {
+        fmt.Fprintf(w, "No attempts recorded for %s.\n", candidateID)
+        return
+    }
+
+    fmt.Fprintf(w, "Attempts by %s:\n", candidateID)
+    for _, attempt := range attempts {
+        fmt.Fprintf(w, "%s  %-24s %6.2f/%-6.2f %6.2f%%  %-17s %-12s %s\n",
+            attempt.StartedAt.Local().Format("2006-01-02 15:04"), attempt.Bank,
+            attempt.Score, attempt.MaxScore, attempt.Percentage,
+            attempt.Performance, attempt.EndReason, attempt.Duration().Round(time.Second))
+    }
+}
+
+// WriteLeaderboard prints the ranked attempts at a bank
+func WriteLeaderboard(w io.Writer, bank string, entries []AttemptRecord) {
+    if len(entries) == 0 {
+        fmt.Fprintf(w, "No attempts recorded for %s.\n", bank)
+        return
+    }
+
+    fmt.Fprintf(w, "Leaderboard: %s\n", entries[0].Bank)
+    for i, entry := range entries {
+        fmt.Fprintf(w, "%3d. %-20s %6.2f%%  %-17s %s\n",
+            i+1, entry.CandidateID, entry.Percentage, entry.Performance, entry.Duration().Round(time.Second))
+    }
+}
+
+// recordAnswer notes how a question went and how long it was on screen
+func (e *Examination) recordAnswer(index int, problem Problem, grade Grade, outcome string, shownAt, endedAt time.Time) {
+    e.Answers = append(e.Answers, AnswerRecord{
+        Question:  index + 1,
+        Topic:     problem.Topic,
+        Type:      problem.kind(),
+        Statement: problem.Statement,
+        Response:  grade.Response,
+        Selected:  problem.selectedOptions(grade.Response),
+        Credit:    grade.Credit,
+        Marks:     grade.Marks,
+        MaxMarks:  problem.marks(),
+        Outcome:   outcome,
+        Seconds:   endedAt.Sub(shownAt).Seconds(),
+    })
+    if e.Adaptive != nil && (outcome == OUTCOME_ANSWERED || outcome == OUTCOME_TIMED_OUT) {
+        e.Adaptive.Record(problem, grade.Credit)
+    }
+}
+
+// end marks the attempt as over. An adaptive attempt is scored on the
+// questions it actually asked.
+func (e *Examination) end(reason string) {
+    e.EndReason = reason
+    e.FinishedAt = e.Clock.Now()
+    if e.Adaptive != nil {
+        e.QuestionCount = len(e.Answers)
+    }
+}
+
+// finish ends the attempt and shows the results. An interrupted attempt
+// is saved to be resumed instead, with the question it was on counted as
+// asked and unanswered so it cannot be seen again with fresh time.
+func (e *Examination) finish(reason string) {
+    e.end(reason)
+    if e.Resumable() {
+        e.saveCheckpoint()
+        fmt.Printf("Your progress has been saved. Start the exam again as %s to resume.\n", e.candidateID)
+        return
+    }
+    e.removeCheckpoint()
+    e.showResults()
+}
+
+// Record builds the stored form of the attempt. Questions the candidate
+// never reached are included so every attempt lists the whole exam, except
+// in adaptive mode where the exam is only the questions that were asked.
+func (e *Examination) Record(candidateID, bank string) AttemptRecord {
+    answers := make([]AnswerRecord, len(e.Answers), len(e.Problems))
+    copy(answers, e.Answers)
+    for i := len(answers); i < len(e.Problems) && e.Adaptive == nil; i++ {
+        problem := e.Problems[i]
+        answers = append(answers, AnswerRecord{
+            Question:  i + 1,
+            Topic:     problem.Topic,
+            Type:      problem.kind(),
+            Statement: problem.Statement,
+            MaxMarks:  problem.marks(),
+            Outcome:   OUTCOME_NOT_REACHED,
+        })
+    }
+
+    percentage := e.percentage()
+    record := AttemptRecord{
+        ID:            randomID(8),
+        CandidateID:   candidateID,
+        Bank:          bank,
+        StartedAt:     e.StartedAt,
+        FinishedAt:    e.FinishedAt,
+        EndReason:     e.EndReason,
+        QuestionCount: e.QuestionCount,
+        Score:         e.TotalScore,
+        MaxScore:      e.maxScore(),
+        Percentage:    percentage,
+        Performance:   e.Scoring.performance(percentage),
+        Passed:        e.Scoring.passed(percentage),
+        Options:       e.Options,
+        Answers:       answers,
+    }
+    if e.Adaptive != nil {
+        estimate := e.Adaptive.Estimate()
+        record.Ability = &estimate
+    }
+    return record
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// attempt builds a record that started at base plus offset and took the
+// given number of minutes
+func attempt(candidate, bank string, percentage float64, offset, minutes int) AttemptRecord {
+    base := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+    started := base.Add(time.Duration(offset) * time.Minute)
+    return AttemptRecord{
+        ID:          fmt.Sprintf("%s-%d", candidate, offset),
+        CandidateID: candidate,
+        Bank:        bank,
+        StartedAt:   started,
+        FinishedAt:  started.Add(time.Duration(minutes) * time.Minute),
+        EndReason:   END_COMPLETED,
+        Percentage:  percentage,
+    }
+}
+
+// attemptIDs lists the IDs of the given attempts in order
+func attemptIDs(attempts []AttemptRecord) []string {
+    ids := make([]string, 0, len(attempts))
+    for _, attempt := range attempts {
+        ids = append(ids, attempt.ID)
+    }
+    return ids
+}
+
+// newStore returns a store in a temporary directory holding the given attempts
+func newStore(t *testing.T, attempts ...AttemptRecord) *ResultStore {
+    t.Helper()
+    store := NewResultStore(filepath.Join(t.TempDir(), "results.jsonl"))
+    for _, attempt := range attempts {
+        if err := store.Append(attempt); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return store
+}
+
+func TestResultStoreRoundTrip(t *testing.T) {
+    store := newStore(t)
+    records, err := store.Load()
+    if err != nil || len(records) != 0 {
+        t.Fatalf("Load() on a missing file = %v, %v; want no attempts", records, err)
+    }
+
+    first := attempt("asha", "General Knowledge", 80, 0, 10)
+    first.Options = ExamOptions{Seed: 42, PerTopic: 2, ShuffleQuestions: true}
+    first.Answers = []AnswerRecord{
+        {Question: 1, Type: SINGLE_CHOICE, Statement: "Pick one", Response: "2", Credit: 1, Marks: 1, MaxMarks: 1, Outcome: OUTCOME_ANSWERED, Seconds: 4.5},
+        {Question: 2, Type: MULTI_SELECT, Statement: "Pick some", Selected: []string{"a", "c"}, Credit: 0.5, Marks: 1, MaxMarks: 2, Outcome: OUTCOME_ANSWERED},
+    }
+    second := attempt("ravi", "Science", 40, 5, 20)
+    second.EndReason = END_TIME_UP
+    for _, record := range []AttemptRecord{first, second} {
+        if err := store.Append(record); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    records, err = store.Load()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := []AttemptRecord{first, second}; !reflect.DeepEqual(records, want) {
+        t.Errorf("Load() = %+v; want %+v", records, want)
+    }
+}
+
+func TestRecordKeepsOptions(t *testing.T) {
+    options := ExamOptions{Seed: 42, PerTopic: 1, ShuffleQuestions: true, ShuffleChoices: false}
+    exam := NewExamination(defaultQuestionBank(), bufio.NewScanner(strings.NewReader("")), options)
+    if record := exam.Record("asha", "General Knowledge"); record.Options != options {
+        t.Errorf("Record() kept options %+v; want %+v", record.Options, options)
+    }
+}
+
+func TestResultStoreLoadErrors(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "results.jsonl")
+    content := `{"id": "one", "candidate_id": "asha"}` + "\n\n" + `{"id": "two", "candidate_id": ` + "\n"
+    if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    _, err := NewResultStore(path).Load()
+    if err == nil || !strings.Contains(err.Error(), path+" line 3") {
+        t.Errorf("Load() = %v; want it to name line 3 of %s", err, path)
+    }
+}
+
+func TestResultStoreConcurrentAppends(t *testing.T) {
+    store := newStore(t)
+
+    var wg sync.WaitGroup
+    for i := 0; i < 20; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            if err := store.Append(attempt(fmt.Sprintf("c%d", i), "Science", 50, i, 1)); err != nil {
+                t.Error(err)
+            }
+        }(i)
+    }
+    wg.Wait()
+
+    records, err := store.Load()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(records) != 20 {
+        t.Errorf("Load() returned %d attempts; want 20", len(records))
+    }
+}
+
+func TestAttemptsFor(t *testing.T) {
+    store := newStore(t,
+        attempt("asha", "Science", 70, 30, 5),
+        attempt("ravi", "Science", 90, 10, 5),
+        attempt("asha", "General Knowledge", 60, 0, 5),
+        attempt("asha", "Science", 40, 20, 5),
+    )
+
+    attempts, err := store.AttemptsFor("asha")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got, want := attemptIDs(attempts), []string{"asha-0", "asha-20", "asha-30"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("AttemptsFor(asha) = %v; want %v", got, want)
+    }
+
+    attempts, err = store.AttemptsFor("nobody")
+    if err != nil || len(attempts) != 0 {
+        t.Errorf("AttemptsFor(nobody) = %v, %v; want no attempts", attempts, err)
+    }
+}
+
+func TestLeaderboardOrdering(t *testing.T) {
+    store := newStore(t,
+        // Only each candidate's best attempt counts
+        attempt("asha", "Science", 60, 0, 10),
+        attempt("asha", "Science", 85, 60, 12),
+        // Level with asha, but quicker
+        attempt("ravi", "Science", 85, 120, 8),
+        // Level with ravi in percentage and time, but finished later
+        attempt("meera", "Science", 85, 180, 8),
+        // The same score as before at a faster time replaces the older one
+        attempt("john", "Science", 50, 10, 30),
+        attempt("john", "Science", 50, 200, 15),
+        attempt("li", "science", 95, 240, 40),
+        // Other banks are left out
+        attempt("asha", "General Knowledge", 100, 300, 1),
+    )
+
+    entries, err := store.Leaderboard("SCIENCE", 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []string{"li-240", "ravi-120", "meera-180", "asha-60", "john-200"}
+    if got := attemptIDs(entries); !reflect.DeepEqual(got, want) {
+        t.Errorf("Leaderboard() = %v; want %v", got, want)
+    }
+
+    entries, err = store.Leaderboard("Science", 2)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := attemptIDs(entries); !reflect.DeepEqual(got, want[:2]) {
+        t.Errorf("Leaderboard() limited to 2 = %v; want %v", got, want[:2])
+    }
+
+    entries, err = store.Leaderboard("History", 0)
+    if err != nil || len(entries) != 0 {
+        t.Errorf("Leaderboard(History) = %v, %v; want no entries", entries, err)
+    }
+}
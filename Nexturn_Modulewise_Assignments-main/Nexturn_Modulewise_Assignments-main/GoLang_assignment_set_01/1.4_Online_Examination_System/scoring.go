@@ -0,0 +1,163 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "sort"
+    "strings"
+)
+
+// DEFAULT_MARKS is what a question is worth when the bank does not say
+const DEFAULT_MARKS = 1.0
+
+// GradeBand names the performance of candidates scoring at least MinPercent
+type GradeBand struct {
+    Name       string  `json:"name" yaml:"name"`
+    MinPercent float64 `json:"min_percent" yaml:"min_percent"`
+}
+
+// ScoringRules decide how answers turn into marks and marks into a grade.
+// NegativeMarking is the share of a question's marks lost for a wrong
+// answer; timeouts and unanswered questions are never penalised.
+type ScoringRules struct {
+    NegativeMarking float64     `json:"negative_marking,omitempty" yaml:"negative_marking,omitempty"`
+    PassMark        *float64    `json:"pass_mark,omitempty" yaml:"pass_mark,omitempty"`
+    GradeBands      []GradeBand `json:"grade_bands,omitempty" yaml:"grade_bands,omitempty"`
+}
+
+// defaultGradeBands are the bands used when a bank defines none
+func defaultGradeBands() []GradeBand {
+    return []GradeBand{
+        {Name: "Outstanding", MinPercent: OUTSTANDING},
+        {Name: "Very Good", MinPercent: VERY_GOOD},
+        {Name: "Acceptable", MinPercent: ACCEPTABLE},
+        {Name: "Needs Improvement", MinPercent: 0},
+    }
+}
+
+// scoringRules returns the bank's rules with defaults filled in and the
+// grade bands ordered from the highest
+func (bank *QuestionBank) scoringRules() ScoringRules {
+    rules := ScoringRules{}
+    if bank.Scoring != nil {
+        rules = *bank.Scoring
+    }
+    if rules.PassMark == nil {
+        passMark := PASS_MARKS_PERCENT
+        rules.PassMark = &passMark
+    }
+    if len(rules.GradeBands) == 0 {
+        rules.GradeBands = defaultGradeBands()
+    }
+
+    bands := make([]GradeBand, len(rules.GradeBands))
+    copy(bands, rules.GradeBands)
+    sort.SliceStable(bands, func(i, j int) bool {
+        return bands[i].MinPercent > bands[j].MinPercent
+    })
+    rules.GradeBands = bands
+    return rules
+}
+
+// validate returns a message for each thing wrong with the rules
+func (rules *ScoringRules) validate() []string {
+    messages := make([]string, 0)
+    if rules.NegativeMarking < 0 || rules.NegativeMarking > 1 {
+        messages = append(messages, fmt.Sprintf("negative_marking %.2f must be between 0 and 1", rules.NegativeMarking))
+    }
+    if rules.PassMark != nil && (*rules.PassMark < 0 || *rules.PassMark > 100) {
+        messages = append(messages, fmt.Sprintf("pass_mark %.2f must be between 0 and 100", *rules.PassMark))
+    }
+
+    if len(rules.GradeBands) == 0 {
+        return messages
+    }
+    coversZero := false
+    seen := make(map[string]bool)
+    for i, band := range rules.GradeBands {
+        name := strings.TrimSpace(band.Name)
+        switch {
+        case name == "":
+            messages = append(messages, fmt.Sprintf("grade band %d has no name", i+1))
+        case seen[strings.ToLower(name)]:
+            messages = append(messages, fmt.Sprintf("grade band %q is repeated", name))
+        }
+        seen[strings.ToLower(name)] = true
+        if band.MinPercent < 0 || band.MinPercent > 100 {
+            messages = append(messages, fmt.Sprintf("grade band %q min_percent %.2f must be between 0 and 100", name, band.MinPercent))
+        }
+        if band.MinPercent == 0 {
+            coversZero = true
+        }
+    }
+    if !coversZero {
+        messages = append(messages, "grade_bands need a band with min_percent 0")
+    }
+    return messages
+}
+
+// performance names the band a percentage falls in
+func (rules ScoringRules) performance(percentage float64) string {
+    for _, band := range rules.GradeBands {
+        if percentage >= band.MinPercent {
+            return band.Name
+        }
+    }
+    return rules.GradeBands[len(rules.GradeBands)-1].Name
+}
+
+// passed reports whether a percentage reaches the pass mark
+func (rules ScoringRules) passed(percentage float64) bool {
+    return percentage >= *rules.PassMark
+}
+
+// marks returns what the problem is worth
+func (p Problem) marks() float64 {
+    if p.Marks > 0 {
+        return p.Marks
+    }
+    return DEFAULT_MARKS
+}
+
+// applyGrade turns a graded answer into marks and adds them to the score.
+// A wrong answer loses the negative marking share of the question's marks;
+// partial credit and invalid selections are never penalised.
+func (e *Examination) applyGrade(problem Problem, grade Grade) Grade {
+    grade.Marks = grade.Credit * problem.marks()
+    if grade.Credit == 0 && !grade.Invalid && e.Scoring.NegativeMarking > 0 {
+        grade.Marks = -e.Scoring.NegativeMarking * problem.marks()
+        grade.Feedback += fmt.Sprintf(" (%.2f marks)", grade.Marks)
+    }
+
+    e.TotalScore += grade.Marks
+    if grade.Credit == 1 {
+        e.CorrectCount++
+    }
+    return grade
+}
+
+// maxScore is the most marks the questions of the attempt are worth. An
+// adaptive attempt is only worth the questions it asked.
+func (e *Examination) maxScore() float64 {
+    total := 0.0
+    if e.Adaptive != nil {
+        for _, answer := range e.Answers {
+            total += answer.MaxMarks
+        }
+        return total
+    }
+    for _, problem := range e.Problems {
+        total += problem.marks()
+    }
+    return total
+}
+
+// percentage is the score as a share of the marks available. Negative
+// marking can push the score below zero, but the percentage stops at 0.
+func (e *Examination) percentage() float64 {
+    maxScore := e.maxScore()
+    if maxScore == 0 {
+        return 0
+    }
+    return math.Max(0, e.TotalScore/maxScore*100)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+    "math"
+    "testing"
+)
+
+func TestNegativeMarkingAndWeights(t *testing.T) {
+    bank := &QuestionBank{Scoring: &ScoringRules{NegativeMarking: 0.5}}
+    e := &Examination{
+        Problems: []Problem{
+            {Statement: "double", Choices: []string{"a", "b"}, RightAnswer: 1, Marks: 2},
+            {Statement: "single", Choices: []string{"a", "b"}, RightAnswer: 1},
+            {Statement: "skipped", Choices: []string{"a", "b"}, RightAnswer: 1},
+        },
+        Scoring: bank.scoringRules(),
+    }
+
+    right := e.applyGrade(e.Problems[0], Grade{Credit: 1})
+    wrong := e.applyGrade(e.Problems[1], Grade{})
+    invalid := e.applyGrade(e.Problems[1], Grade{Invalid: true})
+    if right.Marks != 2 || wrong.Marks != -0.5 || invalid.Marks != 0 {
+        t.Fatalf("marks = %v, %v, %v; want 2, -0.5, 0", right.Marks, wrong.Marks, invalid.Marks)
+    }
+    if e.TotalScore != 1.5 || e.CorrectCount != 1 {
+        t.Errorf("score = %v with %d correct; want 1.5 with 1", e.TotalScore, e.CorrectCount)
+    }
+    if got := e.percentage(); math.Abs(got-37.5) > 1e-9 {
+        t.Errorf("percentage = %.2f; want 37.50 of 4 marks", got)
+    }
+
+    e.applyGrade(e.Problems[0], Grade{})
+    e.applyGrade(e.Problems[0], Grade{})
+    if got := e.percentage(); got != 0 {
+        t.Errorf("percentage = %.2f after going negative; want 0", got)
+    }
+}
+
+func TestCustomGradeBands(t *testing.T) {
+    passMark := 60.0
+    bank := &QuestionBank{Scoring: &ScoringRules{
+        PassMark: &passMark,
+        GradeBands: []GradeBand{
+            {Name: "Fail", MinPercent: 0},
+            {Name: "Distinction", MinPercent: 85},
+            {Name: "Pass", MinPercent: 60},
+        },
+    }}
+    if messages := bank.Scoring.validate(); len(messages) > 0 {
+        t.Fatalf("valid rules rejected: %v", messages)
+    }
+
+    rules := bank.scoringRules()
+    cases := map[float64]string{100: "Distinction", 85: "Distinction", 84.9: "Pass", 60: "Pass", 10: "Fail"}
+    for percentage, want := range cases {
+        if got := rules.performance(percentage); got != want {
+            t.Errorf("performance(%.1f) = %q; want %q", percentage, got, want)
+        }
+    }
+    if rules.passed(59.9) || !rules.passed(60) {
+        t.Error("pass mark of 60 not applied")
+    }
+
+    defaults := (&QuestionBank{}).scoringRules()
+    if !defaults.passed(PASS_MARKS_PERCENT) || defaults.performance(OUTSTANDING) != "Outstanding" {
+        t.Error("banks without scoring rules should keep the default pass mark and bands")
+    }
+
+    bad := ScoringRules{GradeBands: []GradeBand{{Name: "Pass", MinPercent: 50}, {Name: "pass", MinPercent: 120}}}
+    if messages := bad.validate(); len(messages) != 3 {
+        t.Errorf("validate() = %v; want repeated name, range and missing 0 band", messages)
+    }
+}
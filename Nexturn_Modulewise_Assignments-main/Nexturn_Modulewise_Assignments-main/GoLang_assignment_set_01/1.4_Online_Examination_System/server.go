@@ -0,0 +1,699 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "html/template"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Server settings
+const (
+    SESSION_RETENTION      = time.Hour
+    SESSION_SWEEP_INTERVAL = time.Minute
+    MAX_REQUEST_BODY       = 1 << 16
+)
+
+// Session states
+const (
+    SESSION_IN_PROGRESS = "in_progress"
+    SESSION_FINISHED    = "finished"
+)
+
+// Session errors
+var (
+    ErrSessionNotFound  = errors.New("session not found")
+    ErrSessionFinished  = errors.New("the exam is already over")
+    ErrBankNotFound     = errors.New("question bank not found")
+    ErrCandidateMissing = errors.New("a candidate ID is required")
+    ErrInvalidAnswer    = errors.New("invalid answer")
+    ErrQuestionClosed   = errors.New("that question is no longer open")
+)
+
+// ExamSession is one candidate's exam in server mode. The server owns the
+// clock, so deadlines are checked whenever the session is touched and a
+// late answer is never accepted.
+type ExamSession struct {
+    ID          string
+    CandidateID string
+    BankID      string
+    BankName    string
+
+    mu               sync.Mutex
+    exam             *Examination
+    current          int
+    problem          Problem
+    shownAt          time.Time
+    questionDeadline time.Time
+    lastFeedback     string
+    pending          *AttemptRecord
+    result           *AttemptRecord
+}
+
+// ExamServer serves exams to many candidates over HTTP
+type ExamServer struct {
+    banks    map[string]*QuestionBank
+    bankIDs  []string
+    store    *ResultStore
+    clock    Clock
+    options  ExamOptions
+    duration time.Duration
+
+    mu       sync.Mutex
+    sessions map[string]*ExamSession
+}
+
+// NewExamServer serves the given banks, recording finished attempts in the
+// store. Each session gets its own seed; duration overrides the banks' own
+// exam duration when it is set.
+func NewExamServer(banks []*QuestionBank, store *ResultStore, options ExamOptions, duration time.Duration) *ExamServer {
+    server := &ExamServer{
+        banks:    make(map[string]*QuestionBank),
+        store:    store,
+        clock:    realClock{},
+        options:  options,
+        duration: duration,
+        sessions: make(map[string]*ExamSession),
+    }
+    for _, bank := range banks {
+        id := bankID(bank)
+        server.banks[id] = bank
+        server.bankIDs = append(server.bankIDs, id)
+    }
+    sort.Strings(server.bankIDs)
+    return server
+}
+
+// bankID is the identifier a bank is selected by: its file name without the
+// extension, or its name for banks that were not loaded from a file
+func bankID(bank *QuestionBank) string {
+    if bank.Source != "" {
+        return strings.TrimSuffix(filepath.Base(bank.Source), filepath.Ext(bank.Source))
+    }
+    return strings.ToLower(strings.ReplaceAll(bank.Name, " ", "_"))
+}
+
+// StartSession begins an exam for a candidate
+func (s *ExamServer) StartSession(candidateID, id string) (*ExamSession, error) {
+    candidateID = strings.TrimSpace(candidateID)
+    if candidateID == "" {
+        return nil, ErrCandidateMissing
+    }
+    bank, exists := s.banks[id]
+    if !exists {
+        return nil, fmt.Errorf("%w: %s", ErrBankNotFound, id)
+    }
+
+    options := s.options
+    options.Seed = NewSeed()
+    exam := NewExamination(bank, nil, options)
+    exam.Clock = s.clock
+    if s.duration > 0 {
+        exam.ExamDuration = s.duration
+    }
+    exam.StartedAt = s.clock.Now()
+    if exam.ExamDuration > 0 {
+        exam.examDeadline = exam.StartedAt.Add(exam.ExamDuration)
+    }
+
+    session := &ExamSession{
+        ID:          randomID(16),
+        CandidateID: candidateID,
+        BankID:      id,
+        BankName:    bank.Name,
+        exam:        exam,
+    }
+    session.showQuestion(exam.StartedAt)
+
+    s.mu.Lock()
+    s.sessions[session.ID] = session
+    s.mu.Unlock()
+    s.pruneSessions()
+    return session, nil
+}
+
+// pruneSessions applies the deadlines of sessions nobody has touched, so an
+// abandoned exam is still finished and recorded once its time runs out, and
+// forgets finished sessions once they have been kept long enough for the
+// candidate to see their result. Sessions are expired, and their attempts
+// written, without holding s.mu, so one slow write does not hold up every
+// other candidate.
+func (s *ExamServer) pruneSessions() {
+    s.mu.Lock()
+    sessions := make([]*ExamSession, 0, len(s.sessions))
+    for _, session := range s.sessions {
+        sessions = append(sessions, session)
+    }
+    s.mu.Unlock()
+
+    cutoff := s.clock.Now().Add(-SESSION_RETENTION)
+    for _, session := range sessions {
+        session.mu.Lock()
+        if err := s.expire(session); err != nil {
+            fmt.Fprintf(os.Stderr, "Error: session %s: %v\n", session.ID, err)
+        }
+        expired := session.result != nil && session.result.FinishedAt.Before(cutoff)
+        session.mu.Unlock()
+        if expired {
+            s.mu.Lock()
+            delete(s.sessions, session.ID)
+            s.mu.Unlock()
+        }
+    }
+}
+
+// SweepSessions prunes the sessions every SESSION_SWEEP_INTERVAL until the
+// context ends, so deadlines pass even when no requests come in
+func (s *ExamServer) SweepSessions(ctx context.Context) {
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-s.clock.After(SESSION_SWEEP_INTERVAL):
+        }
+        s.pruneSessions()
+    }
+}
+
+// Session looks up a session and applies any deadlines that have passed
+func (s *ExamServer) Session(id string) (*ExamSession, error) {
+    s.mu.Lock()
+    session, exists := s.sessions[id]
+    s.mu.Unlock()
+    if !exists {
+        return nil, ErrSessionNotFound
+    }
+
+    session.mu.Lock()
+    defer session.mu.Unlock()
+    if err := s.expire(session); err != nil {
+        return nil, err
+    }
+    return session, nil
+}
+
+// showQuestion picks the current question and starts its clock. It returns
+// false when there are no more questions to ask.
+func (session *ExamSession) showQuestion(at time.Time) bool {
+    problem, ok := session.exam.nextProblem(session.current)
+    if !ok {
+        return false
+    }
+    session.problem = problem
+    session.shownAt = at
+    session.questionDeadline = at.Add(session.exam.timeLimit(problem))
+    return true
+}
+
+// expire moves past every question whose time ran out since the session
+// was last touched, and ends the exam if its overall time is up. An attempt
+// that finished but could not be recorded is retried first. The caller
+// holds session.mu.
+func (s *ExamServer) expire(session *ExamSession) error {
+    if session.pending != nil {
+        return s.record(session)
+    }
+    exam := session.exam
+    now := s.clock.Now()
+    for session.result == nil {
+        problem := session.problem
+        if !exam.examDeadline.IsZero() && !now.Before(exam.examDeadline) &&
+            exam.examDeadline.Before(session.questionDeadline) {
+            exam.recordAnswer(session.current, problem, Grade{}, OUTCOME_UNANSWERED, session.shownAt, exam.examDeadline)
+            return s.finish(session, END_TIME_UP, exam.examDeadline)
+        }
+        if now.Before(session.questionDeadline) {
+            return nil
+        }
+
+        exam.recordAnswer(session.current, problem, Grade{}, OUTCOME_TIMED_OUT, session.shownAt, session.questionDeadline)
+        session.lastFeedback = "Time's up! The previous question was not answered in time."
+        if err := s.advance(session, session.questionDeadline); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// advance moves to the next question, finishing the exam after the last one
+func (s *ExamServer) advance(session *ExamSession, at time.Time) error {
+    session.current++
+    if !session.showQuestion(at) {
+        return s.finish(session, END_COMPLETED, at)
+    }
+    return nil
+}
+
+// finish ends the attempt at the given time and records it. The session
+// only counts as finished once the attempt is stored; until then it is
+// kept pending and recording it is retried whenever the session is touched.
+func (s *ExamServer) finish(session *ExamSession, reason string, at time.Time) error {
+    session.exam.end(reason)
+    session.exam.FinishedAt = at
+    record := session.exam.Record(session.CandidateID, session.BankName)
+    session.pending = &record
+    return s.record(session)
+}
+
+// record stores the pending attempt of a session and marks the session
+// finished. The caller holds session.mu.
+func (s *ExamServer) record(session *ExamSession) error {
+    if err := s.store.Append(*session.pending); err != nil {
+        return err
+    }
+    session.result = session.pending
+    session.pending = nil
+    return nil
+}
+
+// Answer grades a response to question number of a session. A response to a
+// question whose time has run out is refused, since the server has already
+// recorded that question as timed out and moved on.
+func (s *ExamServer) Answer(id string, number int, response string) (*ExamSession, Grade, error) {
+    session, err := s.Session(id)
+    if err != nil {
+        return nil, Grade{}, err
+    }
+
+    session.mu.Lock()
+    defer session.mu.Unlock()
+    // Deadlines may have passed between the lookup and taking the lock
+    if err := s.expire(session); err != nil {
+        return nil, Grade{}, err
+    }
+    if session.result != nil {
+        return session, Grade{}, ErrSessionFinished
+    }
+    if number != session.current+1 {
+        return session, Grade{}, fmt.Errorf("%w: question %d", ErrQuestionClosed, number)
+    }
+
+    problem := session.problem
+    grade, err := problem.Grade(response)
+    if err != nil {
+        return session, Grade{}, fmt.Errorf("%w: %v", ErrInvalidAnswer, err)
+    }
+    grade.Response = strings.TrimSpace(response)
+
+    now := s.clock.Now()
+    grade = session.exam.applyGrade(problem, grade)
+    session.exam.recordAnswer(session.current, problem, grade, OUTCOME_ANSWERED, session.shownAt, now)
+    session.lastFeedback = grade.Feedback
+    if err := s.advance(session, now); err != nil {
+        return session, grade, err
+    }
+    return session, grade, nil
+}
+
+// Quit ends a session at the candidate's request
+func (s *ExamServer) Quit(id string) (*ExamSession, error) {
+    session, err := s.Session(id)
+    if err != nil {
+        return nil, err
+    }
+
+    session.mu.Lock()
+    defer session.mu.Unlock()
+    // The exam may have ended between the lookup and taking the lock
+    if err := s.expire(session); err != nil {
+        return nil, err
+    }
+    if session.result != nil {
+        return session, nil
+    }
+    now := s.clock.Now()
+    problem := session.problem
+    session.exam.recordAnswer(session.current, problem, Grade{}, OUTCOME_UNANSWERED, session.shownAt, now)
+    return session, s.finish(session, END_QUIT, now)
+}
+
+// questionView is a question as shown to a candidate, without its answer
+type questionView struct {
+    Number       int      `json:"number"`
+    Total        int      `json:"total"`
+    Type         string   `json:"type"`
+    Topic        string   `json:"topic,omitempty"`
+    Statement    string   `json:"statement"`
+    Choices      []string `json:"choices,omitempty"`
+    TimeLimit    float64  `json:"time_limit_seconds"`
+    SecondsLeft  float64  `json:"seconds_left"`
+    MultiSelect  bool     `json:"-"`
+    TrueFalse    bool     `json:"-"`
+    FreeResponse bool     `json:"-"`
+}
+
+// sessionView is the state of a session sent to clients
+type sessionView struct {
+    ID              string         `json:"id"`
+    CandidateID     string         `json:"candidate_id"`
+    Bank            string         `json:"bank"`
+    Status          string         `json:"status"`
+    Score           float64        `json:"score"`
+    Feedback        string         `json:"feedback,omitempty"`
+    ExamSecondsLeft float64        `json:"exam_seconds_left,omitempty"`
+    Question        *questionView  `json:"question,omitempty"`
+    Result          *AttemptRecord `json:"result,omitempty"`
+}
+
+// view snapshots a session for a response. The caller holds session.mu.
+func (s *ExamServer) view(session *ExamSession) sessionView {
+    exam := session.exam
+    view := sessionView{
+        ID:          session.ID,
+        CandidateID: session.CandidateID,
+        Bank:        session.BankName,
+        Status:      SESSION_IN_PROGRESS,
+        Score:       exam.TotalScore,
+        Feedback:    session.lastFeedback,
+        Result:      session.result,
+    }
+    if session.result != nil {
+        view.Status = SESSION_FINISHED
+        return view
+    }
+
+    now := s.clock.Now()
+    if !exam.examDeadline.IsZero() {
+        view.ExamSecondsLeft = exam.examDeadline.Sub(now).Seconds()
+    }
+    problem := session.problem
+    view.Question = &questionView{
+        Number:       session.current + 1,
+        Total:        exam.QuestionCount,
+        Type:         problem.kind(),
+        Topic:        problem.Topic,
+        Statement:    problem.Statement,
+        Choices:      problem.Choices,
+        TimeLimit:    exam.timeLimit(problem).Seconds(),
+        SecondsLeft:  session.questionDeadline.Sub(now).Seconds(),
+        MultiSelect:  problem.kind() == MULTI_SELECT,
+        TrueFalse:    problem.kind() == TRUE_FALSE,
+        FreeResponse: problem.kind() == NUMERIC || problem.kind() == SHORT_ANSWER,
+    }
+    if !exam.examDeadline.IsZero() && exam.examDeadline.Before(session.questionDeadline) {
+        view.Question.SecondsLeft = view.ExamSecondsLeft
+    }
+    return view
+}
+
+// snapshot locks a session and returns its view
+func (s *ExamServer) snapshot(session *ExamSession) sessionView {
+    session.mu.Lock()
+    defer session.mu.Unlock()
+    return s.view(session)
+}
+
+// bankView describes a bank available to candidates
+type bankView struct {
+    ID          string `json:"id"`
+    Name        string `json:"name"`
+    Description string `json:"description,omitempty"`
+    Questions   int    `json:"questions"`
+}
+
+// bankViews lists the banks in a stable order
+func (s *ExamServer) bankViews() []bankView {
+    views := make([]bankView, 0, len(s.bankIDs))
+    for _, id := range s.bankIDs {
+        bank := s.banks[id]
+        views = append(views, bankView{ID: id, Name: bank.Name, Description: bank.Description, Questions: len(bank.Problems)})
+    }
+    return views
+}
+
+// Handler returns the routes of the HTML pages and the JSON API
+func (s *ExamServer) Handler() http.Handler {
+    mux := http.NewServeMux()
+
+    mux.HandleFunc("GET /{$}", s.handleHome)
+    mux.HandleFunc("POST /exam", s.handleStartPage)
+    mux.HandleFunc("GET /exam/{id}", s.handleSessionPage)
+    mux.HandleFunc("POST /exam/{id}/answer", s.handleAnswerPage)
+    mux.HandleFunc("POST /exam/{id}/quit", s.handleQuitPage)
+
+    mux.HandleFunc("GET /api/banks", s.handleBanks)
+    mux.HandleFunc("POST /api/sessions", s.handleStartSession)
+    mux.HandleFunc("GET /api/sessions/{id}", s.handleGetSession)
+    mux.HandleFunc("POST /api/sessions/{id}/answer", s.handleAnswer)
+    mux.HandleFunc("POST /api/sessions/{id}/quit", s.handleQuit)
+    mux.HandleFunc("GET /api/leaderboard/{bank}", s.handleLeaderboard)
+
+    return mux
+}
+
+// writeJSON sends a JSON response
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(value)
+}
+
+// errorStatus maps an error to the HTTP status reported for it
+func errorStatus(err error) int {
+    switch {
+    case errors.Is(err, ErrSessionNotFound), errors.Is(err, ErrBankNotFound):
+        return http.StatusNotFound
+    case errors.Is(err, ErrSessionFinished), errors.Is(err, ErrQuestionClosed):
+        return http.StatusConflict
+    case errors.Is(err, ErrCandidateMissing):
+        return http.StatusBadRequest
+    case errors.Is(err, ErrInvalidAnswer):
+        return http.StatusUnprocessableEntity
+    default:
+        return http.StatusInternalServerError
+    }
+}
+
+// writeError sends an error as JSON
+func writeError(w http.ResponseWriter, err error) {
+    writeJSON(w, errorStatus(err), map[string]string{"error": err.Error()})
+}
+
+// decodeJSON reads a small JSON request body
+func decodeJSON(w http.ResponseWriter, r *http.Request, value interface{}) error {
+    decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_REQUEST_BODY))
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(value); err != nil {
+        return fmt.Errorf("invalid request body: %v", err)
+    }
+    return nil
+}
+
+// handleBanks lists the available question banks
+func (s *ExamServer) handleBanks(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, s.bankViews())
+}
+
+// handleStartSession starts an exam from a JSON request
+func (s *ExamServer) handleStartSession(w http.ResponseWriter, r *http.Request) {
+    var request struct {
+        CandidateID string `json:"candidate_id"`
+        Bank        string `json:"bank"`
+    }
+    if err := decodeJSON(w, r, &request); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+
+    session, err := s.StartSession(request.CandidateID, request.Bank)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, s.snapshot(session))
+}
+
+// handleGetSession reports a session's current question or result
+func (s *ExamServer) handleGetSession(w http.ResponseWriter, r *http.Request) {
+    session, err := s.Session(r.PathValue("id"))
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, s.snapshot(session))
+}
+
+// handleAnswer grades a JSON answer to the current question
+func (s *ExamServer) handleAnswer(w http.ResponseWriter, r *http.Request) {
+    var request struct {
+        Question int    `json:"question"`
+        Response string `json:"response"`
+    }
+    if err := decodeJSON(w, r, &request); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+
+    session, grade, err := s.Answer(r.PathValue("id"), request.Question, request.Response)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "credit":   grade.Credit,
+        "marks":    grade.Marks,
+        "feedback": grade.Feedback,
+        "session":  s.snapshot(session),
+    })
+}
+
+// handleQuit ends a session from the JSON API
+func (s *ExamServer) handleQuit(w http.ResponseWriter, r *http.Request) {
+    session, err := s.Quit(r.PathValue("id"))
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, s.snapshot(session))
+}
+
+// handleLeaderboard ranks the candidates of a bank
+func (s *ExamServer) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+    bank, exists := s.banks[r.PathValue("bank")]
+    if !exists {
+        writeError(w, fmt.Errorf("%w: %s", ErrBankNotFound, r.PathValue("bank")))
+        return
+    }
+    entries, err := s.store.Leaderboard(bank.Name, 10)
+    if err != nil {
+        writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+        return
+    }
+    writeJSON(w, http.StatusOK, entries)
+}
+
+// pageTemplates are the HTML pages for browser candidates
+var pageTemplates = template.Must(template.New("layout").Funcs(template.FuncMap{
+    "add":     func(a, b int) int { return a + b },
+    "seconds": func(s float64) int { return int(s + 0.999) },
+}).Parse(`{{define "head"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Online Examination</title>
+<style>body{font-family:sans-serif;max-width:40em;margin:2em auto}label{display:block;margin:.3em 0}.error{color:#b00}.feedback{color:#064}</style>
+</head><body><h1>Online Examination</h1>{{end}}
+{{define "foot"}}</body></html>{{end}}
+
+{{define "home"}}{{template "head"}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/exam">
+<label>Candidate ID <input name="candidate_id" required></label>
+{{range .Banks}}<label><input type="radio" name="bank" value="{{.ID}}" required> {{.Name}} ({{.Questions}} questions){{if .Description}} - {{.Description}}{{end}}</label>
+{{end}}<button type="submit">Start exam</button>
+</form>
+{{template "foot"}}{{end}}
+
+{{define "session"}}{{template "head"}}
+{{if .Feedback}}<p class="feedback">{{.Feedback}}</p>{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{with .Question}}
+<h2>Question {{.Number}}/{{.Total}}</h2>
+<p>{{.Statement}}</p>
+<p>Time left: <span id="left">{{seconds .SecondsLeft}}</span>s{{if $.ExamSecondsLeft}} (exam: {{seconds $.ExamSecondsLeft}}s){{end}}</p>
+<form method="post" action="/exam/{{$.ID}}/answer">
+<input type="hidden" name="question" value="{{.Number}}">
+{{if .MultiSelect}}{{range $i, $choice := .Choices}}<label><input type="checkbox" name="choice" value="{{add $i 1}}"> {{$choice}}</label>
+{{end}}{{else if .TrueFalse}}<label><input type="radio" name="response" value="true" required> True</label>
+<label><input type="radio" name="response" value="false"> False</label>
+{{else if .FreeResponse}}<label><input name="response" autocomplete="off" required autofocus></label>
+{{else}}{{range $i, $choice := .Choices}}<label><input type="radio" name="response" value="{{add $i 1}}" required> {{$choice}}</label>
+{{end}}{{end}}<button type="submit">Submit answer</button>
+</form>
+<form method="post" action="/exam/{{$.ID}}/quit"><button type="submit">Quit exam</button></form>
+<script>
+var left = {{seconds .SecondsLeft}};
+setInterval(function () {
+    left--;
+    if (left <= 0) { location.reload(); return; }
+    document.getElementById("left").textContent = left;
+}, 1000);
+</script>
+{{end}}
+{{with .Result}}
+<h2>Final Results</h2>
+<p>Candidate: {{.CandidateID}}<br>Question bank: {{.Bank}}<br>
+Score: {{printf "%.2f" .Score}}/{{printf "%.2f" .MaxScore}} ({{printf "%.2f" .Percentage}}%)<br>
+Performance: {{.Performance}}</p>
+<p>{{if .Passed}}Congratulations! You passed the quiz!{{else}}Keep practicing and try again. You'll improve!{{end}}</p>
+<p><a href="/">Take another exam</a></p>
+{{end}}
+{{template "foot"}}{{end}}`))
+
+// renderPage writes an HTML page
+func renderPage(w http.ResponseWriter, status int, name string, data interface{}) {
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    w.WriteHeader(status)
+    pageTemplates.ExecuteTemplate(w, name, data)
+}
+
+// sessionPage is the data behind the question and result page
+type sessionPage struct {
+    sessionView
+    Error string
+}
+
+// handleHome shows the form to start an exam
+func (s *ExamServer) handleHome(w http.ResponseWriter, r *http.Request) {
+    renderPage(w, http.StatusOK, "home", map[string]interface{}{"Banks": s.bankViews()})
+}
+
+// handleStartPage starts an exam from the home page form
+func (s *ExamServer) handleStartPage(w http.ResponseWriter, r *http.Request) {
+    session, err := s.StartSession(r.FormValue("candidate_id"), r.FormValue("bank"))
+    if err != nil {
+        renderPage(w, errorStatus(err), "home", map[string]interface{}{"Banks": s.bankViews(), "Error": err.Error()})
+        return
+    }
+    http.Redirect(w, r, "/exam/"+session.ID, http.StatusSeeOther)
+}
+
+// handleSessionPage shows the current question or the result
+func (s *ExamServer) handleSessionPage(w http.ResponseWriter, r *http.Request) {
+    session, err := s.Session(r.PathValue("id"))
+    if err != nil {
+        http.Error(w, err.Error(), errorStatus(err))
+        return
+    }
+    renderPage(w, http.StatusOK, "session", sessionPage{sessionView: s.snapshot(session)})
+}
+
+// handleAnswerPage grades an answer submitted from the question page
+func (s *ExamServer) handleAnswerPage(w http.ResponseWriter, r *http.Request) {
+    if err := r.ParseForm(); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    response := r.PostForm.Get("response")
+    if choices := r.PostForm["choice"]; len(choices) > 0 {
+        response = strings.Join(choices, ",")
+    }
+
+    number, _ := strconv.Atoi(r.PostForm.Get("question"))
+    session, _, err := s.Answer(r.PathValue("id"), number, response)
+    switch {
+    case session == nil:
+        http.Error(w, err.Error(), errorStatus(err))
+    case errors.Is(err, ErrInvalidAnswer):
+        // Show the question again with the reason the answer was refused
+        renderPage(w, http.StatusUnprocessableEntity, "session", sessionPage{sessionView: s.snapshot(session), Error: err.Error()})
+    default:
+        http.Redirect(w, r, "/exam/"+session.ID, http.StatusSeeOther)
+    }
+}
+
+// handleQuitPage ends the exam from the question page
+func (s *ExamServer) handleQuitPage(w http.ResponseWriter, r *http.Request) {
+    session, err := s.Quit(r.PathValue("id"))
+    if err != nil {
+        http.Error(w, err.Error(), errorStatus(err))
+        return
+    }
+    http.Redirect(w, r, "/exam/"+session.ID, http.StatusSeeOther)
+}
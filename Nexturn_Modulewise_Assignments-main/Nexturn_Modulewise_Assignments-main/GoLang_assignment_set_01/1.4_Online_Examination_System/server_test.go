@@ -0,0 +1,206 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// newTestExamServer returns a server for a two question bank on a fake clock
+func newTestExamServer(t *testing.T) (*ExamServer, *fakeClock, *ResultStore) {
+    t.Helper()
+    bank := &QuestionBank{
+        Name: "Server Test",
+        Problems: []Problem{
+            {Statement: "First?", Choices: []string{"a", "b"}, RightAnswer: 1, TimeLimit: 10},
+            {Statement: "Second?", Choices: []string{"a", "b"}, RightAnswer: 2, TimeLimit: 10},
+        },
+    }
+    store := NewResultStore(filepath.Join(t.TempDir(), "results.jsonl"))
+    server := NewExamServer([]*QuestionBank{bank}, store, ExamOptions{}, 0)
+    clock := newFakeClock()
+    server.clock = clock
+    return server, clock, store
+}
+
+// newTestServer serves a two question bank on a fake clock
+func newTestServer(t *testing.T) (*httptest.Server, *fakeClock, *ResultStore) {
+    t.Helper()
+    server, clock, store := newTestExamServer(t)
+    httpServer := httptest.NewServer(server.Handler())
+    t.Cleanup(httpServer.Close)
+    return httpServer, clock, store
+}
+
+// postJSON sends a JSON request and decodes the response into out
+func postJSON(t *testing.T, url string, body interface{}, out interface{}) int {
+    t.Helper()
+    data, _ := json.Marshal(body)
+    response, err := http.Post(url, "application/json", bytes.NewReader(data))
+    if err != nil {
+        t.Fatalf("POST %s: %v", url, err)
+    }
+    defer response.Body.Close()
+    if out != nil {
+        json.NewDecoder(response.Body).Decode(out)
+    }
+    return response.StatusCode
+}
+
+func TestServerRejectsLateAnswers(t *testing.T) {
+    httpServer, clock, store := newTestServer(t)
+
+    var session sessionView
+    status := postJSON(t, httpServer.URL+"/api/sessions", map[string]string{"candidate_id": "c1", "bank": "server_test"}, &session)
+    if status != http.StatusCreated || session.Question == nil || session.Question.Number != 1 {
+        t.Fatalf("start session: status %d, %+v", status, session)
+    }
+
+    // The client claims to answer question 1 after its time ran out
+    clock.Advance(11 * time.Second)
+    answerURL := httpServer.URL + "/api/sessions/" + session.ID + "/answer"
+    status = postJSON(t, answerURL, map[string]interface{}{"question": 1, "response": "1"}, nil)
+    if status != http.StatusConflict {
+        t.Fatalf("late answer: status %d, want %d", status, http.StatusConflict)
+    }
+
+    var result struct {
+        Credit  float64     `json:"credit"`
+        Session sessionView `json:"session"`
+    }
+    status = postJSON(t, answerURL, map[string]interface{}{"question": 2, "response": "2"}, &result)
+    if status != http.StatusOK || result.Credit != 1 || result.Session.Status != SESSION_FINISHED {
+        t.Fatalf("answer question 2: status %d, %+v", status, result)
+    }
+
+    attempts, err := store.AttemptsFor("c1")
+    if err != nil || len(attempts) != 1 {
+        t.Fatalf("AttemptsFor() = %v, %v; want one attempt", attempts, err)
+    }
+    if outcome := attempts[0].Answers[0].Outcome; outcome != OUTCOME_TIMED_OUT {
+        t.Errorf("question 1 outcome = %q; want %q", outcome, OUTCOME_TIMED_OUT)
+    }
+    if attempts[0].Score != 1 {
+        t.Errorf("score = %v; want 1", attempts[0].Score)
+    }
+}
+
+func TestServerKeepsSessionsApart(t *testing.T) {
+    httpServer, _, _ := newTestServer(t)
+
+    var first, second sessionView
+    postJSON(t, httpServer.URL+"/api/sessions", map[string]string{"candidate_id": "c1", "bank": "server_test"}, &first)
+    postJSON(t, httpServer.URL+"/api/sessions", map[string]string{"candidate_id": "c2", "bank": "server_test"}, &second)
+    if first.ID == second.ID {
+        t.Fatal("sessions share an ID")
+    }
+
+    postJSON(t, httpServer.URL+"/api/sessions/"+first.ID+"/answer", map[string]interface{}{"question": 1, "response": "1"}, nil)
+
+    response, err := http.Get(httpServer.URL + "/api/sessions/" + second.ID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer response.Body.Close()
+    var view sessionView
+    json.NewDecoder(response.Body).Decode(&view)
+    if view.Question == nil || view.Question.Number != 1 || view.Score != 0 {
+        t.Errorf("second session changed by the first: %+v", view)
+    }
+}
+
+func TestSweepRecordsAbandonedSessions(t *testing.T) {
+    server, clock, store := newTestExamServer(t)
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    go server.SweepSessions(ctx)
+    clock.waitForCalls(t, 1)
+
+    session, err := server.StartSession("c1", "server_test")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // The candidate walks away; nothing else touches the session, but the
+    // next sweep finds both questions' time has run out
+    clock.Advance(SESSION_SWEEP_INTERVAL)
+    clock.waitForCalls(t, 2)
+
+    attempts, err := store.AttemptsFor("c1")
+    if err != nil || len(attempts) != 1 {
+        t.Fatalf("AttemptsFor() = %v, %v; want one attempt", attempts, err)
+    }
+    attempt := attempts[0]
+    if attempt.ID == "" || attempt.EndReason != END_COMPLETED || attempt.Score != 0 {
+        t.Errorf("attempt = %+v; want a completed attempt scoring 0", attempt)
+    }
+    if want := clock.Now().Add(-SESSION_SWEEP_INTERVAL).Add(20 * time.Second); !attempt.FinishedAt.Equal(want) {
+        t.Errorf("finished at %v; want the last question's deadline %v", attempt.FinishedAt, want)
+    }
+    for _, answer := range attempt.Answers {
+        if answer.Outcome != OUTCOME_TIMED_OUT {
+            t.Errorf("question %d outcome = %q; want %q", answer.Question, answer.Outcome, OUTCOME_TIMED_OUT)
+        }
+    }
+
+    // The finished session is kept for its result, then forgotten
+    if _, err := server.Session(session.ID); err != nil {
+        t.Fatalf("Session() after the sweep = %v", err)
+    }
+    clock.Advance(SESSION_RETENTION)
+    clock.waitForCalls(t, 3)
+    if _, err := server.Session(session.ID); err != ErrSessionNotFound {
+        t.Errorf("Session() after retention = %v; want %v", err, ErrSessionNotFound)
+    }
+    if attempts, _ := store.AttemptsFor("c1"); len(attempts) != 1 {
+        t.Errorf("recorded %d attempts; want the session recorded once", len(attempts))
+    }
+}
+
+func TestServerRetriesUnrecordedAttempts(t *testing.T) {
+    server, _, _ := newTestExamServer(t)
+    dir := filepath.Join(t.TempDir(), "results")
+    store := NewResultStore(filepath.Join(dir, "results.jsonl"))
+    server.store = store
+
+    session, err := server.StartSession("c1", "server_test")
+    if err != nil {
+        t.Fatal(err)
+    }
+    // The results directory does not exist yet, so the attempt cannot be written
+    if _, err := server.Quit(session.ID); err == nil {
+        t.Fatal("Quit() succeeded without recording the attempt")
+    }
+    if _, err := server.Session(session.ID); err == nil {
+        t.Fatal("Session() reported the unrecorded attempt as finished")
+    }
+    if view := server.snapshot(session); view.Status == SESSION_FINISHED {
+        t.Errorf("status %q before the attempt was recorded", view.Status)
+    }
+
+    if err := os.Mkdir(dir, 0755); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := server.Quit(session.ID); err != nil {
+        t.Fatalf("Quit() once the results file can be written = %v", err)
+    }
+    view := server.snapshot(session)
+    if view.Status != SESSION_FINISHED || view.Result == nil || view.Result.EndReason != END_QUIT {
+        t.Fatalf("view = %+v; want the quit attempt finished", view)
+    }
+
+    attempts, err := store.AttemptsFor("c1")
+    if err != nil || len(attempts) != 1 {
+        t.Fatalf("AttemptsFor() = %v, %v; want the attempt recorded once", attempts, err)
+    }
+    if answers := attempts[0].Answers; len(answers) != 2 || answers[0].Outcome != OUTCOME_UNANSWERED ||
+        answers[1].Outcome != OUTCOME_NOT_REACHED {
+        t.Errorf("answers = %+v; want the first question unanswered once and the second not reached", answers)
+    }
+}
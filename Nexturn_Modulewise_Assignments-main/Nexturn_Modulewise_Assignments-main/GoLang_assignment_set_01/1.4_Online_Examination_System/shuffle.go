@@ -0,0 +1,122 @@
+package main
+
+import (
+    "fmt"
+    "math/rand"
+    "sort"
+    "time"
+)
+
+// ExamOptions controls how the questions of a bank are drawn for one attempt.
+// The same seed, options and bank always produce the same exam. In adaptive
+// mode the drawn questions form the pool the adaptive test picks from.
+type ExamOptions struct {
+    Seed             int64
+    PerTopic         int
+    ShuffleQuestions bool
+    ShuffleChoices   bool
+    Adaptive         bool
+    TargetSE         float64
+    MaxQuestions     int
+}
+
+// NewSeed returns a seed for an attempt that was not given one
+func NewSeed() int64 {
+    return time.Now().UnixNano()
+}
+
+// randomized reports whether the options change the bank's questions at all
+func (o ExamOptions) randomized() bool {
+    return o.PerTopic > 0 || o.ShuffleQuestions || o.ShuffleChoices
+}
+
+// repeatFlags returns the command-line flags that deal the same exam from
+// the same bank again
+func (o ExamOptions) repeatFlags() string {
+    flags := fmt.Sprintf("-seed %d -per-topic %d -shuffle=%t -shuffle-choices=%t",
+        o.Seed, o.PerTopic, o.ShuffleQuestions, o.ShuffleChoices)
+    if o.Adaptive {
+        flags += fmt.Sprintf(" -adaptive -target-se %g -max-questions %d", o.TargetSE, o.MaxQuestions)
+    }
+    return flags
+}
+
+// prepareProblems draws, orders and shuffles the problems for an attempt
+// without modifying the bank they come from
+func prepareProblems(problems []Problem, opts ExamOptions) []Problem {
+    rng := rand.New(rand.NewSource(opts.Seed))
+
+    selected := make([]Problem, len(problems))
+    copy(selected, problems)
+    if opts.PerTopic > 0 {
+        selected = selectPerTopic(selected, opts.PerTopic, rng)
+    }
+    if opts.ShuffleQuestions {
+        rng.Shuffle(len(selected), func(i, j int) {
+            selected[i], selected[j] = selected[j], selected[i]
+        })
+    }
+    if opts.ShuffleChoices {
+        for i := range selected {
+            selected[i] = shuffleChoices(selected[i], rng)
+        }
+    }
+    return selected
+}
+
+// selectPerTopic picks up to perTopic problems at random from each topic.
+// Topics keep the order they first appear in; a topic with fewer problems
+// contributes all of them.
+func selectPerTopic(problems []Problem, perTopic int, rng *rand.Rand) []Problem {
+    topics := make([]string, 0)
+    pools := make(map[string][]Problem)
+    for _, problem := range problems {
+        if _, exists := pools[problem.Topic]; !exists {
+            topics = append(topics, problem.Topic)
+        }
+        pools[problem.Topic] = append(pools[problem.Topic], problem)
+    }
+
+    selected := make([]Problem, 0, len(problems))
+    for _, topic := range topics {
+        pool := pools[topic]
+        if len(pool) <= perTopic {
+            selected = append(selected, pool...)
+            continue
+        }
+        for _, index := range rng.Perm(len(pool))[:perTopic] {
+            selected = append(selected, pool[index])
+        }
+    }
+    return selected
+}
+
+// shuffleChoices reorders a problem's choices and remaps its right answers.
+// Problems without choices are returned unchanged.
+func shuffleChoices(problem Problem, rng *rand.Rand) Problem {
+    if !problem.hasChoices() {
+        return problem
+    }
+
+    order := rng.Perm(len(problem.Choices))
+    position := make(map[int]int, len(order))
+    choices := make([]string, len(order))
+    for i, from := range order {
+        choices[i] = problem.Choices[from]
+        position[from+1] = i + 1
+    }
+    problem.Choices = choices
+
+    if problem.RightAnswer > 0 {
+        problem.RightAnswer = position[problem.RightAnswer]
+    }
+    if len(problem.RightAnswers) > 0 {
+        rightAnswers := make([]int, len(problem.RightAnswers))
+        for i, answer := range problem.RightAnswers {
+            rightAnswers[i] = position[answer]
+        }
+        sort.Ints(rightAnswers)
+        problem.RightAnswers = rightAnswers
+    }
+    return problem
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "reflect"
+    "sort"
+    "strings"
+    "testing"
+)
+
+// shuffleBank returns problems over three topics, with single choice and
+// multi-select questions whose right answers name known choice texts
+func shuffleBank() []Problem {
+    problems := make([]Problem, 0)
+    for i, topic := range []string{"Maths", "Maths", "Maths", "Science", "Science", "History", "Maths", "Science"} {
+        problem := Problem{
+            Topic:       topic,
+            Statement:   fmt.Sprintf("%s question %d", topic, i+1),
+            Choices:     []string{"right", "wrong a", "wrong b", "wrong c"},
+            RightAnswer: 1,
+        }
+        if i%2 == 1 {
+            problem = Problem{
+                Type:         MULTI_SELECT,
+                Topic:        topic,
+                Statement:    fmt.Sprintf("%s question %d", topic, i+1),
+                Choices:      []string{"right 1", "wrong a", "right 2", "wrong b", "wrong c"},
+                RightAnswers: []int{1, 3},
+            }
+        }
+        problems = append(problems, problem)
+    }
+    return problems
+}
+
+// rightChoices returns the texts of a problem's right answers, sorted
+func rightChoices(problem Problem) []string {
+    answers := problem.RightAnswers
+    if problem.kind() == SINGLE_CHOICE {
+        answers = []int{problem.RightAnswer}
+    }
+    texts := make([]string, 0, len(answers))
+    for _, answer := range answers {
+        texts = append(texts, problem.Choices[answer-1])
+    }
+    sort.Strings(texts)
+    return texts
+}
+
+func TestSameSeedGivesSameExam(t *testing.T) {
+    opts := ExamOptions{Seed: 42, PerTopic: 2, ShuffleQuestions: true, ShuffleChoices: true}
+    first := prepareProblems(shuffleBank(), opts)
+    second := prepareProblems(shuffleBank(), opts)
+    if !reflect.DeepEqual(first, second) {
+        t.Fatalf("seed %d gave two different exams:\n%+v\n%+v", opts.Seed, first, second)
+    }
+
+    differs := false
+    for seed := int64(1); seed <= 5 && !differs; seed++ {
+        opts.Seed = seed
+        differs = !reflect.DeepEqual(first, prepareProblems(shuffleBank(), opts))
+    }
+    if !differs {
+        t.Error("every seed gave the same exam")
+    }
+}
+
+func TestRepeatFlagsRebuildOptions(t *testing.T) {
+    cases := []ExamOptions{
+        {Seed: 42, PerTopic: 2, ShuffleQuestions: true, ShuffleChoices: true},
+        {Seed: -7, ShuffleQuestions: false, ShuffleChoices: true},
+        {Seed: 1234567890123, PerTopic: 1, ShuffleQuestions: true},
+        {Seed: 9, ShuffleQuestions: true, Adaptive: true, TargetSE: 0.35, MaxQuestions: 12},
+    }
+
+    for _, want := range cases {
+        // The same flags main defines, with the defaults it gives them
+        flags := flag.NewFlagSet("exam", flag.ContinueOnError)
+        seed := flags.Int64("seed", 0, "")
+        perTopic := flags.Int("per-topic", 0, "")
+        shuffleQuestions := flags.Bool("shuffle", true, "")
+        shuffleChoices := flags.Bool("shuffle-choices", true, "")
+        adaptive := flags.Bool("adaptive", false, "")
+        targetSE := flags.Float64("target-se", 0, "")
+        maxQuestions := flags.Int("max-questions", 0, "")
+
+        if err := flags.Parse(strings.Fields(want.repeatFlags())); err != nil {
+            t.Fatalf("parse %q: %v", want.repeatFlags(), err)
+        }
+        got := ExamOptions{
+            Seed:             *seed,
+            PerTopic:         *perTopic,
+            ShuffleQuestions: *shuffleQuestions,
+            ShuffleChoices:   *shuffleChoices,
+            Adaptive:         *adaptive,
+            TargetSE:         *targetSE,
+            MaxQuestions:     *maxQuestions,
+        }
+        if got != want {
+            t.Errorf("%q rebuilt %+v; want %+v", want.repeatFlags(), got, want)
+        }
+    }
+}
+
+func TestShuffleChoicesRemapsAnswers(t *testing.T) {
+    bank := shuffleBank()
+    for seed := int64(1); seed <= 20; seed++ {
+        shuffled := prepareProblems(bank, ExamOptions{Seed: seed, ShuffleChoices: true})
+        for i, problem := range shuffled {
+            original := bank[i]
+            if got, want := rightChoices(problem), rightChoices(original); !reflect.DeepEqual(got, want) {
+                t.Fatalf("seed %d, %q: right answers point at %v; want %v", seed, problem.Statement, got, want)
+            }
+            if !sort.IntsAreSorted(problem.RightAnswers) {
+                t.Errorf("seed %d, %q: right answers %v are not sorted", seed, problem.Statement, problem.RightAnswers)
+            }
+            choices := append([]string(nil), problem.Choices...)
+            sort.Strings(choices)
+            want := append([]string(nil), original.Choices...)
+            sort.Strings(want)
+            if !reflect.DeepEqual(choices, want) {
+                t.Errorf("seed %d, %q: choices %v are not a reordering of %v", seed, problem.Statement, problem.Choices, original.Choices)
+            }
+        }
+    }
+
+    // The bank itself is left as it was
+    if !reflect.DeepEqual(bank, shuffleBank()) {
+        t.Error("shuffling modified the bank")
+    }
+}
+
+func TestSelectPerTopic(t *testing.T) {
+    cases := []struct {
+        perTopic int
+        want     map[string]int
+    }{
+        {perTopic: 1, want: map[string]int{"Maths": 1, "Science": 1, "History": 1}},
+        {perTopic: 2, want: map[string]int{"Maths": 2, "Science": 2, "History": 1}},
+        {perTopic: 10, want: map[string]int{"Maths": 4, "Science": 3, "History": 1}},
+    }
+
+    for _, tc := range cases {
+        t.Run(fmt.Sprint(tc.perTopic), func(t *testing.T) {
+            selected := prepareProblems(shuffleBank(), ExamOptions{Seed: 7, PerTopic: tc.perTopic})
+
+            counts := make(map[string]int)
+            topics := make([]string, 0)
+            seen := make(map[string]bool)
+            for _, problem := range selected {
+                if seen[problem.Statement] {
+                    t.Errorf("%q was drawn twice", problem.Statement)
+                }
+                seen[problem.Statement] = true
+                if counts[problem.Topic] == 0 {
+                    topics = append(topics, problem.Topic)
+                }
+                counts[problem.Topic]++
+            }
+            if !reflect.DeepEqual(counts, tc.want) {
+                t.Errorf("drawn per topic %v; want %v", counts, tc.want)
+            }
+            if want := []string{"Maths", "Science", "History"}; !reflect.DeepEqual(topics, want) {
+                t.Errorf("topics in order %v; want %v", topics, want)
+            }
+        })
+    }
+}
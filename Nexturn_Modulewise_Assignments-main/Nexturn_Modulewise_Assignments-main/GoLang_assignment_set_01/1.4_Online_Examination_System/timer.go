@@ -0,0 +1,114 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "os"
+    "time"
+)
+
+// COUNTDOWN_INTERVAL is how often the remaining time display is refreshed
+const COUNTDOWN_INTERVAL = time.Second
+
+// Time limit errors, used as the cancellation cause of a question's context
+var (
+    errQuestionTimeUp = errors.New("question time is up")
+    errExamTimeUp     = errors.New("exam time is up")
+)
+
+// Clock tells the time and schedules wake-ups, so that time limits can be
+// driven by a fake clock in tests
+type Clock interface {
+    Now() time.Time
+    After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the wall clock
+type realClock struct{}
+
+// Now returns the current time
+func (realClock) Now() time.Time {
+    return time.Now()
+}
+
+// After waits for the duration to elapse
+func (realClock) After(d time.Duration) <-chan time.Time {
+    return time.After(d)
+}
+
+// withDeadline returns a context that is cancelled with cause once the clock
+// reaches the deadline. The goroutine watching the clock exits as soon as
+// the context ends either way.
+func withDeadline(ctx context.Context, clock Clock, deadline time.Time, cause error) (context.Context, context.CancelFunc) {
+    ctx, cancel := context.WithCancelCause(ctx)
+    go func() {
+        select {
+        case <-clock.After(deadline.Sub(clock.Now())):
+            cancel(cause)
+        case <-ctx.Done():
+        }
+    }()
+    return ctx, func() { cancel(context.Canceled) }
+}
+
+// timeLimit returns the time allowed for a problem
+func (e *Examination) timeLimit(problem Problem) time.Duration {
+    if problem.TimeLimit > 0 {
+        return time.Duration(problem.TimeLimit) * time.Second
+    }
+    return e.QuestionTimeLimit
+}
+
+// formatRemaining renders a duration as minutes and seconds, rounding up so
+// the display only shows 0:00 once the time has run out
+func formatRemaining(d time.Duration) string {
+    if d < 0 {
+        d = 0
+    }
+    seconds := int((d + time.Second - 1) / time.Second)
+    return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// remainingText describes the time left for the question and the exam
+func (e *Examination) remainingText(questionDeadline time.Time) string {
+    now := e.Clock.Now()
+    text := "Time left: " + formatRemaining(questionDeadline.Sub(now))
+    if !e.examDeadline.IsZero() {
+        text += " | Exam: " + formatRemaining(e.examDeadline.Sub(now))
+    }
+    return text
+}
+
+// startCountdown refreshes the remaining time line above the answer prompt
+// until ctx ends. The returned function stops the countdown and waits for
+// it, so nothing is drawn over the feedback that follows.
+func (e *Examination) startCountdown(ctx context.Context, questionDeadline time.Time) func() {
+    ctx, cancel := context.WithCancel(ctx)
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-e.Clock.After(COUNTDOWN_INTERVAL):
+                // Save the cursor, redraw the line above the prompt, restore
+                fmt.Printf("\0337\033[1A\r\033[2K%s\0338", e.remainingText(questionDeadline))
+            }
+        }
+    }()
+    return func() {
+        cancel()
+        <-done
+    }
+}
+
+// isTerminal reports whether a file is an interactive terminal
+func isTerminal(file *os.File) bool {
+    info, err := file.Stat()
+    if err != nil {
+        return false
+    }
+    return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "io"
+    "runtime"
+    "sync"
+    "testing"
+    "time"
+)
+
+// fakeClock only moves when the test advances it
+type fakeClock struct {
+    mu      sync.Mutex
+    now     time.Time
+    waiters []fakeWaiter
+    calls   int
+}
+
+// fakeWaiter is a pending After call
+type fakeWaiter struct {
+    at time.Time
+    ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+    return &fakeClock{now: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.calls++
+    ch := make(chan time.Time, 1)
+    if d <= 0 {
+        ch <- c.now
+        return ch
+    }
+    c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+    return ch
+}
+
+// Advance moves the clock forward and fires every wake-up that is now due
+func (c *fakeClock) Advance(d time.Duration) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.now = c.now.Add(d)
+    pending := c.waiters[:0]
+    for _, waiter := range c.waiters {
+        if waiter.at.After(c.now) {
+            pending = append(pending, waiter)
+            continue
+        }
+        waiter.ch <- c.now
+    }
+    c.waiters = pending
+}
+
+// waitForCalls blocks until the exam has asked for n wake-ups in total
+func (c *fakeClock) waitForCalls(t *testing.T, n int) {
+    t.Helper()
+    deadline := time.Now().Add(2 * time.Second)
+    for {
+        c.mu.Lock()
+        count := c.calls
+        c.mu.Unlock()
+        if count >= n {
+            return
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("clock has %d After calls, want %d", count, n)
+        }
+        time.Sleep(time.Millisecond)
+    }
+}
+
+func TestQuestionTimeLimitFromBank(t *testing.T) {
+    baseline := runtime.NumGoroutine()
+    pr, pw := io.Pipe()
+    bank := &QuestionBank{
+        Name: "Timed",
+        Problems: []Problem{
+            {Statement: "Quick?", Choices: []string{"a", "b"}, RightAnswer: 1, TimeLimit: 10},
+            {Statement: "Second?", Choices: []string{"a", "b"}, RightAnswer: 2},
+        },
+    }
+    clock := newFakeClock()
+    exam := NewExamination(bank, bufio.NewScanner(pr), ExamOptions{})
+    exam.Clock = clock
+
+    finished := make(chan struct{})
+    go func() {
+        exam.BeginExam(context.Background())
+        close(finished)
+    }()
+
+    writeLine(t, pw, "")
+    clock.waitForCalls(t, 1)
+
+    // The first question allows 10s rather than the 30s default, so once
+    // they pass this answer belongs to the second question
+    clock.Advance(10 * time.Second)
+    clock.waitForCalls(t, 2)
+    writeLine(t, pw, "2")
+    pw.Close()
+
+    select {
+    case <-finished:
+    case <-time.After(2 * time.Second):
+        t.Fatal("BeginExam did not return")
+    }
+    if exam.TotalScore != 1 {
+        t.Errorf("TotalScore = %v; want 1", exam.TotalScore)
+    }
+    waitForGoroutines(t, baseline)
+}
+
+func TestExamDurationEndsExam(t *testing.T) {
+    baseline := runtime.NumGoroutine()
+    pr, pw := io.Pipe()
+    clock := newFakeClock()
+    exam := NewExamination(defaultQuestionBank(), bufio.NewScanner(pr), ExamOptions{})
+    exam.Clock = clock
+    exam.ExamDuration = 45 * time.Second
+
+    finished := make(chan struct{})
+    go func() {
+        exam.BeginExam(context.Background())
+        close(finished)
+    }()
+
+    // Exam and first question deadlines are scheduled
+    writeLine(t, pw, "")
+    clock.waitForCalls(t, 2)
+
+    // The first question times out, the second is answered correctly
+    clock.Advance(30 * time.Second)
+    clock.waitForCalls(t, 3)
+    writeLine(t, pw, "2")
+    clock.waitForCalls(t, 4)
+
+    // 45s after the start the third question is cut short with the exam
+    clock.Advance(15 * time.Second)
+
+    select {
+    case <-finished:
+    case <-time.After(2 * time.Second):
+        t.Fatal("BeginExam did not end when the exam time ran out")
+    }
+    if exam.TotalScore != 1 {
+        t.Errorf("TotalScore = %v; want 1", exam.TotalScore)
+    }
+
+    pw.Close()
+    waitForGoroutines(t, baseline)
+}
+
+func TestFormatRemaining(t *testing.T) {
+    tests := []struct {
+        remaining time.Duration
+        want      string
+    }{
+        {90 * time.Second, "1:30"},
+        {1500 * time.Millisecond, "0:02"},
+        {0, "0:00"},
+        {-time.Second, "0:00"},
+    }
+    for _, test := range tests {
+        if got := formatRemaining(test.remaining); got != test.want {
+            t.Errorf("formatRemaining(%v) = %q; want %q", test.remaining, got, test.want)
+        }
+    }
+}